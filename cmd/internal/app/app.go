@@ -0,0 +1,166 @@
+// Package app собирает сервис целиком: сервисы поверх репозиториев хранилища, политику доступа,
+// HTTP-обработчики и маршруты. Сборка общая для main.go и тестов:
+//
+//	a := app.New(storage, app.Config{Signer: signer, ActionSigner: actionSigner, Mailer: &mail.MemoryMailer{}})
+//	srv := httptest.NewServer(a.Routes())
+//
+// Между New и Routes любой сервис App можно заменить, например подделкой или декоратором.
+package app
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/handler"
+	"github.com/UnendingLoop/users-api/cmd/internal/mail"
+	"github.com/UnendingLoop/users-api/cmd/internal/policy"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"github.com/UnendingLoop/users-api/cmd/internal/service"
+	_ "github.com/UnendingLoop/users-api/docs"
+	"github.com/go-chi/chi/v5"
+	httpSwagger "github.com/swaggo/http-swagger"
+)
+
+const (
+	DefaultSoftDeleteRetention = 30 * 24 * time.Hour
+	DefaultPurgeInterval       = time.Hour
+)
+
+// Config - настройки сервиса. Signer, ActionSigner и Mailer обязательны, нулевые значения
+// остальных полей заменяются значениями по умолчанию.
+type Config struct {
+	// Signer подписывает и проверяет access-токены
+	Signer *auth.Signer
+	// ActionSigner подписывает токены в ссылках из писем
+	ActionSigner *auth.ActionSigner
+	Mailer       mail.Mailer
+	// BaseURL - адрес фронтенда, на который ведут ссылки из писем
+	BaseURL    string
+	RefreshTTL time.Duration
+	TOTPIssuer string
+	// MaxPathDepth и PathVisitBudget ограничивают поиск пути между пользователями
+	MaxPathDepth    int
+	PathVisitBudget int
+	// RequireIfMatch - отклонять изменение и удаление пользователя без заголовка If-Match
+	RequireIfMatch bool
+	// SoftDeleteRetention - сколько хранить удаленных пользователей, PurgeInterval - как часто их очищать
+	SoftDeleteRetention time.Duration
+	PurgeInterval       time.Duration
+	// MigrateOnStart - применять миграции SQL-хранилища при старте
+	MigrateOnStart bool
+}
+
+// App - собранный сервис
+type App struct {
+	Config    Config
+	Storage   *repository.Storage
+	Users     service.UserService
+	Friends   service.FriendshipService
+	Auth      service.AuthService
+	TwoFactor service.TwoFactorService
+	Email     service.EmailService
+	APIKeys   service.APIKeyService
+	Policy    policy.Policy
+}
+
+// New создает сервисы поверх репозиториев storage.
+func New(storage *repository.Storage, cfg Config) *App {
+	if cfg.SoftDeleteRetention <= 0 {
+		cfg.SoftDeleteRetention = DefaultSoftDeleteRetention
+	}
+	if cfg.PurgeInterval <= 0 {
+		cfg.PurgeInterval = DefaultPurgeInterval
+	}
+	a := &App{Config: cfg, Storage: storage, Policy: policy.NewPolicy(storage.Users)}
+	a.Email = service.NewEmailService(storage.Users, storage.EmailTokens, cfg.Mailer, cfg.ActionSigner, cfg.BaseURL)
+	a.Users = service.NewUserService(storage.Users, a.Email)
+	a.Friends = service.NewFriendService(storage.Friends, storage.Users, cfg.MaxPathDepth, cfg.PathVisitBudget)
+	a.TwoFactor = service.NewTwoFactorService(storage.Users, storage.TwoFactor, cfg.TOTPIssuer)
+	a.Auth = service.NewAuthService(storage.Users, storage.Tokens, cfg.Signer, cfg.RefreshTTL, a.TwoFactor, a.Email)
+	a.APIKeys = service.NewAPIKeyService(storage.APIKeys, storage.Users)
+	return a
+}
+
+// RunPurge периодически очищает мягко удаленных пользователей, пока не отменен ctx.
+func (a *App) RunPurge(ctx context.Context) {
+	service.RunPurge(ctx, a.Users, a.Config.SoftDeleteRetention, a.Config.PurgeInterval)
+}
+
+// Routes создает обработчики поверх текущих сервисов App и возвращает маршруты API.
+func (a *App) Routes() http.Handler {
+	userHandler := handler.UserHandler{Repo: a.Users, Policy: a.Policy, RequireIfMatch: a.Config.RequireIfMatch}
+	friendHandler := handler.FriendHandler{Repo: a.Friends, Policy: a.Policy}
+	authHandler := handler.AuthHandler{Repo: a.Auth}
+	apiKeyHandler := handler.APIKeyHandler{Repo: a.APIKeys, Policy: a.Policy}
+	twoFactorHandler := handler.TwoFactorHandler{Repo: a.TwoFactor, Policy: a.Policy}
+	emailHandler := handler.EmailHandler{Repo: a.Email, Policy: a.Policy}
+
+	r := chi.NewRouter()
+
+	r.Post("/auth/register", authHandler.Register)
+	r.Post("/auth/login", authHandler.Login)
+	r.Post("/auth/refresh", authHandler.Refresh)
+	r.Post("/auth/logout", authHandler.Logout)
+	r.Post("/auth/password_reset", emailHandler.RequestPasswordReset)
+	r.Post("/auth/password_reset/confirm", emailHandler.ResetPassword)
+	//ссылка из письма может открываться без входа в аккаунт - токен сам подтверждает владение адресом
+	r.Post("/users/{id}/verify_email", emailHandler.VerifyEmail)
+
+	//все остальные маршруты API требуют access-токен пользователя или API-ключ сервиса;
+	//для API-ключей каждая группа маршрутов требует свою область доступа
+	r.Group(func(r chi.Router) {
+		r.Use(handler.Authenticate(a.Auth, a.APIKeys))
+
+		r.Group(func(r chi.Router) {
+			r.Use(handler.RequireScope(auth.ScopeUsersRead))
+			r.Get("/users", userHandler.ListUsers)
+			r.Get("/users/search", userHandler.SearchUsers)
+			r.Get("/users/{id}", userHandler.GetUserByID)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(handler.RequireScope(auth.ScopeUsersWrite))
+			r.Post("/users", userHandler.CreateUser)
+			r.Delete("/delete/{id}", userHandler.DeleteUser)
+			r.Put("/update/{id}", userHandler.UpdateUser)
+			r.Patch("/users/{id}", userHandler.PatchUser)
+			r.Post("/users/{id}/restore", userHandler.RestoreUser)
+			r.Post("/users/{id}/verify_email/send", emailHandler.SendVerificationEmail)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(handler.RequireScope(auth.ScopeFriendsRead))
+			r.Get("/users/{id}/friends", friendHandler.GetFriendsList)
+			r.Get("/users/{id}/friend_requests/incoming", friendHandler.GetIncomingRequests)
+			r.Get("/users/{id}/friend_requests/outgoing", friendHandler.GetOutgoingRequests)
+			r.Get("/users/{id1}/mutual_friends/{id2}", friendHandler.GetMutualFriends)
+			r.Get("/users/{id}/suggestions", friendHandler.GetSuggestions)
+			r.Get("/users/{id1}/path/{id2}", friendHandler.FindPath)
+			r.Get("/users/{id}/blocked", friendHandler.GetBlockedUsers)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(handler.RequireScope(auth.ScopeFriendsWrite))
+			r.Post("/users/{id1}/make_friend/{id2}", friendHandler.MakeFriend)
+			r.Delete("/users/{id1}/remove_friend/{id2}", friendHandler.RemoveFriend)
+			r.Post("/users/{id}/friend_requests/{other}/accept", friendHandler.AcceptFriend)
+			r.Post("/users/{id}/friend_requests/{other}/decline", friendHandler.DeclineFriend)
+			r.Post("/users/{id}/friend_requests/{other}/cancel", friendHandler.CancelFriendRequest)
+			r.Post("/users/{id}/block/{target}", friendHandler.BlockUser)
+			r.Delete("/users/{id}/unblock/{target}", friendHandler.UnblockUser)
+		})
+
+		//второй фактор настраивает только сам пользователь
+		r.Post("/users/{id}/2fa/setup", twoFactorHandler.SetupTOTP)
+		r.Post("/users/{id}/2fa/verify", twoFactorHandler.EnableTOTP)
+		r.Post("/users/{id}/2fa/disable", twoFactorHandler.DisableTOTP)
+
+		//управление ключами доступно только администраторам, не самим ключам
+		r.Post("/api_keys", apiKeyHandler.CreateAPIKey)
+		r.Get("/api_keys", apiKeyHandler.ListAPIKeys)
+		r.Delete("/api_keys/{id}", apiKeyHandler.RevokeAPIKey)
+	})
+
+	r.Get("/swagger/*", httpSwagger.WrapHandler)
+	return r
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/config"
+)
+
+// LoadConfig читает настройки сервиса из переменных окружения. Хранилище открывается отдельно
+// (config.LoadStorage), чтобы команда migrate не требовала настроек, нужных только серверу.
+func LoadConfig() Config {
+	return Config{
+		Signer:              config.LoadSigner(),
+		ActionSigner:        config.LoadActionSigner(),
+		Mailer:              config.LoadMailer(),
+		BaseURL:             os.Getenv("APP_BASE_URL"),
+		RefreshTTL:          envDuration("REFRESH_TOKEN_TTL", 0),
+		TOTPIssuer:          os.Getenv("TOTP_ISSUER"),
+		MaxPathDepth:        envInt("PATH_MAX_DEPTH", 0),
+		PathVisitBudget:     envInt("PATH_VISIT_BUDGET", 0),
+		RequireIfMatch:      envBool("REQUIRE_IF_MATCH", false),
+		SoftDeleteRetention: envDuration("SOFT_DELETE_RETENTION", DefaultSoftDeleteRetention),
+		PurgeInterval:       envDuration("PURGE_INTERVAL", DefaultPurgeInterval),
+		MigrateOnStart:      envBool("MIGRATE_ON_START", false),
+	}
+}
+
+// envInt читает целочисленную переменную окружения, при отсутствии возвращает def
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("%s must be an integer: %v", key, err)
+	}
+	return n
+}
+
+// envBool читает логическую переменную окружения, при отсутствии возвращает def
+func envBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("%s must be a boolean: %v", key, err)
+	}
+	return b
+}
+
+// envDuration читает длительность (например "720h") из переменной окружения, при отсутствии возвращает def
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Fatalf("%s must be a positive duration: %v", key, v)
+	}
+	return d
+}
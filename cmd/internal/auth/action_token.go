@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Purpose - назначение одноразового токена из письма. Токен одного назначения не принимается для другого.
+type Purpose string
+
+const (
+	PurposeVerifyEmail   Purpose = "verify_email"
+	PurposePasswordReset Purpose = "password_reset"
+)
+
+// ActionClaims - содержимое одноразового токена. Nonce связывает токен с записью в базе,
+// по которой отслеживается, что токен еще не использован.
+type ActionClaims struct {
+	UserID    int64
+	Purpose   Purpose
+	Nonce     string
+	ExpiresAt time.Time
+}
+
+// ActionSigner подписывает одноразовые токены для ссылок в письмах. Ключ должен отличаться
+// от ключа access-токенов, чтобы токен из письма нельзя было выдать за access-токен и наоборот.
+type ActionSigner struct {
+	secret []byte
+}
+
+// NewActionSigner создает ActionSigner с симметричным секретом.
+func NewActionSigner(secret []byte) (*ActionSigner, error) {
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("action token secret must be at least 32 bytes")
+	}
+	return &ActionSigner{secret: secret}, nil
+}
+
+// Sign подписывает токен.
+func (s *ActionSigner) Sign(c ActionClaims) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Issuer:    issuer,
+		Subject:   strconv.FormatInt(c.UserID, 10),
+		Audience:  jwt.ClaimStrings{string(c.Purpose)},
+		ID:        c.Nonce,
+		ExpiresAt: jwt.NewNumericDate(c.ExpiresAt),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+}
+
+// Verify проверяет подпись, назначение и срок действия токена на момент now.
+func (s *ActionSigner) Verify(token string, purpose Purpose, now time.Time) (ActionClaims, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(issuer),
+		jwt.WithAudience(string(purpose)), jwt.WithExpirationRequired(), jwt.WithTimeFunc(func() time.Time { return now }))
+	if err != nil {
+		return ActionClaims{}, err
+	}
+	id, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil || id <= 0 || claims.ID == "" {
+		return ActionClaims{}, fmt.Errorf("invalid action token claims")
+	}
+	return ActionClaims{UserID: id, Purpose: purpose, Nonce: claims.ID, ExpiresAt: claims.ExpiresAt.Time}, nil
+}
@@ -0,0 +1,16 @@
+package auth
+
+import "context"
+
+type ctxKey struct{}
+
+// WithUserID возвращает контекст с id аутентифицированного пользователя.
+func WithUserID(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, ctxKey{}, userID)
+}
+
+// UserID возвращает id аутентифицированного пользователя из контекста запроса.
+func UserID(ctx context.Context) (int64, bool) {
+	id, ok := ctx.Value(ctxKey{}).(int64)
+	return id, ok
+}
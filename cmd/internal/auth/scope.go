@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Scope - область доступа API-ключа.
+type Scope string
+
+const (
+	ScopeUsersRead    Scope = "users:read"
+	ScopeUsersWrite   Scope = "users:write"
+	ScopeFriendsRead  Scope = "friends:read"
+	ScopeFriendsWrite Scope = "friends:write"
+)
+
+// Scopes - все известные области доступа.
+var Scopes = []Scope{ScopeUsersRead, ScopeUsersWrite, ScopeFriendsRead, ScopeFriendsWrite}
+
+// ParseScopes разбирает список областей через запятую и отклоняет неизвестные.
+func ParseScopes(s string) ([]Scope, error) {
+	var scopes []Scope
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !knownScope(Scope(part)) {
+			return nil, fmt.Errorf("unknown scope %q", part)
+		}
+		scopes = append(scopes, Scope(part))
+	}
+	return scopes, nil
+}
+
+// JoinScopes собирает области в строку через запятую для хранения.
+func JoinScopes(scopes []Scope) string {
+	parts := make([]string, len(scopes))
+	for i, s := range scopes {
+		parts[i] = string(s)
+	}
+	return strings.Join(parts, ",")
+}
+
+func knownScope(s Scope) bool {
+	for _, known := range Scopes {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyPrincipal - сервис, аутентифицированный API-ключом.
+type APIKeyPrincipal struct {
+	KeyID  int64
+	Prefix string
+	Scopes []Scope
+}
+
+// Has сообщает, выдана ли ключу область scope.
+func (p APIKeyPrincipal) Has(scope Scope) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type apiKeyCtxKey struct{}
+
+// WithAPIKey возвращает контекст с данными API-ключа, которым аутентифицирован запрос.
+func WithAPIKey(ctx context.Context, p APIKeyPrincipal) context.Context {
+	return context.WithValue(ctx, apiKeyCtxKey{}, p)
+}
+
+// APIKey возвращает данные API-ключа из контекста запроса.
+func APIKey(ctx context.Context) (APIKeyPrincipal, bool) {
+	p, ok := ctx.Value(apiKeyCtxKey{}).(APIKeyPrincipal)
+	return p, ok
+}
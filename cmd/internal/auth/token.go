@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const issuer = "users-api"
+
+// Signer выпускает и проверяет access-токены. Поддерживаются HS256 с общим секретом
+// и RS256 с парой ключей - для RS256 проверять токены может кто угодно с публичным ключом.
+type Signer struct {
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+	ttl       time.Duration
+}
+
+// NewHS256Signer создает Signer с симметричным секретом.
+func NewHS256Signer(secret []byte, ttl time.Duration) (*Signer, error) {
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("HS256 secret must be at least 32 bytes")
+	}
+	return &Signer{method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret, ttl: ttl}, nil
+}
+
+// NewRS256Signer создает Signer из приватного RSA-ключа в PEM.
+func NewRS256Signer(privatePEM []byte, ttl time.Duration) (*Signer, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+	if err != nil {
+		return nil, fmt.Errorf("parse RSA private key: %w", err)
+	}
+	return &Signer{method: jwt.SigningMethodRS256, signKey: key, verifyKey: &key.PublicKey, ttl: ttl}, nil
+}
+
+// TTL - время жизни выпускаемых access-токенов.
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
+
+// Sign выпускает access-токен для пользователя.
+func (s *Signer) Sign(userID int64, now time.Time) (string, error) {
+	claims := jwt.RegisteredClaims{
+		Issuer:    issuer,
+		Subject:   strconv.FormatInt(userID, 10),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
+	}
+	return jwt.NewWithClaims(s.method, claims).SignedString(s.signKey)
+}
+
+// Parse проверяет подпись, алгоритм и срок действия токена и возвращает id пользователя.
+func (s *Signer) Parse(token string) (int64, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return s.verifyKey, nil
+	}, jwt.WithValidMethods([]string{s.method.Alg()}), jwt.WithIssuer(issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid token subject %q", claims.Subject)
+	}
+	return id, nil
+}
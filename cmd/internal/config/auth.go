@@ -0,0 +1,50 @@
+package config
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+)
+
+// LoadSigner создает подписчик access-токенов из переменных окружения:
+// JWT_ALG (HS256 по умолчанию или RS256), JWT_SECRET для HS256,
+// JWT_PRIVATE_KEY_FILE (PEM) для RS256 и ACCESS_TOKEN_TTL (по умолчанию 15m).
+func LoadSigner() *auth.Signer {
+	ttl := 15 * time.Minute
+	if v := os.Getenv("ACCESS_TOKEN_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			log.Fatalf("ACCESS_TOKEN_TTL must be a positive duration: %v", v)
+		}
+		ttl = d
+	}
+
+	var signer *auth.Signer
+	var err error
+	switch alg := os.Getenv("JWT_ALG"); alg {
+	case "", "HS256":
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			log.Fatal("JWT_SECRET is not set in env")
+		}
+		signer, err = auth.NewHS256Signer([]byte(secret), ttl)
+	case "RS256":
+		path := os.Getenv("JWT_PRIVATE_KEY_FILE")
+		if path == "" {
+			log.Fatal("JWT_PRIVATE_KEY_FILE is not set in env")
+		}
+		pem, readErr := os.ReadFile(path)
+		if readErr != nil {
+			log.Fatalf("Cannot read JWT private key: %v", readErr)
+		}
+		signer, err = auth.NewRS256Signer(pem, ttl)
+	default:
+		log.Fatalf("Unsupported JWT_ALG %q, expected HS256 or RS256", alg)
+	}
+	if err != nil {
+		log.Fatalf("Cannot create token signer: %v", err)
+	}
+	return signer
+}
@@ -1,40 +1,224 @@
 package config
 
 import (
+	"database/sql"
+	"fmt"
 	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
 
-	"github.com/UnendingLoop/users-api/cmd/internal/model"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"github.com/mattn/go-sqlite3"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-var models []any = []any{
-	&model.User{},
-	&model.Friendship{},
+// DBDriver - способ подключения к хранилищу, выбираемый через DB_DRIVER. Задается ровно одна из функций:
+// Open для SQL-баз, работающих через GORM, или OpenStorage для хранилищ со своими репозиториями.
+type DBDriver struct {
+	// Open открывает базу по строке подключения. Схему создают миграции (пакет migrations), а не подключение.
+	Open func(dsn string) (*gorm.DB, error)
+	// OpenStorage открывает хранилище без SQL-схемы, например встроенную key-value базу, сразу с репозиториями
+	OpenStorage func(dsn string) (*repository.Storage, error)
+	// DefaultDSN используется, если DATABASE_URL не задан. Пустая строка - DATABASE_URL обязателен.
+	DefaultDSN string
+	// Ephemeral - база живет, только пока работает процесс, поэтому миграции к ней применяются при каждом запуске
+	Ephemeral bool
 }
 
-func ConnectSQLite(path string) *gorm.DB {
-	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
-	if err != nil {
-		log.Fatalf("Cannot open db: %v", err)
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]DBDriver)
+)
+
+// RegisterDBDriver делает драйвер доступным под именем name. Повторная регистрация имени - ошибка программы.
+func RegisterDBDriver(name string, driver DBDriver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if (driver.Open == nil) == (driver.OpenStorage == nil) {
+		panic("config: RegisterDBDriver needs exactly one of Open and OpenStorage for " + name)
+	}
+	if _, dup := drivers[name]; dup {
+		panic("config: RegisterDBDriver called twice for " + name)
+	}
+	drivers[name] = driver
+}
+
+// DBDrivers возвращает имена зарегистрированных драйверов по алфавиту
+func DBDrivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
 	}
+	slices.Sort(names)
+	return names
+}
+
+// sqliteDriverName - драйвер go-sqlite3, в соединениях которого lower() понижает регистр по правилам
+// Unicode, как strings.ToLower в хранилищах memory и bolt. Встроенная lower() SQLite меняет только
+// ASCII, и фильтры по кириллице находили бы не то же, что на остальных хранилищах.
+const sqliteDriverName = "sqlite3_unicode"
 
-	if err := db.AutoMigrate(models...); err != nil {
-		log.Fatalf("Failed to migrate: %v", err)
+func init() {
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("lower", unicodeLower, true)
+		},
+	})
+	RegisterDBDriver("postgres", DBDriver{Open: openPostgres})
+	RegisterDBDriver("sqlite", DBDriver{Open: openSQLite, DefaultDSN: "users.db"})
+	RegisterDBDriver("sqlite-memory", DBDriver{Open: openMemory, DefaultDSN: "users-api", Ephemeral: true})
+	RegisterDBDriver("memory", DBDriver{OpenStorage: openMemoryStore, DefaultDSN: "memory", Ephemeral: true})
+	RegisterDBDriver("bolt", DBDriver{OpenStorage: openBolt, DefaultDSN: "users.bolt"})
+}
+
+// LoadStorage открывает хранилище из переменных окружения. DB_DRIVER - имя зарегистрированного драйвера
+// (postgres по умолчанию, sqlite, sqlite-memory, memory или bolt), DATABASE_URL - строка подключения к нему
+// (для sqlite и bolt - путь к файлу, для sqlite-memory - имя базы, memory его не использует).
+// У SQL-драйверов Storage.DB - открытая база.
+func LoadStorage() (*repository.Storage, DBDriver) {
+	name := os.Getenv("DB_DRIVER")
+	if name == "" {
+		name = "postgres"
+	}
+	driversMu.RLock()
+	driver, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		log.Fatalf("Unsupported DB_DRIVER %q, expected one of %s", name, strings.Join(DBDrivers(), ", "))
 	}
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		dsn = driver.DefaultDSN
+	}
+	if dsn == "" {
+		log.Fatalf("DATABASE_URL is not set in env (required for DB_DRIVER=%s)", name)
+	}
+	if driver.OpenStorage != nil {
+		storage, err := driver.OpenStorage(dsn)
+		if err != nil {
+			log.Fatalf("Cannot open %s storage: %v", name, err)
+		}
+		return storage, driver
+	}
+	db, err := driver.Open(dsn)
+	if err != nil {
+		log.Fatalf("Cannot open %s db: %v", name, err)
+	}
+	return repository.NewGormStorage(db), driver
+}
 
+// ConnectSQLite открывает базу SQLite. Схему создают миграции (пакет migrations), а не подключение.
+func ConnectSQLite(path string) *gorm.DB {
+	db, err := openSQLite(path)
+	if err != nil {
+		log.Fatalf("Cannot open db: %v", err)
+	}
 	return db
 }
+
+// ConnectPostgres открывает базу Postgres. Схему создают миграции (пакет migrations), а не подключение.
 func ConnectPostgres(dsn string) *gorm.DB {
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := openPostgres(dsn)
 	if err != nil {
 		log.Fatalf("Cannot open db: %v", err)
 	}
+	return db
+}
 
-	if err := db.AutoMigrate(models...); err != nil {
-		log.Fatalf("Failed to migrate: %v", err)
+func openPostgres(dsn string) (*gorm.DB, error) {
+	return gorm.Open(postgres.Open(dsn), &gorm.Config{})
+}
+
+// openSQLite открывает файл SQLite в режиме WAL, чтобы чтение не ждало записи, с проверкой
+// внешних ключей и ожиданием блокировки вместо немедленной ошибки SQLITE_BUSY
+func openSQLite(path string) (*gorm.DB, error) {
+	inMemory := strings.Contains(path, ":memory:") || strings.Contains(path, "mode=memory")
+	if !inMemory && !strings.Contains(path, "_journal") {
+		path = withPragma(path, "_journal_mode", "WAL")
 	}
-	return db
+	return gorm.Open(openSQLiteDialector(withPragmas(path)), &gorm.Config{})
+}
+
+// openSQLiteDialector - диалект GORM для SQLite поверх драйвера sqliteDriverName
+func openSQLiteDialector(dsn string) gorm.Dialector {
+	return sqlite.New(sqlite.Config{DriverName: sqliteDriverName, DSN: dsn})
+}
+
+// unicodeLower - lower() для SQLite: строки в нижнем регистре по Unicode, NULL остается NULL,
+// числа, как и во встроенной lower(), становятся текстом
+func unicodeLower(v any) any {
+	switch v := v.(type) {
+	case string:
+		return strings.ToLower(v)
+	case []byte:
+		if v == nil {
+			return nil
+		}
+		return strings.ToLower(string(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// openMemory открывает базу SQLite в памяти процесса под именем name. Все соединения пула должны видеть
+// одну и ту же базу, а база в памяти исчезает с закрытием последнего соединения, поэтому пул
+// ограничен одним постоянным соединением.
+func openMemory(name string) (*gorm.DB, error) {
+	db, err := gorm.Open(openSQLiteDialector(withPragmas(fmt.Sprintf("file:%s?mode=memory&cache=shared", name))), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetConnMaxIdleTime(0)
+	sqlDB.SetConnMaxLifetime(0)
+	return db, nil
+}
+
+// openMemoryStore создает пустое хранилище в памяти процесса с репозиториями repository.Memory*.
+// Строка подключения не используется.
+func openMemoryStore(string) (*repository.Storage, error) {
+	return repository.NewMemoryStorage(repository.NewMemoryStore()), nil
+}
+
+// openBolt открывает файл встроенной базы bbolt по пути path
+func openBolt(path string) (*repository.Storage, error) {
+	store, err := repository.OpenBoltStore(path)
+	if err != nil {
+		return nil, err
+	}
+	return repository.NewBoltStorage(store), nil
+}
+
+// withPragmas включает проверку внешних ключей SQLite и ожидание блокировки до 5 секунд. Они настраиваются
+// для каждого соединения, поэтому задаются параметрами DSN, а не разовым PRAGMA. Параметры, уже заданные
+// в DSN, не меняются.
+func withPragmas(path string) string {
+	if !strings.Contains(path, "_fk=") {
+		path = withPragma(path, "_foreign_keys", "on")
+	}
+	if !strings.Contains(path, "_timeout=") {
+		path = withPragma(path, "_busy_timeout", "5000")
+	}
+	return path
+}
+
+// withPragma добавляет параметр key=value к DSN go-sqlite3, если его там еще нет
+func withPragma(path, key, value string) string {
+	if strings.Contains(path, key+"=") {
+		return path
+	}
+	if strings.Contains(path, "?") {
+		return path + "&" + key + "=" + value
+	}
+	return path + "?" + key + "=" + value
 }
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/mail"
+)
+
+// LoadMailer создает отправителя писем из переменных окружения. MAIL_DRIVER:
+// smtp (SMTP_ADDR, SMTP_USER, SMTP_PASSWORD), file (MAIL_DIR, по умолчанию ./mail) или memory.
+// По умолчанию письма складываются в файлы, чтобы локальный запуск не требовал SMTP-сервера.
+// MAIL_FROM - адрес отправителя.
+func LoadMailer() mail.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@users-api.local"
+	}
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			log.Fatal("SMTP_ADDR is not set in env")
+		}
+		var smtpAuth smtp.Auth
+		if user := os.Getenv("SMTP_USER"); user != "" {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				log.Fatalf("SMTP_ADDR must be host:port: %v", err)
+			}
+			smtpAuth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		return mail.SMTPMailer{Addr: addr, From: from, Auth: smtpAuth}
+	case "", "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		log.Printf("Emails are written to %s instead of being sent, set MAIL_DRIVER=smtp to send them", dir)
+		return mail.FileMailer{Dir: dir, From: from}
+	case "memory":
+		return &mail.MemoryMailer{}
+	default:
+		log.Fatalf("Unsupported MAIL_DRIVER %q, expected smtp, file or memory", driver)
+		return nil
+	}
+}
+
+// LoadActionSigner создает подписчик токенов для ссылок в письмах из EMAIL_TOKEN_SECRET.
+// Если он не задан, ключ выводится из JWT_SECRET, чтобы не совпадать с ключом access-токенов.
+func LoadActionSigner() *auth.ActionSigner {
+	secret := []byte(os.Getenv("EMAIL_TOKEN_SECRET"))
+	if len(secret) == 0 {
+		jwtSecret := os.Getenv("JWT_SECRET")
+		if jwtSecret == "" {
+			log.Fatal("EMAIL_TOKEN_SECRET is not set in env")
+		}
+		mac := hmac.New(sha256.New, []byte(jwtSecret))
+		mac.Write([]byte("users-api email tokens"))
+		secret = mac.Sum(nil)
+	}
+	signer, err := auth.NewActionSigner(secret)
+	if err != nil {
+		log.Fatalf("Cannot create email token signer: %v", err)
+	}
+	return signer
+}
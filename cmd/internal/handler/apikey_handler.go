@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/policy"
+	"github.com/UnendingLoop/users-api/cmd/internal/service"
+)
+
+// APIKeyHandler handles HTTP-requests related to service API keys. All actions require the admin role.
+type APIKeyHandler struct {
+	Repo   service.APIKeyService
+	Policy policy.Policy
+}
+
+// CreateAPIKey - хендлер для выпуска API-ключа
+// @Summary      Выпуск API-ключа
+// @Description  Создает ключ с областями доступа users:read, users:write, friends:read, friends:write. Сам ключ возвращается только в этом ответе
+// @Tags         api_keys
+// @Accept       json
+// @Produce      json
+// @Param        key   body      service.CreateAPIKeyRequest  true  "Key name, scopes and optional expiry"
+// @Success      201   {object}  service.CreatedAPIKey
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      403   {object}  problemResponse  "Admin role required"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /api_keys [post]
+func (KH APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if err := KH.Policy.RequireAdmin(r.Context(), policy.ManageAPIKeys); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req service.CreateAPIKeyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	callerID, _ := auth.UserID(r.Context())
+	key, err := KH.Repo.CreateAPIKey(req, callerID, r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, key)
+}
+
+// ListAPIKeys - хендлер для получения списка API-ключей
+// @Summary      Список API-ключей
+// @Description  Возвращает все ключи, включая отозванные и просроченные, без секретной части
+// @Tags         api_keys
+// @Produce      json
+// @Success      200   {array}   model.APIKey
+// @Failure      403   {object}  problemResponse  "Admin role required"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /api_keys [get]
+func (KH APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if err := KH.Policy.RequireAdmin(r.Context(), policy.ManageAPIKeys); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	keys, err := KH.Repo.ListAPIKeys(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// RevokeAPIKey - хендлер для отзыва API-ключа
+// @Summary      Отзыв API-ключа
+// @Description  Отзывает ключ: дальнейшие запросы с ним получают 401
+// @Tags         api_keys
+// @Param        id   path      int  true  "API key id"
+// @Success      204  {string}  string  "No Content"
+// @Failure      400  {object}  problemResponse  "Invalid key id"
+// @Failure      403  {object}  problemResponse  "Admin role required"
+// @Failure      404  {object}  problemResponse  "Api key not found or already revoked"
+// @Failure      500  {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /api_keys/{id} [delete]
+func (KH APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if err := KH.Policy.RequireAdmin(r.Context(), policy.ManageAPIKeys); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := KH.Repo.RevokeAPIKey(id, r.Context()); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
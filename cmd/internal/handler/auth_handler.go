@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/service"
+)
+
+// AuthHandler handles HTTP-requests related to registration and tokens.
+type AuthHandler struct {
+	Repo service.AuthService
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// второй фактор нужен только пользователям с включенной 2FA
+	service.SecondFactor
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Register - хендлер для регистрации пользователя с паролем
+// @Summary      Регистрация пользователя
+// @Description  Создаёт пользователя с паролем (не короче 8 символов) и сразу выдаёт access- и refresh-токены
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        user  body      service.RegisterRequest  true  "Registration data"
+// @Success      201   {object}  service.AuthResult
+// @Failure      400   {object}  problemResponse  "Invalid JSON, empty fields, invalid email or weak password"
+// @Failure      409   {object}  problemResponse  "Email conflict: already in use"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Router       /auth/register [post]
+func (AH AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req service.RegisterRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res, err := AH.Repo.Register(req, r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, res)
+}
+
+// Login - хендлер для входа по email и паролю
+// @Summary      Вход по email и паролю
+// @Description  Проверяет email и пароль и выдаёт access- и refresh-токены. При включенной 2FA нужен также otp_code или recovery_code
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        credentials  body      loginRequest  true  "Email and password"
+// @Success      200   {object}  service.AuthResult
+// @Failure      400   {object}  problemResponse  "Invalid JSON"
+// @Failure      401   {object}  problemResponse  "Invalid email or password, two-factor code required or invalid"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Router       /auth/login [post]
+func (AH AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res, err := AH.Repo.Login(req.Email, req.Password, req.SecondFactor, r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// Refresh - хендлер для обновления пары токенов
+// @Summary      Обновление токенов
+// @Description  Обменивает refresh-токен на новую пару токенов. Старый refresh-токен становится недействительным, его повторное использование отзывает всю сессию
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        token  body      refreshRequest  true  "Refresh token"
+// @Success      200   {object}  service.TokenPair
+// @Failure      400   {object}  problemResponse  "Invalid JSON"
+// @Failure      401   {object}  problemResponse  "Invalid or expired refresh token"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Router       /auth/refresh [post]
+func (AH AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	pair, err := AH.Repo.Refresh(req.RefreshToken, r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, pair)
+}
+
+// Logout - хендлер для отзыва refresh-токена
+// @Summary      Выход
+// @Description  Отзывает refresh-токен вместе со всеми токенами, полученными из него обновлением
+// @Tags         auth
+// @Accept       json
+// @Param        token  body      refreshRequest  true  "Refresh token"
+// @Success      204   {string}  string  "No Content"
+// @Failure      400   {object}  problemResponse  "Invalid JSON"
+// @Failure      401   {object}  problemResponse  "Invalid refresh token"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Router       /auth/logout [post]
+func (AH AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := AH.Repo.Logout(req.RefreshToken, r.Context()); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
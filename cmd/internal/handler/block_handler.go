@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/policy"
+)
+
+// BlockUser - хендлер для блокировки пользователя
+// @Summary      Блокировка пользователя
+// @Description  Пользователь id блокирует пользователя target. Дружба и заявки между ними удаляются, новые заявки запрещены в обе стороны
+// @Tags         blocks
+// @Produce      plain
+// @Param        id		path	int	true	"User id - blocker"
+// @Param        target	path	int	true	"User id - blocked user"
+// @Success      204   {string}  string  "User blocked"
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      404   {object}  problemResponse  "One or both users don't exist"
+// @Failure      409   {object}  problemResponse  "User is already blocked"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Failure      403   {object}  problemResponse  "Action on another user's account"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id}/block/{target} [post]
+func (FH *FriendHandler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	user, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	target, err := pathID(r, "target")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := FH.Policy.Authorize(r.Context(), policy.ManageBlocks, user); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := FH.Repo.BlockUser(user, target, r.Context()); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnblockUser - хендлер для снятия блокировки
+// @Summary      Снятие блокировки
+// @Description  Пользователь id снимает блокировку с пользователя target. Дружба при этом не восстанавливается
+// @Tags         blocks
+// @Produce      plain
+// @Param        id		path	int	true	"User id - blocker"
+// @Param        target	path	int	true	"User id - blocked user"
+// @Success      204   {string}  string  "User unblocked"
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      404   {object}  problemResponse  "Block not found"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Failure      403   {object}  problemResponse  "Action on another user's account"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id}/unblock/{target} [delete]
+func (FH *FriendHandler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	user, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	target, err := pathID(r, "target")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := FH.Policy.Authorize(r.Context(), policy.ManageBlocks, user); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := FH.Repo.UnblockUser(user, target, r.Context()); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBlockedUsers - хендлер для получения списка заблокированных пользователем
+// @Summary      Список заблокированных пользователей
+// @Description  Возвращает блокировки, установленные пользователем, вместе с данными заблокированных
+// @Tags         blocks
+// @Produce      json
+// @Param        id		path	int	true	"User id"
+// @Success      200   {array}   model.Block
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      404   {object}  problemResponse  "User not found"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id}/blocked [get]
+func (FH *FriendHandler) GetBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	user, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	blocks, err := FH.Repo.GetBlockedUsers(user, r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if blocks == nil {
+		blocks = []model.Block{}
+	}
+	writeJSON(w, http.StatusOK, blocks)
+}
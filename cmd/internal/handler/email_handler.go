@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/policy"
+	"github.com/UnendingLoop/users-api/cmd/internal/service"
+)
+
+// EmailHandler handles HTTP-requests related to email verification and password reset.
+type EmailHandler struct {
+	Repo   service.EmailService
+	Policy policy.Policy
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type passwordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// SendVerificationEmail - хендлер для повторной отправки письма подтверждения
+// @Summary      Повторная отправка письма подтверждения
+// @Description  Отправляет новую ссылку подтверждения email. Прежние ссылки перестают действовать
+// @Tags         email
+// @Param        id   path      int  true  "User id"
+// @Success      202  {string}  string  "Accepted"
+// @Failure      400  {object}  problemResponse  "Invalid user id"
+// @Failure      403  {object}  problemResponse  "Action on another user's account"
+// @Failure      404  {object}  problemResponse  "User not found"
+// @Failure      409  {object}  problemResponse  "Email is already verified"
+// @Failure      500  {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id}/verify_email/send [post]
+func (EH EmailHandler) SendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := EH.Policy.Authorize(r.Context(), policy.ManageEmail, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := EH.Repo.RequestVerification(id, r.Context()); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// VerifyEmail - хендлер для подтверждения email по токену из письма
+// @Summary      Подтверждение email
+// @Description  Подтверждает email пользователя одноразовым токеном из письма. Авторизация не нужна - токен сам подтверждает владение адресом
+// @Tags         email
+// @Accept       json
+// @Param        id     path      int                 true  "User id"
+// @Param        token  body      verifyEmailRequest  true  "Token from the email"
+// @Success      204    {string}  string  "Email verified"
+// @Failure      400    {object}  problemResponse  "Invalid data"
+// @Failure      401    {object}  problemResponse  "Invalid, expired or already used token"
+// @Failure      500    {object}  problemResponse  "Internal server error"
+// @Router       /users/{id}/verify_email [post]
+func (EH EmailHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var req verifyEmailRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := EH.Repo.VerifyEmail(id, req.Token, r.Context()); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RequestPasswordReset - хендлер для запроса сброса пароля
+// @Summary      Запрос сброса пароля
+// @Description  Отправляет на email ссылку для сброса пароля. Ответ одинаковый для зарегистрированных и незарегистрированных адресов
+// @Tags         auth
+// @Accept       json
+// @Param        email  body      passwordResetRequest  true  "Account email"
+// @Success      202    {string}  string  "Accepted"
+// @Failure      400    {object}  problemResponse  "Invalid JSON or email"
+// @Failure      500    {object}  problemResponse  "Internal server error"
+// @Router       /auth/password_reset [post]
+func (EH EmailHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := EH.Repo.RequestPasswordReset(req.Email, r.Context()); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword - хендлер для установки нового пароля по токену из письма
+// @Summary      Сброс пароля
+// @Description  Задает новый пароль по одноразовому токену из письма и завершает все сессии пользователя
+// @Tags         auth
+// @Accept       json
+// @Param        reset  body      service.PasswordResetRequest  true  "Token and new password"
+// @Success      204    {string}  string  "Password changed"
+// @Failure      400    {object}  problemResponse  "Invalid JSON or weak password"
+// @Failure      401    {object}  problemResponse  "Invalid, expired or already used token"
+// @Failure      500    {object}  problemResponse  "Internal server error"
+// @Router       /auth/password_reset/confirm [post]
+func (EH EmailHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req service.PasswordResetRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := EH.Repo.ResetPassword(req, r.Context()); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
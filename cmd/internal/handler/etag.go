@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/service"
+)
+
+// userETag - сильный ETag пользователя: номер версии записи в кавычках
+func userETag(user *model.User) string {
+	return `"` + strconv.FormatInt(user.Version, 10) + `"`
+}
+
+// parseIfMatch разбирает If-Match в список версий пользователя. Без заголовка и для "*" условия нет.
+// If-Match сравнивает ETag строго, поэтому слабые (W/"...") и не выданные нами ETag пропускаются:
+// если подходящих не осталось, условие не выполнится ни для одной версии.
+func parseIfMatch(r *http.Request) service.IfMatch {
+	values := r.Header.Values("If-Match")
+	if len(values) == 0 {
+		return nil
+	}
+	versions := service.IfMatch{}
+	for _, tag := range etagList(values) {
+		if tag == "*" {
+			return nil
+		}
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		if version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+// ifNoneMatch сообщает, совпадает ли etag с одним из ETag в If-None-Match (сравнение слабое)
+func ifNoneMatch(r *http.Request, etag string) bool {
+	for _, tag := range etagList(r.Header.Values("If-None-Match")) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagList разбивает значения заголовков If-Match и If-None-Match на отдельные ETag
+func etagList(values []string) []string {
+	var tags []string
+	for _, v := range values {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
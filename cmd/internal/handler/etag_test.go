@@ -0,0 +1,94 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/app"
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	api := newTestAPI(t)
+	ann := api.register("Ann", "ann@example.com")
+	path := "/users/" + itoa(ann.User.ID)
+	get := func(headers map[string]string) *http.Response {
+		t.Helper()
+		return api.do(request{method: http.MethodGet, path: path, token: ann.AccessToken, headers: headers}).Result()
+	}
+
+	if res := get(nil); res.StatusCode != http.StatusOK || res.Header.Get("ETag") != `"1"` {
+		t.Fatalf("GET: status %d, ETag %q, want 200 and \"1\"", res.StatusCode, res.Header.Get("ETag"))
+	}
+	for _, tag := range []string{`"1"`, `W/"1"`, `"7", "1"`, `*`} {
+		if res := get(map[string]string{"If-None-Match": tag}); res.StatusCode != http.StatusNotModified {
+			t.Fatalf("GET with If-None-Match %s: status %d, want 304", tag, res.StatusCode)
+		}
+	}
+
+	update := func(ifMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		return api.do(request{method: http.MethodPut, path: "/update/" + itoa(ann.User.ID), token: ann.AccessToken,
+			body: `{"name":"Anna"}`, headers: map[string]string{"If-Match": ifMatch}})
+	}
+	wantProblem(t, update(`"2"`), http.StatusPreconditionFailed, "version_mismatch")
+	//слабый ETag не подходит для If-Match
+	wantProblem(t, update(`W/"1"`), http.StatusPreconditionFailed, "version_mismatch")
+	if rec := update(`"1"`); rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"2"` {
+		t.Fatalf("PUT with a current If-Match: status %d, ETag %q, want 200 and \"2\"", rec.Code, rec.Header().Get("ETag"))
+	}
+	if res := get(map[string]string{"If-None-Match": `"1"`}); res.StatusCode != http.StatusOK {
+		t.Fatalf("GET with a stale If-None-Match: status %d, want 200", res.StatusCode)
+	}
+
+	wantProblem(t, api.do(request{method: http.MethodDelete, path: "/delete/" + itoa(ann.User.ID), token: ann.AccessToken,
+		headers: map[string]string{"If-Match": `"1"`}}), http.StatusPreconditionFailed, "version_mismatch")
+	rec := api.do(request{method: http.MethodDelete, path: "/delete/" + itoa(ann.User.ID), token: ann.AccessToken,
+		headers: map[string]string{"If-Match": `"2"`}})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE with a current If-Match: status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	api := newTestAPI(t, func(cfg *app.Config) { cfg.RequireIfMatch = true })
+	ann := api.register("Ann", "ann@example.com")
+
+	rec := api.do(request{method: http.MethodPut, path: "/update/" + itoa(ann.User.ID), token: ann.AccessToken, body: `{"name":"Anna"}`})
+	wantProblem(t, rec, http.StatusPreconditionRequired, "precondition_required")
+	rec = api.do(request{method: http.MethodDelete, path: "/delete/" + itoa(ann.User.ID), token: ann.AccessToken})
+	wantProblem(t, rec, http.StatusPreconditionRequired, "precondition_required")
+	rec = api.do(request{method: http.MethodPut, path: "/update/" + itoa(ann.User.ID), token: ann.AccessToken,
+		body: `{"name":"Anna"}`, headers: map[string]string{"If-Match": "*"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT with If-Match *: status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCreateUserIgnoresServerFields(t *testing.T) {
+	api := newTestAPI(t)
+	ann := api.register("Ann", "ann@example.com")
+
+	rec := api.do(request{method: http.MethodPost, path: "/users", token: ann.AccessToken,
+		body: `{"id":` + itoa(ann.User.ID) + `,"version":77,"updated_at":"2000-01-01T00:00:00Z","two_factor_enabled":true,` +
+			`"name":"Cat","surname":"Fox","email":"cat@example.com"}`})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /users: status %d, body %s", rec.Code, rec.Body)
+	}
+	var created model.User
+	decodeBody(t, rec, &created)
+	if created.ID == ann.User.ID || created.Version != 1 || created.TOTPEnabled || created.UpdatedAt.Year() == 2000 {
+		t.Fatalf("POST /users must assign id, version and 2FA state itself, got %+v", created)
+	}
+	if etag := rec.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("ETag %q, want \"1\"", etag)
+	}
+
+	rec = api.do(request{method: http.MethodGet, path: "/users/" + itoa(ann.User.ID), token: ann.AccessToken})
+	var got model.User
+	decodeBody(t, rec, &got)
+	if got.Email != "ann@example.com" {
+		t.Fatalf("POST /users with a taken id changed the user: got %+v", got)
+	}
+}
@@ -1,133 +1,397 @@
 package handler
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
+	"context"
 	"net/http"
 	"strconv"
 
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/policy"
 	"github.com/UnendingLoop/users-api/cmd/internal/repository"
 	"github.com/UnendingLoop/users-api/cmd/internal/service"
-	"github.com/go-chi/chi/v5"
 )
 
 // FriendHandler handles HTTP requests related to user friendships.
 type FriendHandler struct {
-	Repo service.FriendServe
+	Repo   service.FriendshipService
+	Policy policy.Policy
 }
 
 // MakeFriend - хендлер для создания связи между 2мя существующими в базе пользователями
-// @Summary      Хендлер для создания новой связи - дружбы
-// @Description  Создаёт новую связь между 2мя существующими пользователями
+// @Summary      Хендлер для отправки заявки в друзья
+// @Description  Создаёт заявку в друзья от id1 к id2 в статусе pending. Если id2 уже отправил заявку id1, она принимается
 // @Tags         friendship
-// @Produce      plain
+// @Produce      json
 // @Param        id1	path	int	true	"User id 1 - friendship requester"
 // @Param        id2  	path	int	true	"User id 2 - friendship acceptor"
-// @Success      201   {string}  string  "Successfully added a new friend"
-// @Failure      400   {string}  string  "Invalid data"
-// @Failure      404   {string}  string  "One or both users don't exist"
-// @Failure      500   {string}  string  "Internal server error"
+// @Success      201   {object}  model.Friendship  "Friend request sent or accepted"
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      404   {object}  problemResponse  "One or both users don't exist"
+// @Failure      403   {object}  problemResponse  "One of the users has blocked the other, or id1 is not the caller"
+// @Failure      409   {object}  problemResponse  "Friendship or pending request already exists"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /users/{id1}/make_friend/{id2} [post]
 func (FH *FriendHandler) MakeFriend(w http.ResponseWriter, r *http.Request) {
-	requester, err := strconv.ParseInt(chi.URLParam(r, "id1"), 10, 64)
+	requester, err := pathID(r, "id1")
 	if err != nil {
-		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
-	acceptor, err := strconv.ParseInt(chi.URLParam(r, "id2"), 10, 64)
+	acceptor, err := pathID(r, "id2")
 	if err != nil {
-		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		writeError(w, r, err)
+		return
+	}
+	if err := FH.Policy.Authorize(r.Context(), policy.ManageFriends, requester); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	if err := FH.Repo.AddFriend(requester, acceptor, r.Context()); err != nil {
-		switch {
-		case errors.Is(err, repository.ErrUserNotFound):
-			http.Error(w, fmt.Sprintf("Failed to make friendship: %v", err), http.StatusNotFound)
-			return
-		default:
-			http.Error(w, fmt.Sprintf("Failed to make friendship: %v", err), http.StatusInternalServerError)
-			return
-		}
+	friendship, err := FH.Repo.AddFriend(requester, acceptor, r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, http.StatusCreated, friendship)
 }
 
 // RemoveFriend - хендлер для удаления связи между 2мя пользователями
 // @Summary      Удаление существующей связи - дружбы
-// @Description  Удаляет существующую связь между 2мя пользователями, id обоих берутся из URL
+// @Description  Удаляет существующую дружбу между 2мя пользователями, id обоих берутся из URL. Порядок id не важен
 // @Tags         friendship
 // @Produce      plain
-// @Param        id1	path	int	true	"User id 1 - friendship requester"
-// @Param        id2  	path	int	true	"User id 2 - friendship acceptor"
+// @Param        id1	path	int	true	"User id 1"
+// @Param        id2  	path	int	true	"User id 2"
 // @Success      204   {object}  model.User
-// @Failure      400   {string}  string  "Invalid data input"
-// @Failure      404   {string}  string  "One or both users don't exist"
-// @Failure      500   {string}  string  "Internal server error"
+// @Failure      400   {object}  problemResponse  "Invalid data input"
+// @Failure      404   {object}  problemResponse  "One or both users don't exist or they are not friends"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Failure      403   {object}  problemResponse  "Action on another user's account"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /users/{id1}/remove_friend/{id2} [delete]
 func (FH *FriendHandler) RemoveFriend(w http.ResponseWriter, r *http.Request) {
-	requester, err := strconv.ParseInt(chi.URLParam(r, "id1"), 10, 64)
+	requester, err := pathID(r, "id1")
 	if err != nil {
-		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
-	acceptor, err := strconv.ParseInt(chi.URLParam(r, "id2"), 10, 64)
+	acceptor, err := pathID(r, "id2")
 	if err != nil {
-		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		writeError(w, r, err)
+		return
+	}
+	//дружба симметрична, поэтому удалить ее может любая из сторон
+	if err := FH.Policy.Authorize(r.Context(), policy.ManageFriends, requester, acceptor); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
 	if err := FH.Repo.RemoveFriend(requester, acceptor, r.Context()); err != nil {
-		switch {
-		case errors.Is(err, repository.ErrUserNotFound):
-			http.Error(w, fmt.Sprintf("Failed to remove friend: %v", err), http.StatusNotFound)
-			return
-		case errors.Is(err, repository.ErrUserEqualsFriend):
-			http.Error(w, fmt.Sprintf("Failed to remove friend: %v", err), http.StatusBadRequest)
-			return
-		default:
-			http.Error(w, fmt.Sprintf("Failed to remove friend: %v", err), http.StatusInternalServerError)
-			return
-		}
+		writeError(w, r, err)
+		return
 	}
-
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // GetFriendsList - хендлер для получения списка друзей пользователя
 // @Summary      Получение списка друзей пользователя
-// @Description  Возвращает массив JSON из пользователей, которые состоят в связи с указанным в запросе пользователем
+// @Description  Возвращает массив JSON из пользователей, которые состоят в дружбе с указанным в запросе пользователем, независимо от того, кто отправлял заявку
 // @Tags         friendship
 // @Produce      json
-// @Param        id		path	int	true	"User id - friendship requester"
+// @Param        id		path	int	true	"User id"
 // @Success      200   {array}  model.User  "Successful load of friends list"
-// @Failure      400   {string}  string  "Invalid data"
-// @Failure      404   {string}  string  "User not found"
-// @Failure      500   {string}  string  "Internal server error"
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      404   {object}  problemResponse  "User not found"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /users/{id}/friends [get]
 func (FH *FriendHandler) GetFriendsList(w http.ResponseWriter, r *http.Request) {
-	requester, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	requester, err := pathID(r, "id")
 	if err != nil {
-		http.Error(w, "Failed to parse user id", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 	friends, err := FH.Repo.GetFriends(requester, r.Context())
 	if err != nil {
-		switch {
-		case errors.Is(err, repository.ErrUserNotFound):
-			http.Error(w, fmt.Sprintf("Failed to get list of friends: %v", err), http.StatusNotFound)
-			return
-		default:
-			http.Error(w, fmt.Sprintf("Failed to get list of friends: %v", err), http.StatusInternalServerError)
-			return
-		}
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, friends)
+}
+
+// AcceptFriend - хендлер для принятия заявки в друзья
+// @Summary      Принятие заявки в друзья
+// @Description  Пользователь id принимает ожидающую заявку от пользователя other
+// @Tags         friendship
+// @Produce      plain
+// @Param        id		path	int	true	"User id - friendship acceptor"
+// @Param        other	path	int	true	"User id - friendship requester"
+// @Success      204   {string}  string  "Friend request accepted"
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      404   {object}  problemResponse  "Pending friend request not found"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Failure      403   {object}  problemResponse  "Action on another user's account"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id}/friend_requests/{other}/accept [post]
+func (FH *FriendHandler) AcceptFriend(w http.ResponseWriter, r *http.Request) {
+	FH.resolveRequest(w, r, FH.Repo.AcceptFriend)
+}
+
+// DeclineFriend - хендлер для отклонения заявки в друзья
+// @Summary      Отклонение заявки в друзья
+// @Description  Пользователь id отклоняет ожидающую заявку от пользователя other
+// @Tags         friendship
+// @Produce      plain
+// @Param        id		path	int	true	"User id - friendship acceptor"
+// @Param        other	path	int	true	"User id - friendship requester"
+// @Success      204   {string}  string  "Friend request declined"
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      404   {object}  problemResponse  "Pending friend request not found"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Failure      403   {object}  problemResponse  "Action on another user's account"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id}/friend_requests/{other}/decline [post]
+func (FH *FriendHandler) DeclineFriend(w http.ResponseWriter, r *http.Request) {
+	FH.resolveRequest(w, r, FH.Repo.DeclineFriend)
+}
+
+// CancelFriendRequest - хендлер для отмены отправленной заявки в друзья
+// @Summary      Отмена заявки в друзья
+// @Description  Пользователь id отзывает свою ожидающую заявку к пользователю other
+// @Tags         friendship
+// @Produce      plain
+// @Param        id		path	int	true	"User id - friendship requester"
+// @Param        other	path	int	true	"User id - friendship acceptor"
+// @Success      204   {string}  string  "Friend request cancelled"
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      404   {object}  problemResponse  "Pending friend request not found"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Failure      403   {object}  problemResponse  "Action on another user's account"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id}/friend_requests/{other}/cancel [post]
+func (FH *FriendHandler) CancelFriendRequest(w http.ResponseWriter, r *http.Request) {
+	FH.resolveRequest(w, r, FH.Repo.CancelFriendRequest)
+}
+
+// resolveRequest - общая часть хендлеров, меняющих статус ожидающей заявки
+func (FH *FriendHandler) resolveRequest(w http.ResponseWriter, r *http.Request, resolve func(user, other int64, ctx context.Context) error) {
+	user, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	other, err := pathID(r, "other")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := FH.Policy.Authorize(r.Context(), policy.ManageFriends, user); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if err := resolve(user, other, r.Context()); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetIncomingRequests - хендлер для получения входящих заявок в друзья
+// @Summary      Входящие заявки в друзья
+// @Description  Возвращает ожидающие заявки, отправленные пользователю, вместе с данными отправителей
+// @Tags         friendship
+// @Produce      json
+// @Param        id		path	int	true	"User id"
+// @Success      200   {array}   model.Friendship
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      404   {object}  problemResponse  "User not found"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id}/friend_requests/incoming [get]
+func (FH *FriendHandler) GetIncomingRequests(w http.ResponseWriter, r *http.Request) {
+	FH.listRequests(w, r, FH.Repo.GetIncomingRequests)
+}
+
+// GetOutgoingRequests - хендлер для получения исходящих заявок в друзья
+// @Summary      Исходящие заявки в друзья
+// @Description  Возвращает ожидающие заявки, отправленные пользователем, вместе с данными получателей
+// @Tags         friendship
+// @Produce      json
+// @Param        id		path	int	true	"User id"
+// @Success      200   {array}   model.Friendship
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      404   {object}  problemResponse  "User not found"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id}/friend_requests/outgoing [get]
+func (FH *FriendHandler) GetOutgoingRequests(w http.ResponseWriter, r *http.Request) {
+	FH.listRequests(w, r, FH.Repo.GetOutgoingRequests)
+}
+
+func (FH *FriendHandler) listRequests(w http.ResponseWriter, r *http.Request, list func(user int64, ctx context.Context) ([]model.Friendship, error)) {
+	user, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	requests, err := list(user, r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if requests == nil {
+		requests = []model.Friendship{}
+	}
+	writeJSON(w, http.StatusOK, requests)
+}
+
+// GetMutualFriends - хендлер для получения общих друзей двух пользователей
+// @Summary      Общие друзья двух пользователей
+// @Description  Возвращает страницу пользователей, которые дружат и с id1, и с id2, а также общее количество таких друзей
+// @Tags         friendship
+// @Produce      json
+// @Param        id1		path	int	true	"User id 1"
+// @Param        id2		path	int	true	"User id 2"
+// @Param        limit		query	int	false	"Размер страницы (1-100, по умолчанию 20)"
+// @Param        offset		query	int	false	"Смещение от начала списка"
+// @Success      200   {object}  service.MutualFriends
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      404   {object}  problemResponse  "One or both users don't exist"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id1}/mutual_friends/{id2} [get]
+func (FH *FriendHandler) GetMutualFriends(w http.ResponseWriter, r *http.Request) {
+	user, err := pathID(r, "id1")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	other, err := pathID(r, "id2")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	mutual, err := FH.Repo.GetMutualFriends(user, other, limit, offset, r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, mutual)
+}
+
+// GetSuggestions - хендлер для получения рекомендаций друзей
+// @Summary      Рекомендации друзей
+// @Description  Возвращает друзей друзей пользователя, которые еще не являются его друзьями, не состоят с ним в ожидающей заявке и не связаны с ним блокировкой. Упорядочены по убыванию количества общих друзей
+// @Tags         friendship
+// @Produce      json
+// @Param        id			path	int	true	"User id"
+// @Param        limit		query	int	false	"Размер страницы (1-100, по умолчанию 20)"
+// @Param        offset		query	int	false	"Смещение от начала списка"
+// @Success      200   {array}   repository.FriendSuggestion
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      404   {object}  problemResponse  "User not found"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id}/suggestions [get]
+func (FH *FriendHandler) GetSuggestions(w http.ResponseWriter, r *http.Request) {
+	user, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	limit, offset, err := parseLimitOffset(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	suggestions, err := FH.Repo.GetSuggestions(user, limit, offset, r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, suggestions)
+}
+
+// FindPath - хендлер для поиска кратчайшей цепочки дружб между двумя пользователями
+// @Summary      Степени разделения между пользователями
+// @Description  Возвращает кратчайшую цепочку пользователей от id1 до id2, в которой каждый соседний дружит с предыдущим
+// @Tags         friendship
+// @Produce      json
+// @Param        id1		path	int	true	"User id 1 - начало пути"
+// @Param        id2		path	int	true	"User id 2 - конец пути"
+// @Param        max_depth	query	int	false	"Максимальная длина пути (по умолчанию и не более 6)"
+// @Success      200   {object}  service.FriendPath
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      404   {object}  problemResponse  "User not found or no path within depth limit"
+// @Failure      422   {object}  problemResponse  "Search exceeded visit budget"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id1}/path/{id2} [get]
+func (FH *FriendHandler) FindPath(w http.ResponseWriter, r *http.Request) {
+	user, err := pathID(r, "id1")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	target, err := pathID(r, "id2")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	maxDepth, err := queryInt(r, "max_depth")
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(friends); err != nil {
-		http.Error(w, "Failed to encode users", http.StatusInternalServerError)
+	path, err := FH.Repo.FindPath(user, target, maxDepth, r.Context())
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	writeJSON(w, http.StatusOK, path)
+}
+
+// parseLimitOffset - разбор параметров limit и offset из query-строки, отсутствующие параметры равны 0
+func parseLimitOffset(r *http.Request) (limit, offset int, err error) {
+	if limit, err = queryInt(r, "limit"); err != nil {
+		return 0, 0, err
+	}
+	if offset, err = queryInt(r, "offset"); err != nil {
+		return 0, 0, err
+	}
+	return limit, offset, nil
+}
+
+// queryInt - разбор целочисленного параметра name из query-строки, отсутствующий параметр равен 0
+func queryInt(r *http.Request, name string) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, &repository.FieldError{Field: name, Message: "must be an integer"}
+	}
+	return n, nil
 }
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/policy"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"github.com/UnendingLoop/users-api/cmd/internal/service"
+)
+
+// Authenticate - chi-middleware, которая принимает либо access-токен пользователя
+// "Authorization: Bearer <token>", либо ключ сервиса "Authorization: ApiKey <key>".
+// Id пользователя кладется в контекст (см. auth.UserID), данные ключа - через auth.WithAPIKey.
+// Токены и ключи удаленных пользователей не принимаются.
+func Authenticate(tokens service.AuthService, keys service.APIKeyService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if key, ok := strings.CutPrefix(header, "ApiKey "); ok && key != "" {
+				principal, err := keys.Authenticate(key, r.Context())
+				if err != nil {
+					if errors.Is(err, repository.ErrInvalidAPIKey) {
+						w.Header().Set("WWW-Authenticate", `ApiKey realm="users-api"`)
+					}
+					writeError(w, r, err)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(auth.WithAPIKey(r.Context(), *principal)))
+				return
+			}
+
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || token == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="users-api"`)
+				writeError(w, r, errAuthorizationNeeded)
+				return
+			}
+			userID, err := tokens.Authenticate(token, r.Context())
+			if err != nil {
+				if errors.Is(err, repository.ErrInvalidToken) {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="users-api", error="invalid_token"`)
+				}
+				writeError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithUserID(r.Context(), userID)))
+		})
+	}
+}
+
+// RequireScope - chi-middleware, которая пропускает запросы с API-ключом только при наличии области scope.
+// Запросы пользователей не ограничиваются: их права определяет политика владения.
+func RequireScope(scope auth.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := policy.RequireScope(r.Context(), scope); err != nil {
+				writeError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
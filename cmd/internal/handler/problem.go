@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/mail"
+	"github.com/UnendingLoop/users-api/cmd/internal/policy"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// problemContentType - тип ответа об ошибке по RFC 7807
+const problemContentType = "application/problem+json"
+
+// Ошибки разбора запроса, которые возникают в самих хендлерах
+var (
+	errInvalidJSON          = errors.New("request body is not valid JSON")
+	errAuthorizationNeeded  = errors.New("authorization required")
+	errPreconditionRequired = errors.New("If-Match header is required")
+	errUnsupportedMediaType = errors.New("unsupported request content type")
+)
+
+// problemResponse - тело ответа об ошибке в формате RFC 7807 (application/problem+json).
+// Code - стабильный машиночитаемый код ошибки, Errors - ошибки в отдельных полях запроса.
+// При отказе политики доступа (403) добавляются поля отказа: action, reason, caller_id и т.д.
+type problemResponse struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Code     string         `json:"code"`
+	Detail   string         `json:"detail,omitempty"`
+	Instance string         `json:"instance,omitempty"`
+	Errors   []fieldProblem `json:"errors,omitempty"`
+	*policy.Denial
+}
+
+// fieldProblem - ошибка в одном поле запроса
+type fieldProblem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// errorMapping связывает sentinel-ошибку со статусом ответа и кодом ошибки
+type errorMapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// errorMappings - единая таблица соответствия ошибок и ответов. Коды получены из имен ошибок
+// (ErrEmailExists -> email_exists) и не должны меняться: по ним клиенты разбирают ответы.
+// Выигрывает первая совпавшая ошибка, поэтому более конкретные стоят выше.
+var errorMappings = []errorMapping{
+	// 400
+	{errInvalidJSON, http.StatusBadRequest, "invalid_json"},
+	{repository.ErrEmptySomeFields, http.StatusBadRequest, "empty_some_fields"},
+	{repository.ErrEmptyFields, http.StatusBadRequest, "empty_fields"},
+	{repository.ErrWeakPassword, http.StatusBadRequest, "weak_password"},
+	{repository.ErrInvalidRole, http.StatusBadRequest, "invalid_role"},
+	{mail.ErrInvalidAddress, http.StatusBadRequest, "invalid_email"},
+	{repository.ErrInvalidScope, http.StatusBadRequest, "invalid_scope"},
+	{repository.ErrInvalidExpiry, http.StatusBadRequest, "invalid_expiry"},
+	{repository.ErrInvalidPagination, http.StatusBadRequest, "invalid_pagination"},
+	{repository.ErrInvalidCursor, http.StatusBadRequest, "invalid_cursor"},
+	{repository.ErrInvalidSort, http.StatusBadRequest, "invalid_sort"},
+	{repository.ErrInvalidFilter, http.StatusBadRequest, "invalid_filter"},
+	{repository.ErrInvalidDepth, http.StatusBadRequest, "invalid_depth"},
+	{repository.ErrEmptySearchQuery, http.StatusBadRequest, "empty_search_query"},
+	{repository.ErrUserEqualsFriend, http.StatusBadRequest, "user_equals_friend"},
+	{repository.ErrSelfBlock, http.StatusBadRequest, "self_block"},
+	{repository.ErrInvalidPatch, http.StatusBadRequest, "invalid_patch"},
+	{repository.ErrInvalidField, http.StatusBadRequest, "invalid_field"},
+	// 401
+	{errAuthorizationNeeded, http.StatusUnauthorized, "authorization_required"},
+	{repository.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials"},
+	{repository.ErrInvalidToken, http.StatusUnauthorized, "invalid_token"},
+	{repository.ErrInvalidAPIKey, http.StatusUnauthorized, "invalid_api_key"},
+	{repository.ErrOTPRequired, http.StatusUnauthorized, "otp_required"},
+	{repository.ErrInvalidOTP, http.StatusUnauthorized, "invalid_otp"},
+	// 403
+	{policy.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{repository.ErrUserBlocked, http.StatusForbidden, "user_blocked"},
+	// 404
+	{repository.ErrUserNotFound, http.StatusNotFound, "user_not_found"},
+	{repository.ErrFriendshipNotFound, http.StatusNotFound, "friendship_not_found"},
+	{repository.ErrFriendRequestNotFound, http.StatusNotFound, "friend_request_not_found"},
+	{repository.ErrPathNotFound, http.StatusNotFound, "path_not_found"},
+	{repository.ErrBlockNotFound, http.StatusNotFound, "block_not_found"},
+	{repository.ErrAPIKeyNotFound, http.StatusNotFound, "api_key_not_found"},
+	// 409
+	{repository.ErrUserExists, http.StatusConflict, "user_exists"},
+	{repository.ErrEmailExists, http.StatusConflict, "email_exists"},
+	{repository.ErrUserNotDeleted, http.StatusConflict, "user_not_deleted"},
+	{repository.ErrEmailAlreadyVerified, http.StatusConflict, "email_already_verified"},
+	{repository.ErrFriendshipExists, http.StatusConflict, "friendship_exists"},
+	{repository.ErrBlockExists, http.StatusConflict, "block_exists"},
+	{repository.ErrTOTPAlreadyEnabled, http.StatusConflict, "totp_already_enabled"},
+	{repository.ErrTOTPNotEnrolled, http.StatusConflict, "totp_not_enrolled"},
+	{repository.ErrPatchTestFailed, http.StatusConflict, "patch_test_failed"},
+	// 412, 415, 422, 428, 501
+	{repository.ErrVersionMismatch, http.StatusPreconditionFailed, "version_mismatch"},
+	{errUnsupportedMediaType, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+	{repository.ErrPathSearchLimit, http.StatusUnprocessableEntity, "path_search_limit"},
+	{repository.ErrPatchNotApplicable, http.StatusUnprocessableEntity, "patch_not_applicable"},
+	{errPreconditionRequired, http.StatusPreconditionRequired, "precondition_required"},
+	{repository.ErrSearchUnavailable, http.StatusNotImplemented, "search_unavailable"},
+}
+
+// writeError пишет ответ application/problem+json для err. Неизвестные ошибки отдаются как 500
+// без подробностей и пишутся в лог.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	problem := problemResponse{
+		Type:     "about:blank",
+		Status:   http.StatusInternalServerError,
+		Code:     "internal_error",
+		Detail:   "internal server error",
+		Instance: r.URL.Path,
+		Errors:   fieldProblems(err),
+	}
+	for _, m := range errorMappings {
+		if errors.Is(err, m.err) {
+			problem.Status, problem.Code, problem.Detail = m.status, m.code, err.Error()
+			//ошибки полей перечислены в errors, в detail достаточно общей причины
+			if len(problem.Errors) > 0 {
+				problem.Detail = m.err.Error()
+			}
+			break
+		}
+	}
+	if problem.Status == http.StatusInternalServerError {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+	problem.Title = http.StatusText(problem.Status)
+	errors.As(err, &problem.Denial)
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		log.Printf("Failed to encode problem response: %v", err)
+	}
+}
+
+// fieldProblems собирает все FieldError из дерева ошибок, включая объединенные через errors.Join
+func fieldProblems(err error) []fieldProblem {
+	var problems []fieldProblem
+	var walk func(error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case *repository.FieldError:
+			problems = append(problems, fieldProblem{Field: e.Field, Message: e.Message})
+		case interface{ Unwrap() []error }:
+			for _, inner := range e.Unwrap() {
+				walk(inner)
+			}
+		case interface{ Unwrap() error }:
+			walk(e.Unwrap())
+		}
+	}
+	walk(err)
+	return problems
+}
+
+// decodeJSON разбирает тело запроса в v
+func decodeJSON(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidJSON, err)
+	}
+	return nil
+}
+
+// pathID достает целочисленный id из параметра пути name
+func pathID(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil {
+		return 0, &repository.FieldError{Field: name, Message: "must be an integer"}
+	}
+	return id, nil
+}
+
+// writeJSON пишет статус и тело ответа в JSON
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/app"
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/mail"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"github.com/UnendingLoop/users-api/cmd/internal/service"
+)
+
+// testAPI - сервис целиком поверх хранилища в памяти, запросы идут прямо в маршрутизатор
+type testAPI struct {
+	t      *testing.T
+	routes http.Handler
+}
+
+// newTestAPI собирает сервис через app.New; configure может поменять настройки до сборки
+func newTestAPI(t *testing.T, configure ...func(*app.Config)) *testAPI {
+	t.Helper()
+	signer, err := auth.NewHS256Signer([]byte("0123456789abcdef0123456789abcdef"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actionSigner, err := auth.NewActionSigner([]byte("fedcba9876543210fedcba9876543210"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := app.Config{Signer: signer, ActionSigner: actionSigner, Mailer: &mail.MemoryMailer{}}
+	for _, c := range configure {
+		c(&cfg)
+	}
+	a := app.New(repository.NewMemoryStorage(repository.NewMemoryStore()), cfg)
+	return &testAPI{t: t, routes: a.Routes()}
+}
+
+// request - запрос к API. Пустой token - запрос без авторизации.
+type request struct {
+	method  string
+	path    string
+	token   string
+	body    string
+	headers map[string]string
+}
+
+// do выполняет запрос и возвращает записанный ответ
+func (api *testAPI) do(req request) *httptest.ResponseRecorder {
+	api.t.Helper()
+	r := httptest.NewRequest(req.method, req.path, strings.NewReader(req.body))
+	if req.body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if req.token != "" {
+		r.Header.Set("Authorization", "Bearer "+req.token)
+	}
+	for name, value := range req.headers {
+		r.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	api.routes.ServeHTTP(rec, r)
+	return rec
+}
+
+// register регистрирует пользователя и возвращает его вместе с access-токеном
+func (api *testAPI) register(name, email string) service.AuthResult {
+	api.t.Helper()
+	rec := api.do(request{method: http.MethodPost, path: "/auth/register",
+		body: `{"name":"` + name + `","surname":"Test","email":"` + email + `","password":"Secret123!pass"}`})
+	if rec.Code != http.StatusCreated {
+		api.t.Fatalf("register %s: status %d, body %s", email, rec.Code, rec.Body)
+	}
+	var res service.AuthResult
+	decodeBody(api.t, rec, &res)
+	return res
+}
+
+// decodeBody разбирает JSON-тело ответа в v
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body, err)
+	}
+}
+
+// itoa - id пользователя в пути запроса
+func itoa(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// problem - поля ответа application/problem+json, которые проверяют тесты
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Code     string `json:"code"`
+	Instance string `json:"instance"`
+	Errors   []struct {
+		Field string `json:"field"`
+	} `json:"errors"`
+	Action string `json:"action"`
+}
+
+// wantProblem проверяет статус, тип содержимого и код ошибки ответа и возвращает тело
+func wantProblem(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) problem {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status %d, want %d, body %s", rec.Code, status, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("Content-Type %q, want application/problem+json", ct)
+	}
+	var p problem
+	decodeBody(t, rec, &p)
+	if p.Status != status || p.Code != code || p.Title != http.StatusText(status) || p.Type != "about:blank" {
+		t.Fatalf("problem %+v, want status %d and code %s", p, status, code)
+	}
+	return p
+}
+
+func TestProblemResponses(t *testing.T) {
+	api := newTestAPI(t)
+	ann := api.register("Ann", "ann@example.com")
+	bob := api.register("Bob", "bob@example.com")
+
+	t.Run("invalid json", func(t *testing.T) {
+		rec := api.do(request{method: http.MethodPost, path: "/users", token: ann.AccessToken, body: `{"name":`})
+		p := wantProblem(t, rec, http.StatusBadRequest, "invalid_json")
+		if p.Instance != "/users" {
+			t.Fatalf("instance %q, want /users", p.Instance)
+		}
+	})
+	t.Run("field errors", func(t *testing.T) {
+		rec := api.do(request{method: http.MethodPost, path: "/users", token: ann.AccessToken, body: `{"email":"c@example.com"}`})
+		p := wantProblem(t, rec, http.StatusBadRequest, "empty_some_fields")
+		var fields []string
+		for _, e := range p.Errors {
+			fields = append(fields, e.Field)
+		}
+		if strings.Join(fields, ",") != "name,surname" {
+			t.Fatalf("errors for fields %v, want name and surname", fields)
+		}
+	})
+	t.Run("email exists", func(t *testing.T) {
+		rec := api.do(request{method: http.MethodPost, path: "/users", token: ann.AccessToken,
+			body: `{"name":"Ann","surname":"Copy","email":"ANN@example.com"}`})
+		wantProblem(t, rec, http.StatusConflict, "email_exists")
+	})
+	t.Run("not found", func(t *testing.T) {
+		rec := api.do(request{method: http.MethodGet, path: "/users/999", token: ann.AccessToken})
+		wantProblem(t, rec, http.StatusNotFound, "user_not_found")
+	})
+	t.Run("authorization required", func(t *testing.T) {
+		rec := api.do(request{method: http.MethodGet, path: "/users"})
+		wantProblem(t, rec, http.StatusUnauthorized, "authorization_required")
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Fatal("401 must carry WWW-Authenticate")
+		}
+	})
+	t.Run("forbidden", func(t *testing.T) {
+		rec := api.do(request{method: http.MethodDelete, path: "/delete/" + itoa(bob.User.ID), token: ann.AccessToken})
+		p := wantProblem(t, rec, http.StatusForbidden, "forbidden")
+		if p.Action != "user.delete" {
+			t.Fatalf("denied action %q, want user.delete", p.Action)
+		}
+	})
+	t.Run("token of a deleted user", func(t *testing.T) {
+		rec := api.do(request{method: http.MethodDelete, path: "/delete/" + itoa(bob.User.ID), token: bob.AccessToken})
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("delete own account: status %d, body %s", rec.Code, rec.Body)
+		}
+		rec = api.do(request{method: http.MethodGet, path: "/users", token: bob.AccessToken})
+		wantProblem(t, rec, http.StatusUnauthorized, "invalid_token")
+	})
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/policy"
+	"github.com/UnendingLoop/users-api/cmd/internal/service"
+)
+
+// TwoFactorHandler handles HTTP-requests related to TOTP two-factor authentication.
+// Only the account owner can manage its second factor.
+type TwoFactorHandler struct {
+	Repo   service.TwoFactorService
+	Policy policy.Policy
+}
+
+type verifyTOTPRequest struct {
+	Code string `json:"otp_code"`
+}
+
+// SetupTOTP - хендлер для начала настройки 2FA
+// @Summary      Настройка 2FA
+// @Description  Выпускает новый TOTP-секрет и otpauth-URI для приложения-аутентификатора. 2FA включится после подтверждения кодом
+// @Tags         two_factor
+// @Produce      json
+// @Param        id   path      int  true  "User id"
+// @Success      200  {object}  service.TOTPSetup
+// @Failure      400  {object}  problemResponse  "Invalid user id"
+// @Failure      403  {object}  problemResponse  "Only the account owner can set up 2FA"
+// @Failure      404  {object}  problemResponse  "User not found"
+// @Failure      409  {object}  problemResponse  "Two-factor authentication is already enabled"
+// @Failure      500  {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /users/{id}/2fa/setup [post]
+func (TH TwoFactorHandler) SetupTOTP(w http.ResponseWriter, r *http.Request) {
+	id, ok := TH.authorizeOwner(w, r)
+	if !ok {
+		return
+	}
+	setup, err := TH.Repo.SetupTOTP(id, r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, setup)
+}
+
+// EnableTOTP - хендлер для подтверждения настройки 2FA
+// @Summary      Подтверждение 2FA
+// @Description  Включает 2FA по первому коду из приложения и возвращает одноразовые коды восстановления. Коды показываются только один раз
+// @Tags         two_factor
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int                true  "User id"
+// @Param        code  body      verifyTOTPRequest  true  "Code from authenticator app"
+// @Success      200   {object}  service.RecoveryCodes
+// @Failure      400   {object}  problemResponse  "Invalid data"
+// @Failure      401   {object}  problemResponse  "Invalid code"
+// @Failure      403   {object}  problemResponse  "Only the account owner can enable 2FA"
+// @Failure      404   {object}  problemResponse  "User not found"
+// @Failure      409   {object}  problemResponse  "Two-factor authentication is already enabled or not set up"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /users/{id}/2fa/verify [post]
+func (TH TwoFactorHandler) EnableTOTP(w http.ResponseWriter, r *http.Request) {
+	id, ok := TH.authorizeOwner(w, r)
+	if !ok {
+		return
+	}
+	var req verifyTOTPRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	codes, err := TH.Repo.EnableTOTP(id, req.Code, r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, codes)
+}
+
+// DisableTOTP - хендлер для отключения 2FA
+// @Summary      Отключение 2FA
+// @Description  Отключает 2FA и удаляет коды восстановления. Требует действующий код из приложения или код восстановления
+// @Tags         two_factor
+// @Accept       json
+// @Param        id      path      int                   true  "User id"
+// @Param        factor  body      service.SecondFactor  true  "otp_code or recovery_code"
+// @Success      204     {string}  string  "No Content"
+// @Failure      400     {object}  problemResponse  "Invalid data"
+// @Failure      401     {object}  problemResponse  "Code required or invalid"
+// @Failure      403     {object}  problemResponse  "Only the account owner can disable 2FA"
+// @Failure      404     {object}  problemResponse  "User not found"
+// @Failure      409     {object}  problemResponse  "Two-factor authentication is not set up"
+// @Failure      500     {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Router       /users/{id}/2fa/disable [post]
+func (TH TwoFactorHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	id, ok := TH.authorizeOwner(w, r)
+	if !ok {
+		return
+	}
+	var factor service.SecondFactor
+	if err := decodeJSON(r, &factor); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := TH.Repo.DisableTOTP(id, factor, r.Context()); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeOwner достает id из URL и проверяет, что вызывающий - сам владелец аккаунта
+func (TH TwoFactorHandler) authorizeOwner(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return 0, false
+	}
+	if err := TH.Policy.RequireSelf(r.Context(), policy.ManageTOTP, id); err != nil {
+		writeError(w, r, err)
+		return 0, false
+	}
+	return id, true
+}
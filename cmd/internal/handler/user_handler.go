@@ -1,21 +1,33 @@
 package handler
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
 
 	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/policy"
 	"github.com/UnendingLoop/users-api/cmd/internal/repository"
 	"github.com/UnendingLoop/users-api/cmd/internal/service"
-	"github.com/go-chi/chi/v5"
 )
 
 // UserHandler handles HTTP-requests related to user management.
 type UserHandler struct {
-	Repo service.UserServe
+	Repo   service.UserService
+	Policy policy.Policy
+	// RequireIfMatch - отклонять изменение и удаление без заголовка If-Match (428)
+	RequireIfMatch bool
+}
+
+// createUserRequest - поля, которые клиент задает при создании пользователя. Остальное (id, версия,
+// 2FA, дружбы) назначает сервер, поэтому тело не разбирается прямо в model.User.
+type createUserRequest struct {
+	Name    string     `json:"name"`
+	Surname string     `json:"surname"`
+	Email   string     `json:"email"`
+	Role    model.Role `json:"role"`
 }
 
 // CreateUser - хендлер для создания нового пользователя в базе
@@ -24,168 +36,364 @@ type UserHandler struct {
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param        user  body      model.User  true  "User info"
+// @Param        user  body      createUserRequest  true  "User info"
 // @Success      201   {object}  model.User
-// @Failure      400   {string}  string  "Incomplete data input"
-// @Failure      500   {string}  string  "Internal server error"
-// @Failure      409   {string}  string  "Email conflict: already in use"
+// @Header       201   {string}  ETag  "Версия созданного пользователя"
+// @Failure      400   {object}  problemResponse  "Invalid JSON, empty fields, invalid email or role"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Failure      403   {object}  problemResponse  "Only admins can assign roles"
+// @Failure      409   {object}  problemResponse  "Email conflict: already in use"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /users [post]
 func (UH UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var newUser model.User
-
-	if err := json.NewDecoder(r.Body).Decode(&newUser); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	var req createUserRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, err)
 		return
 	}
-
-	if err := UH.Repo.CreateUser(&newUser, r.Context()); err != nil {
-		switch {
-		case errors.Is(err, repository.ErrEmptySomeFields):
-			http.Error(w, fmt.Sprintf("Validation error: %v", err), http.StatusBadRequest)
-			return
-		case errors.Is(err, repository.ErrUserExists):
-			http.Error(w, fmt.Sprintf("Conflict: %v", err), http.StatusConflict)
-			return
-		default:
-			http.Error(w, fmt.Sprintf("Internal error: %v", err), http.StatusInternalServerError)
+	newUser := model.User{Name: req.Name, Surname: req.Surname, Email: req.Email, Role: req.Role}
+	//назначать роль, отличную от обычной, может только администратор
+	if newUser.Role != "" && newUser.Role != model.RoleUser {
+		if err := UH.Policy.RequireAdmin(r.Context(), policy.AssignRole); err != nil {
+			writeError(w, r, err)
 			return
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(newUser); err != nil {
-		http.Error(w, "Failed do encode user", http.StatusInternalServerError)
+	if err := UH.Repo.CreateUser(&newUser, r.Context()); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("ETag", userETag(&newUser))
+	writeJSON(w, http.StatusCreated, newUser)
 }
 
-// ListUsers - хендлер для получения списка всех юзеров из базы
-// @Summary      Хендлер для получения списка всех юзеров из базы
-// @Description  Отдает массив из всех пользователей базы
+// ListUsers - хендлер для получения страницы юзеров из базы
+// @Summary      Хендлер для получения списка юзеров из базы с пагинацией, фильтрацией и сортировкой
+// @Description  Отдает страницу пользователей. По умолчанию упорядочены по id. Поддерживается offset-пагинация и непрозрачный курсор из next_cursor
 // @Tags         users
 // @Produce      json
-// @Success      200   {array}  model.User
-// @Failure      500   {string}  string  "Internal server error"
+// @Param        name          query     string  false  "Фильтр по имени (без учета регистра)"
+// @Param        surname       query     string  false  "Фильтр по фамилии (без учета регистра)"
+// @Param        email_domain  query     string  false  "Фильтр по домену email, например example.com"
+// @Param        q             query     string  false  "Поиск подстроки в имени, фамилии и email"
+// @Param        sort          query     string  false  "Сортировка: поля id, name, surname, email через запятую, '-' - по убыванию"
+// @Param        limit   query     int     false  "Размер страницы (1-100, по умолчанию 20)"
+// @Param        offset  query     int     false  "Смещение от начала списка"
+// @Param        cursor  query     string  false  "Курсор следующей страницы (next_cursor из предыдущего ответа)"
+// @Param        total   query     bool    false  "Вернуть общее количество пользователей"
+// @Success      200   {object}  service.UserPage
+// @Failure      400   {object}  problemResponse  "Invalid pagination, sort or filter parameters"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /users [get]
 func (UH UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := UH.Repo.ListUsers(r.Context())
+	params, err := parseListUsersParams(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	page, err := UH.Repo.ListUsers(params, r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// SearchUsers - хендлер полнотекстового поиска пользователей
+// @Summary      Полнотекстовый поиск пользователей
+// @Description  Ищет пользователей по имени, фамилии и email с учетом опечаток и транслитерации (кириллица/латиница), результаты упорядочены по релевантности
+// @Tags         users
+// @Produce      json
+// @Param        q      query     string  true   "Поисковый запрос"
+// @Param        limit  query     int     false  "Максимальное количество результатов (1-100, по умолчанию 20)"
+// @Success      200   {array}   repository.UserSearchHit
+// @Failure      400   {object}  problemResponse  "Empty query or invalid limit"
+// @Failure      500   {object}  problemResponse  "Internal server error"
+// @Failure      501   {object}  problemResponse  "Search is not supported by the database"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/search [get]
+func (UH UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	hits, err := UH.Repo.SearchUsers(r.URL.Query().Get("q"), limit, r.Context())
 	if err != nil {
-		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(users); err != nil {
-		http.Error(w, "Failed to encode users", http.StatusInternalServerError)
+	writeJSON(w, http.StatusOK, hits)
+}
+
+// parseListUsersParams - разбор параметров пагинации, фильтрации и сортировки из query-строки
+func parseListUsersParams(r *http.Request) (service.ListUsersParams, error) {
+	q := r.URL.Query()
+	params := service.ListUsersParams{
+		Filter: repository.UserFilter{
+			Name:        q.Get("name"),
+			Surname:     q.Get("surname"),
+			EmailDomain: q.Get("email_domain"),
+			Query:       q.Get("q"),
+		},
+		Sort: q.Get("sort"),
+	}
+	var err error
+	if params.Limit, params.Offset, err = parseLimitOffset(r); err != nil {
+		return params, err
+	}
+	if v := q.Get("total"); v != "" {
+		if params.WithTotal, err = strconv.ParseBool(v); err != nil {
+			return params, &repository.FieldError{Field: "total", Message: "must be a boolean", Err: repository.ErrInvalidPagination}
+		}
 	}
-	w.WriteHeader(http.StatusOK)
+	params.Cursor = q.Get("cursor")
+	return params, nil
 }
 
 // GetUserByID - хендлер для получения пользователя по ID
 // @Summary      Получение пользователя по ID
-// @Description  Возвращает пользователя в формате JSON по ID из URL
+// @Description  Возвращает пользователя в формате JSON по ID из URL. В заголовке ETag - версия пользователя: с ней в If-None-Match повторный запрос вернет 304, если пользователь не менялся
 // @Tags         users
 // @Produce      json
-// @Param        id   path      int  true  "ID пользователя"
+// @Param        id             path      int     true   "ID пользователя"
+// @Param        If-None-Match  header    string  false  "ETag из предыдущего ответа"
 // @Success      200  {object}  model.User
-// @Failure      404  {string}  string  "User not found"
-// @Failure      500  {string}  string  "Internal server error"
+// @Header       200  {string}  ETag  "Версия пользователя"
+// @Success      304  {string}  string  "Not Modified"
+// @Failure      400  {object}  problemResponse  "Invalid user id"
+// @Failure      404  {object}  problemResponse  "User not found"
+// @Failure      500  {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /users/{id} [get]
 func (UH UserHandler) GetUserByID(w http.ResponseWriter, r *http.Request) {
-	idstr := chi.URLParam(r, "id")
-	id, err := strconv.ParseInt(idstr, 10, 64)
+	id, err := pathID(r, "id")
 	if err != nil {
-		http.Error(w, "Failed to parse user id", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	user, err := UH.Repo.GetUserByID(id, r.Context())
 	if err != nil {
-		http.Error(w, "Failed to find user ID", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(user); err != nil {
-		http.Error(w, "Failed to encode user", http.StatusInternalServerError)
+	etag := userETag(user)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Accept-Patch", acceptPatch)
+	if ifNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	writeJSON(w, http.StatusOK, user)
 }
 
 // DeleteUser - хендлер для удаления пользователя по ID
 // @Summary      Удаление пользователя по ID
-// @Description  Удаляет пользователя по ID из URL
+// @Description  Мягко удаляет пользователя по ID из URL. До окончательной очистки его можно восстановить. С If-Match удаление проходит, только если пользователь не менялся
 // @Tags         users
-// @Param        id   path      int  true  "ID пользователя"
+// @Param        id        path      int     true   "ID пользователя"
+// @Param        If-Match  header    string  false  "ETag пользователя из GET /users/{id} или *"
 // @Success      204  {string}  string  "No Content"
-// @Failure      404  {string}  string  "User not found"
-// @Failure      400  {string}  string  "Bad request"
-// @Failure      500  {string}  string  "Internal server error"
+// @Failure      404  {object}  problemResponse  "User not found"
+// @Failure      400  {object}  problemResponse  "Bad request"
+// @Failure      500  {object}  problemResponse  "Internal server error"
+// @Failure      403  {object}  problemResponse  "Action on another user's account"
+// @Failure      412  {object}  problemResponse  "User has been modified: If-Match does not match"
+// @Failure      428  {object}  problemResponse  "If-Match header is required"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /delete/{id}	[delete]
 func (UH UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	idstr := chi.URLParam(r, "id")
-	id, err := strconv.ParseInt(idstr, 10, 64)
+	id, err := pathID(r, "id")
 	if err != nil {
-		http.Error(w, "Failed to parse user id", http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+	if err := UH.Policy.Authorize(r.Context(), policy.DeleteUser, id); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	err = UH.Repo.DeleteUser(id, r.Context())
+	ifMatch, err := UH.ifMatch(r)
 	if err != nil {
-		switch {
-		case errors.Is(err, repository.ErrUserNotFound):
-			http.Error(w, "User not found", http.StatusNotFound)
-		default:
-			http.Error(w, fmt.Sprintf("Failed to delete user: %v", err), http.StatusBadRequest)
-		}
+		writeError(w, r, err)
+		return
+	}
+	if err := UH.Repo.DeleteUser(id, ifMatch, r.Context()); err != nil {
+		writeError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent) //HTTP 204 No content
 }
 
+// RestoreUser - хендлер для восстановления удаленного пользователя
+// @Summary      Восстановление пользователя по ID
+// @Description  Восстанавливает мягко удаленного пользователя вместе с его дружбами, если срок хранения еще не истек
+// @Tags         users
+// @Param        id   path      int  true  "ID пользователя"
+// @Success      204  {string}  string  "No Content"
+// @Failure      400  {object}  problemResponse  "Bad request"
+// @Failure      404  {object}  problemResponse  "User not found"
+// @Failure      409  {object}  problemResponse  "User is not deleted"
+// @Failure      500  {object}  problemResponse  "Internal server error"
+// @Failure      403  {object}  problemResponse  "Action on another user's account"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id}/restore	[post]
+func (UH UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := UH.Policy.Authorize(r.Context(), policy.RestoreUser, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := UH.Repo.RestoreUser(id, r.Context()); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // UpdateUser - хендлер для обновления данных пользователя по ID
 // @Summary      Обновление пользователя по ID
-// @Description  Обновляет пользователя по ID из URL, новые данные берутся из тела запроса
+// @Description  Обновляет пользователя по ID из URL, новые данные берутся из тела запроса. С If-Match обновление проходит, только если пользователь не менялся. Отдает пользователя целиком и его новый ETag
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param        id   path      int  true  "ID пользователя"
+// @Param        id        path      int     true   "ID пользователя"
+// @Param        If-Match  header    string  false  "ETag пользователя из GET /users/{id} или *"
 // @Success      200  {object}  model.User	"User updated successfully"
-// @Failure      404  {string}  string  "User not found"
-// @Failure      400  {string}  string  "Bad request"
-// @Failure      409  {string}  string  "Conflict: new email already in use"
-// @Failure      500  {string}  string  "Internal server error"
+// @Header       200  {string}  ETag  "Новая версия пользователя"
+// @Failure      404  {object}  problemResponse  "User not found"
+// @Failure      400  {object}  problemResponse  "Invalid id, JSON or email, or all fields are empty"
+// @Failure      409  {object}  problemResponse  "Conflict: new email already in use"
+// @Failure      500  {object}  problemResponse  "Internal server error"
+// @Failure      403  {object}  problemResponse  "Action on another user's account"
+// @Failure      412  {object}  problemResponse  "User has been modified: If-Match does not match"
+// @Failure      428  {object}  problemResponse  "If-Match header is required"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
 // @Router       /update/{id}	[put]
 func (UH UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	var user model.User
 	//распарсить id
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := UH.Policy.Authorize(r.Context(), policy.UpdateUser, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	ifMatch, err := UH.ifMatch(r)
 	if err != nil {
-		http.Error(w, "Failed to parse user id", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	//распарсить тело запроса - достать данные и засунуть в структуру
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Failed to decode user from json", http.StatusBadRequest) //HTTP 400 Bad request
+	if err := decodeJSON(r, &user); err != nil {
+		writeError(w, r, err)
 		return
 	}
 	user.ID = id
-	if err := UH.Repo.UpdateUser(&user, r.Context()); err != nil {
-		switch {
-		case errors.Is(err, repository.ErrEmailExists):
-			http.Error(w, "Email already exists", http.StatusConflict) //HTTP 409 Conflict
-		case errors.Is(err, repository.ErrEmptyFields):
-			http.Error(w, "At least one field must not be empty", http.StatusBadRequest) //HTTP 400 Bad request
-		case errors.Is(err, repository.ErrUserNotFound):
-			http.Error(w, "User not found", http.StatusNotFound) //HTTP 404 Not found
-		}
+	if err := UH.Repo.UpdateUser(&user, ifMatch, r.Context()); err != nil {
+		writeError(w, r, err)
 		return
 	}
+	w.Header().Set("ETag", userETag(&user))
+	writeJSON(w, http.StatusOK, user) //HTTP 200 OK
+}
 
-	//ответ
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(user); err != nil {
-		http.Error(w, "Failed to encode user", http.StatusInternalServerError)
+// PatchUser - хендлер для частичного изменения пользователя по ID
+// @Summary      Частичное изменение пользователя по ID
+// @Description  Применяет к пользователю (в представлении GET /users/{id}) JSON Merge Patch (RFC 7396, application/merge-patch+json) или JSON Patch (RFC 6902, application/json-patch+json, с операциями test). Менять можно name, surname и email, остальные поля только для чтения. Результат проверяется так же, как при создании пользователя. С If-Match изменение проходит, только если пользователь не менялся
+// @Tags         users
+// @Accept       application/merge-patch+json
+// @Accept       application/json-patch+json
+// @Produce      json
+// @Param        id        path      int     true   "ID пользователя"
+// @Param        If-Match  header    string  false  "ETag пользователя из GET /users/{id} или *"
+// @Param        patch     body      object  true   "Merge patch (объект с новыми значениями) или JSON Patch (массив операций)"
+// @Success      200  {object}  model.User
+// @Header       200  {string}  ETag  "Новая версия пользователя"
+// @Failure      400  {object}  problemResponse  "Invalid id or patch document, invalid or empty fields, read-only fields changed"
+// @Failure      403  {object}  problemResponse  "Action on another user's account"
+// @Failure      404  {object}  problemResponse  "User not found"
+// @Failure      409  {object}  problemResponse  "Test operation failed or new email already in use"
+// @Failure      412  {object}  problemResponse  "User has been modified: If-Match does not match"
+// @Failure      415  {object}  problemResponse  "Unsupported patch content type"
+// @Failure      422  {object}  problemResponse  "Patch cannot be applied: missing path"
+// @Failure      428  {object}  problemResponse  "If-Match header is required"
+// @Failure      500  {object}  problemResponse  "Internal server error"
+// @Security     BearerAuth
+// @Security     ApiKeyAuth
+// @Router       /users/{id} [patch]
+func (UH UserHandler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := UH.Policy.Authorize(r.Context(), policy.UpdateUser, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	ifMatch, err := UH.ifMatch(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	format, err := patchFormat(r)
+	if err != nil {
+		w.Header().Set("Accept-Patch", acceptPatch)
+		writeError(w, r, err)
+		return
+	}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("%w: %v", errInvalidJSON, err))
+		return
+	}
+	user, err := UH.Repo.PatchUser(id, format, patch, ifMatch, r.Context())
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK) //HTTP 200 OK
+	w.Header().Set("ETag", userETag(user))
+	writeJSON(w, http.StatusOK, user)
+}
+
+// acceptPatch - форматы патчей, которые принимает PATCH /users/{id}
+const acceptPatch = "application/merge-patch+json, application/json-patch+json"
+
+// patchFormat определяет формат патча по Content-Type запроса
+func patchFormat(r *http.Request) (service.PatchFormat, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return 0, fmt.Errorf("%w: expected %s", errUnsupportedMediaType, acceptPatch)
+	}
+	switch mediaType {
+	case "application/merge-patch+json":
+		return service.MergePatch, nil
+	case "application/json-patch+json":
+		return service.JSONPatch, nil
+	}
+	return 0, fmt.Errorf("%w: %s, expected %s", errUnsupportedMediaType, mediaType, acceptPatch)
+}
+
+// ifMatch достает условие If-Match; при RequireIfMatch запрос без заголовка отклоняется
+func (UH UserHandler) ifMatch(r *http.Request) (service.IfMatch, error) {
+	if UH.RequireIfMatch && len(r.Header.Values("If-Match")) == 0 {
+		return nil, errPreconditionRequired
+	}
+	return parseIfMatch(r), nil
 }
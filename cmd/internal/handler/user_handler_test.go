@@ -0,0 +1,97 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+)
+
+func TestPatchUser(t *testing.T) {
+	api := newTestAPI(t)
+	ann := api.register("Ann", "ann@example.com")
+	path := "/users/" + itoa(ann.User.ID)
+	patch := func(contentType, body, ifMatch string) *model.User {
+		t.Helper()
+		headers := map[string]string{"Content-Type": contentType}
+		if ifMatch != "" {
+			headers["If-Match"] = ifMatch
+		}
+		rec := api.do(request{method: http.MethodPatch, path: path, token: ann.AccessToken, body: body, headers: headers})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PATCH %s %s: status %d, body %s", contentType, body, rec.Code, rec.Body)
+		}
+		var user model.User
+		decodeBody(t, rec, &user)
+		if etag := rec.Header().Get("ETag"); etag != `"`+itoa(user.Version)+`"` {
+			t.Fatalf("ETag %q does not match version %d", etag, user.Version)
+		}
+		return &user
+	}
+	problemFor := func(contentType, body string, status int, code string) problem {
+		t.Helper()
+		rec := api.do(request{method: http.MethodPatch, path: path, token: ann.AccessToken, body: body,
+			headers: map[string]string{"Content-Type": contentType}})
+		return wantProblem(t, rec, status, code)
+	}
+
+	user := patch("application/merge-patch+json", `{"name":"Anna"}`, `"1"`)
+	if user.Name != "Anna" || user.Surname != "Test" || user.Version != 2 {
+		t.Fatalf("merge patch: got %+v", user)
+	}
+	user = patch("application/json-patch+json",
+		`[{"op":"test","path":"/name","value":"Anna"},{"op":"replace","path":"/surname","value":"Lee"}]`, "")
+	if user.Name != "Anna" || user.Surname != "Lee" || user.Version != 3 {
+		t.Fatalf("json patch: got %+v", user)
+	}
+
+	problemFor("application/json-patch+json", `[{"op":"test","path":"/name","value":"Bob"}]`,
+		http.StatusConflict, "patch_test_failed")
+	problemFor("application/json-patch+json", `[{"op":"remove","path":"/nickname"}]`,
+		http.StatusUnprocessableEntity, "patch_not_applicable")
+	problemFor("application/json-patch+json", `{"op":"replace"}`, http.StatusBadRequest, "invalid_patch")
+	p := problemFor("application/merge-patch+json", `{"version":10}`, http.StatusBadRequest, "invalid_field")
+	if len(p.Errors) != 1 || p.Errors[0].Field != "version" {
+		t.Fatalf("read-only field: got errors %+v, want version", p.Errors)
+	}
+	p = problemFor("application/merge-patch+json", `{"surname":null}`, http.StatusBadRequest, "empty_some_fields")
+	if len(p.Errors) != 1 || p.Errors[0].Field != "surname" {
+		t.Fatalf("removed field: got errors %+v, want surname", p.Errors)
+	}
+	rec := api.do(request{method: http.MethodPatch, path: path, token: ann.AccessToken, body: `{"name":"Ann"}`})
+	wantProblem(t, rec, http.StatusUnsupportedMediaType, "unsupported_media_type")
+	if rec.Header().Get("Accept-Patch") == "" {
+		t.Fatal("415 must list supported formats in Accept-Patch")
+	}
+	rec = api.do(request{method: http.MethodPatch, path: path, token: ann.AccessToken, body: `{"name":"Ann"}`,
+		headers: map[string]string{"Content-Type": "application/merge-patch+json", "If-Match": `"1"`}})
+	wantProblem(t, rec, http.StatusPreconditionFailed, "version_mismatch")
+}
+
+// дружба появляется только через заявку и ее принятие, тело POST /users ее не создает
+func TestCreateUserIgnoresFriendships(t *testing.T) {
+	api := newTestAPI(t)
+	ann := api.register("Ann", "ann@example.com")
+	bob := api.register("Bob", "bob@example.com")
+
+	rec := api.do(request{method: http.MethodPost, path: "/users", token: ann.AccessToken,
+		body: `{"name":"Cat","surname":"Fox","email":"cat@example.com",` +
+			`"Friends":[{"accepter_id":` + itoa(bob.User.ID) + `,"status":"accepted"}],` +
+			`"FriendOf":[{"requester_id":` + itoa(bob.User.ID) + `,"status":"pending"}]}`})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /users: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	for _, path := range []string{"/users/" + itoa(bob.User.ID) + "/friends", "/users/" + itoa(bob.User.ID) + "/friend_requests/outgoing"} {
+		rec = api.do(request{method: http.MethodGet, path: path, token: bob.AccessToken})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d, body %s", path, rec.Code, rec.Body)
+		}
+		var items []json.RawMessage
+		decodeBody(t, rec, &items)
+		if len(items) != 0 {
+			t.Fatalf("GET %s: POST /users must not create friendships, got %s", path, rec.Body)
+		}
+	}
+}
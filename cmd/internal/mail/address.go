@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var ErrInvalidAddress = errors.New("invalid email address")
+
+const (
+	maxAddressLength = 254
+	maxLocalLength   = 64
+)
+
+// NormalizeAddress проверяет синтаксис адреса по RFC 5322 и приводит его к каноническому виду:
+// IDN-домен переводится в punycode и в нижний регистр. Локальная часть сохраняется как есть -
+// по RFC она чувствительна к регистру, а уникальность без учета регистра обеспечивает индекс в базе.
+// Адреса с отображаемым именем ("Alice <alice@example.com>") и комментариями не принимаются.
+func NormalizeAddress(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("%w: must not be empty", ErrInvalidAddress)
+	}
+	parsed, err := netmail.ParseAddress(raw)
+	if err != nil || parsed.Name != "" || parsed.Address != raw {
+		return "", fmt.Errorf("%w: must be a plain address like user@example.com", ErrInvalidAddress)
+	}
+
+	at := strings.LastIndexByte(raw, '@')
+	local, domain := raw[:at], raw[at+1:]
+	if len(local) > maxLocalLength {
+		return "", fmt.Errorf("%w: local part is longer than %d characters", ErrInvalidAddress, maxLocalLength)
+	}
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid domain %q", ErrInvalidAddress, domain)
+	}
+	ascii = strings.ToLower(ascii)
+	if !strings.Contains(ascii, ".") || strings.HasSuffix(ascii, ".") {
+		return "", fmt.Errorf("%w: domain must be a fully qualified name", ErrInvalidAddress)
+	}
+
+	address := local + "@" + ascii
+	if len(address) > maxAddressLength {
+		return "", fmt.Errorf("%w: longer than %d characters", ErrInvalidAddress, maxAddressLength)
+	}
+	return address, nil
+}
@@ -0,0 +1,38 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"net/textproto"
+	"testing"
+)
+
+func TestRenderEncodesSubject(t *testing.T) {
+	msg := Message{To: "ann@example.com", Subject: "Подтверждение email", Body: "Здравствуйте!\nСсылка внутри."}
+	raw := render("noreply@example.com", msg)
+
+	header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(raw))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("rendered message has invalid headers: %v", err)
+	}
+	subject := header.Get("Subject")
+	for _, r := range subject {
+		if r > 127 {
+			t.Fatalf("Subject header must be ASCII, got %q", subject)
+		}
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(subject)
+	if err != nil {
+		t.Fatalf("decode Subject %q: %v", subject, err)
+	}
+	if decoded != msg.Subject {
+		t.Fatalf("Subject decodes to %q, want %q", decoded, msg.Subject)
+	}
+
+	//ASCII-тема не кодируется
+	raw = render("noreply@example.com", Message{To: "ann@example.com", Subject: "Password reset"})
+	if !bytes.Contains(raw, []byte("\r\nSubject: Password reset\r\n")) {
+		t.Fatalf("ASCII subject must stay as is, got %q", raw)
+	}
+}
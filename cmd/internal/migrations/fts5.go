@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// sqliteFTS5Table - поисковая таблица FTS5 из 0001_initial_schema
+const sqliteFTS5Table = "CREATE VIRTUAL TABLE IF NOT EXISTS user_search USING fts5(document, tokenize = 'trigram');"
+
+// sqlitePlainSearchTable - обычная таблица с теми же колонкой и rowid, поиск по ней идет подстрокой
+const sqlitePlainSearchTable = "CREATE TABLE IF NOT EXISTS user_search (document TEXT NOT NULL);"
+
+// adaptScript подстраивает скрипт под возможности базы: если SQLite собран без FTS5 (mattn/go-sqlite3
+// без тега sqlite_fts5), поисковая таблица создается обычной. Контрольная сумма считается по файлу,
+// поэтому миграция считается примененной в обеих сборках. Базу с обычной таблицей может открыть и
+// сборка с FTS5 (поиск останется подстрокой), а базу с таблицей FTS5 сборка без FTS5 не открывает:
+// репозиторий отказывается писать в индекс, который не может обновить, и сервер не запускается.
+func adaptScript(tx *gorm.DB, script string) (string, error) {
+	if tx.Dialector.Name() != "sqlite" || !strings.Contains(script, sqliteFTS5Table) {
+		return script, nil
+	}
+	var fts5 bool
+	if err := tx.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5).Error; err != nil {
+		return "", err
+	}
+	if fts5 {
+		return script, nil
+	}
+	return strings.Replace(script, sqliteFTS5Table, sqlitePlainSearchTable, 1), nil
+}
@@ -1,15 +0,0 @@
-CREATE TABLE IF NOT EXISTS users(
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    name TEXT NOT NULL,
-    surname TEXT NOT NULL,
-    email TEXT NOT NULL UNIQUE
-);
-CREATE TABLE IF NOT EXISTS friends(
-    requester INTEGER NOT NULL,
-    accepter INTEGER NOT NULL,
-    created_at TIMESTAMP DEFAULT NOW(),
-
-    PRIMARY KEY (requester, accepter),
-    FOREIGN KEY (requester) REFERENCES users(id) ON DELETE CASCADE,
-    FOREIGN KEY (accepter) REFERENCES users(id) ON DELETE CASCADE
-);
\ No newline at end of file
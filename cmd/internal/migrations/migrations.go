@@ -0,0 +1,439 @@
+// Package migrations применяет к базе пронумерованные SQL-миграции. Миграции встроены в бинарник,
+// у каждого диалекта (postgres, sqlite) свой каталог с файлами вида 0001_name.up.sql и 0001_name.down.sql.
+// Примененные миграции хранятся в таблице schema_migrations вместе с контрольной суммой up-скрипта:
+// если уже примененный файл изменился, мигратор отказывается работать.
+package migrations
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+var ErrUnsupportedDialect = errors.New("migrations are not available for this database")
+var ErrPendingMigrations = errors.New("database has pending migrations")
+var ErrChecksumMismatch = errors.New("applied migration has been modified")
+var ErrUnknownMigration = errors.New("database has a migration unknown to this build")
+
+// advisoryLockKey - ключ advisory-блокировки Postgres, под которой выполняются миграции,
+// чтобы несколько одновременно запущенных экземпляров не применяли их параллельно
+const advisoryLockKey = 0x75736572736d6967
+
+// baselineVersion - миграция с базовой схемой. Перед ней мигратор дополняет таблицы, созданные
+// прежними версиями сервиса через AutoMigrate, недостающими колонками.
+const baselineVersion = 1
+
+// baselineColumn - колонка, которой может не быть в таблице, созданной AutoMigrate
+type baselineColumn struct {
+	Table      string
+	Name       string
+	Definition string
+}
+
+// baselineColumns - колонки users и friendships, появившиеся после первой версии сервиса, для
+// каждого диалекта. Определения совпадают с 0001_initial_schema; NOT NULL колонки имеют значения
+// по умолчанию, поэтому добавляются к таблицам с данными. Старые дружбы становятся принятыми.
+var baselineColumns = map[string][]baselineColumn{
+	"postgres": {
+		{"users", "email_verified_at", "TIMESTAMPTZ"},
+		{"users", "deleted_at", "TIMESTAMPTZ"},
+		{"users", "version", "BIGINT NOT NULL DEFAULT 1"},
+		{"users", "updated_at", "TIMESTAMPTZ"},
+		{"users", "password_hash", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "role", "TEXT NOT NULL DEFAULT 'user'"},
+		{"users", "totp_secret", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "totp_enabled", "BOOLEAN NOT NULL DEFAULT false"},
+		{"users", "totp_last_step", "BIGINT NOT NULL DEFAULT 0"},
+		{"friendships", "status", "TEXT NOT NULL DEFAULT 'accepted'"},
+		{"friendships", "created_at", "TIMESTAMPTZ"},
+		{"friendships", "updated_at", "TIMESTAMPTZ"},
+	},
+	"sqlite": {
+		{"users", "email_verified_at", "DATETIME"},
+		{"users", "deleted_at", "DATETIME"},
+		{"users", "version", "INTEGER NOT NULL DEFAULT 1"},
+		{"users", "updated_at", "DATETIME"},
+		{"users", "password_hash", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "role", "TEXT NOT NULL DEFAULT 'user'"},
+		{"users", "totp_secret", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "totp_enabled", "NUMERIC NOT NULL DEFAULT false"},
+		{"users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+		{"friendships", "status", "TEXT NOT NULL DEFAULT 'accepted'"},
+		{"friendships", "created_at", "DATETIME"},
+		{"friendships", "updated_at", "DATETIME"},
+	},
+}
+
+// fileName - имя файла миграции: номер версии, название и направление
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration - одна миграция: скрипты применения и отката и контрольная сумма up-скрипта
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status - состояние миграции в базе. AppliedAt == nil - миграция еще не применена.
+// Unknown - миграция есть в базе, но ее нет в этой сборке.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+	Unknown   bool
+}
+
+// appliedMigration - строка таблицы schema_migrations
+type appliedMigration struct {
+	Version   int64 `gorm:"primaryKey"`
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func (appliedMigration) TableName() string { return "schema_migrations" }
+
+// Migrator применяет и откатывает миграции своего диалекта
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New загружает миграции для диалекта db
+func New(db *gorm.DB) (*Migrator, error) {
+	dialect := db.Dialector.Name()
+	if dialect != "postgres" && dialect != "sqlite" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedDialect, dialect)
+	}
+	dir, err := fs.Sub(files, dialect)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := load(dir)
+	if err != nil {
+		return nil, fmt.Errorf("load %s migrations: %w", dialect, err)
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// load читает миграции из каталога и упорядочивает их по версии. У каждой версии должны быть
+// оба скрипта, а номера версий - уникальны.
+func load(dir fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(dir, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		m := fileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", entry.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := fs.ReadFile(dir, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has different names: %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(body)
+			sum := sha256.Sum256(body)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %s must have both up and down scripts", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	return migrations, nil
+}
+
+// Status возвращает состояние всех миграций сборки и миграций из базы, которых в сборке нет
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			status := Status{Migration: migration}
+			if a, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &a.AppliedAt
+				delete(applied, migration.Version)
+			}
+			statuses = append(statuses, status)
+		}
+		for _, a := range applied {
+			statuses = append(statuses, Status{
+				Migration: Migration{Version: a.Version, Name: a.Name, Checksum: a.Checksum},
+				AppliedAt: &a.AppliedAt,
+				Unknown:   true,
+			})
+		}
+		return nil
+	})
+	slices.SortFunc(statuses, func(a, b Status) int { return cmp.Compare(a.Version, b.Version) })
+	return statuses, err
+}
+
+// Pending возвращает еще не примененные миграции. Если примененные миграции изменились
+// или неизвестны этой сборке, возвращается ошибка.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	var pending []Migration
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		var err error
+		pending, err = m.pending(conn)
+		return err
+	})
+	return pending, err
+}
+
+// RequireCurrent возвращает ErrPendingMigrations со списком версий, если в базе есть
+// не примененные миграции
+func (m *Migrator) RequireCurrent(ctx context.Context) error {
+	pending, err := m.Pending(ctx)
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	names := make([]string, len(pending))
+	for i, p := range pending {
+		names[i] = p.String()
+	}
+	return fmt.Errorf("%w: %s", ErrPendingMigrations, strings.Join(names, ", "))
+}
+
+// Up применяет все не примененные миграции по возрастанию версии, каждую в своей транзакции
+// (на SQLite - в своей точке сохранения общей транзакции, см. locked).
+// Возвращает примененные миграции, в том числе при ошибке на одной из следующих.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		pending, err := m.pending(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range pending {
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if migration.Version == baselineVersion {
+					if err := upgradeBaseline(tx); err != nil {
+						return fmt.Errorf("upgrade baseline schema: %w", err)
+					}
+				}
+				script, err := adaptScript(tx, migration.Up)
+				if err != nil {
+					return err
+				}
+				if err := execScript(tx, script); err != nil {
+					return err
+				}
+				return tx.Create(&appliedMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					Checksum:  migration.Checksum,
+					AppliedAt: time.Now().UTC(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("apply migration %s: %w", migration, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down откатывает steps последних примененных миграций по убыванию версии
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := m.verify(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := execScript(tx, migration.Down); err != nil {
+					return err
+				}
+				return tx.Delete(&appliedMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("revert migration %s: %w", migration, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// pending сверяет примененные миграции со сборкой и возвращает оставшиеся
+func (m *Migrator) pending(conn *gorm.DB) ([]Migration, error) {
+	applied, err := m.verify(conn)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// verify проверяет, что каждая примененная миграция есть в сборке и не изменилась с момента применения
+func (m *Migrator) verify(conn *gorm.DB) (map[int64]appliedMigration, error) {
+	applied, err := m.applied(conn)
+	if err != nil {
+		return nil, err
+	}
+	for version, a := range applied {
+		i := slices.IndexFunc(m.migrations, func(migration Migration) bool { return migration.Version == version })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownMigration, Migration{Version: a.Version, Name: a.Name})
+		}
+		if m.migrations[i].Checksum != a.Checksum {
+			return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, m.migrations[i])
+		}
+	}
+	return applied, nil
+}
+
+// applied создает таблицу schema_migrations, если ее нет, и читает примененные миграции
+func (m *Migrator) applied(conn *gorm.DB) (map[int64]appliedMigration, error) {
+	err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`).Error
+	if err != nil {
+		return nil, err
+	}
+	var rows []appliedMigration
+	if err := conn.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// locked выполняет fn на одном соединении под блокировкой миграций, чтобы несколько одновременно
+// запущенных мигратора не применяли одни и те же миграции. На Postgres это сессионная
+// advisory-блокировка. На SQLite fn целиком выполняется в транзакции BEGIN IMMEDIATE: она сразу
+// берет блокировку записи, и второй мигратор ждет ее (busy_timeout) еще до чтения schema_migrations.
+// Транзакции отдельных миграций внутри нее становятся точками сохранения.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		switch conn.Dialector.Name() {
+		case "postgres":
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", advisoryLockKey).Error; err != nil {
+				return fmt.Errorf("acquire migration lock: %w", err)
+			}
+			//блокировку снимаем без контекста запроса: он может быть уже отменен
+			defer conn.WithContext(context.Background()).Exec("SELECT pg_advisory_unlock(?)", advisoryLockKey)
+			return fn(conn)
+		case "sqlite":
+			return immediate(conn, fn)
+		default:
+			return fn(conn)
+		}
+	})
+}
+
+// immediate выполняет fn в транзакции SQLite BEGIN IMMEDIATE на соединении conn. Миграция, которая
+// не применилась, уже откатилась к своей точке сохранения, поэтому транзакция фиксируется и при ошибке
+// fn: примененные до нее миграции остаются, как и на Postgres, где у каждой своя транзакция.
+func immediate(conn *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if err := conn.Exec("BEGIN IMMEDIATE").Error; err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	tx := conn.Session(&gorm.Session{})
+	tx.Statement.ConnPool = immediateTx{conn.Statement.ConnPool}
+	err := fn(tx)
+	if commitErr := conn.WithContext(context.Background()).Exec("COMMIT").Error; commitErr != nil {
+		//соединение вернется в пул, в нем не должно остаться открытой транзакции
+		conn.WithContext(context.Background()).Exec("ROLLBACK")
+		if err == nil {
+			err = commitErr
+		}
+	}
+	return err
+}
+
+// immediateTx - соединение внутри транзакции, начатой immediate. Для GORM это открытая транзакция,
+// и conn.Transaction создает в ней точку сохранения вместо новой транзакции. Фиксирует ее immediate.
+type immediateTx struct {
+	gorm.ConnPool
+}
+
+func (immediateTx) Commit() error   { return nil }
+func (immediateTx) Rollback() error { return nil }
+
+// upgradeBaseline добавляет недостающие колонки в уже существующие таблицы users и friendships,
+// чтобы индексы базовой схемы можно было построить на базе, созданной AutoMigrate. На новой
+// базе таблиц еще нет, и upgradeBaseline ничего не делает.
+func upgradeBaseline(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	for _, column := range baselineColumns[tx.Dialector.Name()] {
+		if !migrator.HasTable(column.Table) || migrator.HasColumn(column.Table, column.Name) {
+			continue
+		}
+		err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", column.Table, column.Name, column.Definition)).Error
+		if err != nil {
+			return fmt.Errorf("add %s.%s: %w", column.Table, column.Name, err)
+		}
+	}
+	return nil
+}
+
+// execScript выполняет скрипт миграции целиком. Скрипт передается драйверу напрямую, минуя
+// построитель запросов GORM, чтобы символы вроде ? и @ в SQL не принимались за параметры.
+func execScript(tx *gorm.DB, script string) error {
+	_, err := tx.Statement.ConnPool.ExecContext(tx.Statement.Context, script)
+	return err
+}
+
+// String - номер и название миграции, как в имени файла: 0001_initial_schema
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
@@ -0,0 +1,209 @@
+package migrations
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// baselineFixture - база, созданная первой версией сервиса через AutoMigrate
+const baselineFixture = "../../test.db"
+
+// openBaseline открывает копию baselineFixture
+func openBaseline(t *testing.T) *gorm.DB {
+	t.Helper()
+	data, err := os.ReadFile(baselineFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "baseline.db")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(sqlite.Open(path+"?_foreign_keys=on"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestUpUpgradesBaseline(t *testing.T) {
+	db := openBaseline(t)
+	ctx := context.Background()
+	//встречные дружбы копились в первой версии, пока у таблицы не было индекса пары
+	if err := db.Exec("INSERT INTO friendships (requester, accepter, created_at) VALUES (1, 2, ?), (2, 1, ?)",
+		time.Now(), time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if err := m.RequireCurrent(ctx); err != nil {
+		t.Fatalf("RequireCurrent: %v", err)
+	}
+
+	var users []struct {
+		ID         int64
+		Email      string
+		EmailLower string
+		Version    int64
+		Role       string
+	}
+	if err := db.Raw("SELECT id, email, email_lower, version, role FROM users WHERE deleted_at IS NULL ORDER BY id").Scan(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Email != "bob@example.com" || users[0].EmailLower != "bob@example.com" ||
+		users[0].Version != 1 || users[0].Role != "user" {
+		t.Errorf("users after upgrade = %+v", users)
+	}
+	var friendships []struct {
+		Requester int64
+		Accepter  int64
+		Status    string
+	}
+	if err := db.Raw("SELECT requester, accepter, status FROM friendships").Scan(&friendships).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(friendships) != 1 || friendships[0].Status != "accepted" {
+		t.Errorf("friendships after upgrade = %+v, want one accepted pair", friendships)
+	}
+	if err := db.Exec("INSERT INTO friendships (requester, accepter) VALUES (2, 1)").Error; err == nil {
+		t.Error("reverse friendship inserted after upgrade, want pair index violation")
+	}
+
+	if _, err := m.Down(ctx, len(m.migrations)); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if db.Migrator().HasTable("users") {
+		t.Error("users table left after Down")
+	}
+}
+
+func TestUpMergesReverseFriendships(t *testing.T) {
+	early, late := time.Now().Add(-time.Hour), time.Now()
+	tests := []struct {
+		name          string
+		forward       string
+		reverse       string
+		wantRequester int64
+		wantStatus    string
+	}{
+		{"both pending", "pending", "pending", 1, "accepted"},
+		{"one accepted", "declined", "accepted", 1, "accepted"},
+		{"higher status wins", "cancelled", "pending", 2, "pending"},
+		{"equal status keeps earlier", "declined", "declined", 1, "declined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openBaseline(t)
+			if err := upgradeBaseline(db); err != nil {
+				t.Fatal(err)
+			}
+			err := db.Exec("INSERT INTO friendships (requester, accepter, status, created_at) VALUES (1, 2, ?, ?), (2, 1, ?, ?)",
+				tt.forward, early, tt.reverse, late).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := New(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := m.Up(context.Background()); err != nil {
+				t.Fatalf("Up: %v", err)
+			}
+			var got []struct {
+				Requester int64
+				Status    string
+			}
+			if err := db.Raw("SELECT requester, status FROM friendships").Scan(&got).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0].Requester != tt.wantRequester || got[0].Status != tt.wantStatus {
+				t.Errorf("friendships = %+v, want requester %d with status %s", got, tt.wantRequester, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// adaptScript узнает поисковую таблицу по тексту, поэтому он должен совпадать с файлом миграции
+func TestAdaptScriptFindsSearchTable(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "search.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	m, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(m.migrations[0].Up, sqliteFTS5Table) {
+		t.Fatalf("%s does not create the search table with %q", m.migrations[0], sqliteFTS5Table)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if err := db.Exec("INSERT INTO user_search (rowid, document) VALUES (1, 'ann lee')").Error; err != nil {
+		t.Fatalf("search table is not usable: %v", err)
+	}
+}
+
+// два мигратора на одном файле SQLite: миграции применяет один, второй дожидается его и ничего не делает
+func TestUpConcurrentSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "concurrent.db")
+	migrators := make([]*Migrator, 2)
+	for i := range migrators {
+		db, err := gorm.Open(sqlite.Open(path+"?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL"), &gorm.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if sqlDB, err := db.DB(); err == nil {
+				sqlDB.Close()
+			}
+		})
+		if migrators[i], err = New(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	applied := make([][]Migration, len(migrators))
+	errs := make([]error, len(migrators))
+	for i, m := range migrators {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			applied[i], errs[i] = m.Up(context.Background())
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Up of migrator %d: %v", i, err)
+		}
+	}
+	if total, want := len(applied[0])+len(applied[1]), len(migrators[0].migrations); total != want {
+		t.Fatalf("migrators applied %d and %d migrations, want %d in total", len(applied[0]), len(applied[1]), want)
+	}
+}
@@ -0,0 +1,127 @@
+-- Базовая схема. Совпадает со схемой, которую создавал GORM AutoMigrate, и написана через
+-- IF NOT EXISTS, поэтому применяется и к базе, созданной прежними версиями сервиса. Недостающие
+-- колонки в ее таблицах users и friendships мигратор добавляет перед этим скриптом.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                BIGSERIAL PRIMARY KEY,
+    name              TEXT NOT NULL,
+    surname           TEXT NOT NULL,
+    email             TEXT NOT NULL,
+    email_verified_at TIMESTAMPTZ,
+    deleted_at        TIMESTAMPTZ,
+    version           BIGINT NOT NULL DEFAULT 1,
+    updated_at        TIMESTAMPTZ,
+    password_hash     TEXT NOT NULL DEFAULT '',
+    role              TEXT NOT NULL DEFAULT 'user',
+    totp_secret       TEXT NOT NULL DEFAULT '',
+    totp_enabled      BOOLEAN NOT NULL DEFAULT false,
+    totp_last_step    BIGINT NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+-- email уникален без учета регистра
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_ci ON users (LOWER(email));
+
+CREATE TABLE IF NOT EXISTS friendships (
+    requester  BIGINT NOT NULL,
+    accepter   BIGINT NOT NULL,
+    status     TEXT NOT NULL DEFAULT 'accepted',
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    PRIMARY KEY (requester, accepter),
+    CONSTRAINT fk_users_friends FOREIGN KEY (requester) REFERENCES users (id),
+    CONSTRAINT fk_users_friend_of FOREIGN KEY (accepter) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_friendships_status ON friendships (status);
+CREATE INDEX IF NOT EXISTS idx_friendships_accepter_id ON friendships (accepter);
+-- до появления индекса пары в базе могли накопиться встречные записи (a,b) и (b,a); из каждой пары
+-- остается одна. Если одна из записей принята или обе ожидают ответа (пользователи позвали друг
+-- друга), пара становится дружбой. Иначе остается запись с более значимым статусом
+-- (accepted > pending > declined > cancelled), при равенстве - более ранняя.
+UPDATE friendships SET status = 'accepted'
+WHERE EXISTS (
+    SELECT 1 FROM friendships AS r
+    WHERE r.requester = friendships.accepter AND r.accepter = friendships.requester
+      AND (r.status = 'accepted' OR friendships.status = 'accepted'
+           OR (r.status = 'pending' AND friendships.status = 'pending'))
+);
+DELETE FROM friendships
+WHERE EXISTS (
+    SELECT 1 FROM friendships AS r
+    WHERE r.requester = friendships.accepter AND r.accepter = friendships.requester
+      AND (CASE r.status WHEN 'accepted' THEN 4 WHEN 'pending' THEN 3 WHEN 'declined' THEN 2 ELSE 1 END, COALESCE(friendships.created_at, '-infinity'), friendships.requester)
+        > (CASE friendships.status WHEN 'accepted' THEN 4 WHEN 'pending' THEN 3 WHEN 'declined' THEN 2 ELSE 1 END, COALESCE(r.created_at, '-infinity'), r.requester)
+);
+-- дружба неориентирована: (1,2) и (2,1) - одна пара
+CREATE UNIQUE INDEX IF NOT EXISTS idx_friendships_pair ON friendships (LEAST(requester, accepter), GREATEST(requester, accepter));
+
+CREATE TABLE IF NOT EXISTS blocks (
+    blocker    BIGINT NOT NULL,
+    blocked    BIGINT NOT NULL,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (blocker, blocked),
+    CONSTRAINT fk_blocks_blocker FOREIGN KEY (blocker) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_blocks_blocked FOREIGN KEY (blocked) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_blocks_blocked_id ON blocks (blocked);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL,
+    family_id  TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           BIGSERIAL PRIMARY KEY,
+    name         TEXT NOT NULL,
+    prefix       TEXT NOT NULL,
+    key_hash     TEXT NOT NULL,
+    scopes       TEXT NOT NULL,
+    created_by   BIGINT NOT NULL,
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_created_by ON api_keys (created_by);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_prefix ON api_keys (prefix);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id        BIGSERIAL PRIMARY KEY,
+    user_id   BIGINT NOT NULL,
+    code_hash TEXT NOT NULL,
+    used_at   TIMESTAMPTZ,
+    CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS email_tokens (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL,
+    purpose    TEXT NOT NULL,
+    nonce      TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    CONSTRAINT fk_email_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_tokens_nonce ON email_tokens (nonce);
+CREATE INDEX IF NOT EXISTS idx_email_tokens_user_id ON email_tokens (user_id);
+
+-- поисковый индекс пользователей: tsvector для совпадения слов, pg_trgm для опечаток
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE TABLE IF NOT EXISTS user_search (
+    user_id  BIGINT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    document TEXT NOT NULL,
+    tsv      TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', document)) STORED
+);
+CREATE INDEX IF NOT EXISTS idx_user_search_tsv ON user_search USING GIN (tsv);
+CREATE INDEX IF NOT EXISTS idx_user_search_trgm ON user_search USING GIN (document gin_trgm_ops);
@@ -0,0 +1 @@
+ALTER TABLE email_tokens DROP COLUMN email;
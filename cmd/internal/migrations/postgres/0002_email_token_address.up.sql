@@ -0,0 +1,3 @@
+-- Токен из письма привязан к адресу, на который письмо отправлено: ссылка, ушедшая на прежний
+-- email, не подтверждает новый. У выданных раньше токенов адреса нет, и они перестают действовать.
+ALTER TABLE email_tokens ADD COLUMN email TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_ci ON users (LOWER(email));
+DROP INDEX IF EXISTS idx_users_email_lower;
+ALTER TABLE users DROP COLUMN IF EXISTS email_lower;
@@ -0,0 +1,8 @@
+-- Уникальность email без учета регистра - по колонке email_lower, которую заполняет сервис через
+-- strings.ToLower. Индекс по LOWER(email) зависел от локали базы: в локали C LOWER меняет только ASCII.
+-- Существующие строки заполняются LOWER(email) базы.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_lower TEXT;
+UPDATE users SET email_lower = LOWER(email);
+ALTER TABLE users ALTER COLUMN email_lower SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (email_lower);
+DROP INDEX IF EXISTS idx_users_email_ci;
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS user_search;
+DROP TABLE IF EXISTS email_tokens;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS blocks;
+DROP TABLE IF EXISTS friendships;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,121 @@
+-- Базовая схема. Совпадает со схемой, которую создавал GORM AutoMigrate, и написана через
+-- IF NOT EXISTS, поэтому применяется и к базе, созданной прежними версиями сервиса. Недостающие
+-- колонки в ее таблицах users и friendships мигратор добавляет перед этим скриптом.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    name              TEXT NOT NULL,
+    surname           TEXT NOT NULL,
+    email             TEXT NOT NULL,
+    email_verified_at DATETIME,
+    deleted_at        DATETIME,
+    version           INTEGER NOT NULL DEFAULT 1,
+    updated_at        DATETIME,
+    password_hash     TEXT NOT NULL DEFAULT '',
+    role              TEXT NOT NULL DEFAULT 'user',
+    totp_secret       TEXT NOT NULL DEFAULT '',
+    totp_enabled      NUMERIC NOT NULL DEFAULT false,
+    totp_last_step    INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+-- email уникален без учета регистра
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_ci ON users (email COLLATE NOCASE);
+
+CREATE TABLE IF NOT EXISTS friendships (
+    requester  INTEGER NOT NULL,
+    accepter   INTEGER NOT NULL,
+    status     TEXT NOT NULL DEFAULT 'accepted',
+    created_at DATETIME,
+    updated_at DATETIME,
+    PRIMARY KEY (requester, accepter),
+    CONSTRAINT fk_users_friends FOREIGN KEY (requester) REFERENCES users (id),
+    CONSTRAINT fk_users_friend_of FOREIGN KEY (accepter) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_friendships_status ON friendships (status);
+CREATE INDEX IF NOT EXISTS idx_friendships_accepter_id ON friendships (accepter);
+-- до появления индекса пары в базе могли накопиться встречные записи (a,b) и (b,a); из каждой пары
+-- остается одна. Если одна из записей принята или обе ожидают ответа (пользователи позвали друг
+-- друга), пара становится дружбой. Иначе остается запись с более значимым статусом
+-- (accepted > pending > declined > cancelled), при равенстве - более ранняя.
+UPDATE friendships SET status = 'accepted'
+WHERE EXISTS (
+    SELECT 1 FROM friendships AS r
+    WHERE r.requester = friendships.accepter AND r.accepter = friendships.requester
+      AND (r.status = 'accepted' OR friendships.status = 'accepted'
+           OR (r.status = 'pending' AND friendships.status = 'pending'))
+);
+DELETE FROM friendships
+WHERE EXISTS (
+    SELECT 1 FROM friendships AS r
+    WHERE r.requester = friendships.accepter AND r.accepter = friendships.requester
+      AND (CASE r.status WHEN 'accepted' THEN 4 WHEN 'pending' THEN 3 WHEN 'declined' THEN 2 ELSE 1 END, COALESCE(friendships.created_at, ''), friendships.requester)
+        > (CASE friendships.status WHEN 'accepted' THEN 4 WHEN 'pending' THEN 3 WHEN 'declined' THEN 2 ELSE 1 END, COALESCE(r.created_at, ''), r.requester)
+);
+-- дружба неориентирована: (1,2) и (2,1) - одна пара; min/max от двух аргументов - аналоги LEAST/GREATEST
+CREATE UNIQUE INDEX IF NOT EXISTS idx_friendships_pair ON friendships (min(requester, accepter), max(requester, accepter));
+
+CREATE TABLE IF NOT EXISTS blocks (
+    blocker    INTEGER NOT NULL,
+    blocked    INTEGER NOT NULL,
+    created_at DATETIME,
+    PRIMARY KEY (blocker, blocked),
+    CONSTRAINT fk_blocks_blocker FOREIGN KEY (blocker) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_blocks_blocked FOREIGN KEY (blocked) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_blocks_blocked_id ON blocks (blocked);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    INTEGER NOT NULL,
+    family_id  TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME,
+    created_at DATETIME,
+    CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    name         TEXT NOT NULL,
+    prefix       TEXT NOT NULL,
+    key_hash     TEXT NOT NULL,
+    scopes       TEXT NOT NULL,
+    created_by   INTEGER NOT NULL,
+    expires_at   DATETIME,
+    last_used_at DATETIME,
+    revoked_at   DATETIME,
+    created_at   DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_created_by ON api_keys (created_by);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_prefix ON api_keys (prefix);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id   INTEGER NOT NULL,
+    code_hash TEXT NOT NULL,
+    used_at   DATETIME,
+    CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS email_tokens (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    INTEGER NOT NULL,
+    purpose    TEXT NOT NULL,
+    nonce      TEXT NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at    DATETIME,
+    created_at DATETIME,
+    CONSTRAINT fk_email_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_tokens_nonce ON email_tokens (nonce);
+CREATE INDEX IF NOT EXISTS idx_email_tokens_user_id ON email_tokens (user_id);
+
+-- поисковый индекс пользователей: FTS5 с trigram-токенайзером, rowid - id пользователя.
+-- Нужна сборка mattn/go-sqlite3 с тегом sqlite_fts5.
+CREATE VIRTUAL TABLE IF NOT EXISTS user_search USING fts5(document, tokenize = 'trigram');
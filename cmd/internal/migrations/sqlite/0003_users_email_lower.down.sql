@@ -0,0 +1,3 @@
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_ci ON users (email COLLATE NOCASE);
+DROP INDEX IF EXISTS idx_users_email_lower;
+ALTER TABLE users DROP COLUMN email_lower;
@@ -0,0 +1,8 @@
+-- Уникальность email без учета регистра - по колонке email_lower, которую заполняет сервис через
+-- strings.ToLower. COLLATE NOCASE сравнивает без учета регистра только ASCII, и адреса вроде
+-- Ёж@example.com и ёж@example.com считались разными. Существующие строки заполняются lower(),
+-- которую config подключает к SQLite с правилами Unicode.
+ALTER TABLE users ADD COLUMN email_lower TEXT NOT NULL DEFAULT '';
+UPDATE users SET email_lower = LOWER(email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (email_lower);
+DROP INDEX IF EXISTS idx_users_email_ci;
@@ -1,22 +1,140 @@
 package model
 
-import "time"
+import (
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// User - пользователь. Удаление мягкое: DeletedAt скрывает запись из всех выборок GORM,
+// окончательно она удаляется фоновой очисткой по истечении срока хранения.
 type User struct {
 	ID      int64  `gorm:"primaryKey" json:"id"`
 	Name    string `gorm:"not null" json:"name"`
 	Surname string `gorm:"not null" json:"surname"`
 	Email   string `gorm:"uniqueIndex;not null" json:"email"`
+	// EmailLower - email в нижнем регистре по правилам Unicode (strings.ToLower), ключ уникальности
+	// email без учета регистра в SQL-базах. Заполняет репозиторий: LOWER() в базе может менять только ASCII.
+	EmailLower string `gorm:"uniqueIndex;not null" json:"-"`
+	// EmailVerifiedAt - когда пользователь подтвердил email по ссылке из письма, nil - не подтвержден
+	EmailVerifiedAt *time.Time     `json:"email_verified_at,omitempty"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Version - номер версии записи для оптимистичной блокировки: растет при каждом изменении
+	// видимых полей и отдается клиенту в ETag. UpdatedAt - время последнего изменения.
+	Version   int64     `gorm:"not null;default:1" json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// PasswordHash - bcrypt-хэш пароля, пустой у пользователей, созданных без регистрации
+	PasswordHash string `gorm:"column:password_hash;not null;default:''" json:"-"`
+	// Role - роль пользователя, от нее зависят права на изменение чужих аккаунтов (см. пакет policy)
+	Role Role `gorm:"not null;default:user" json:"role"`
+
+	// TOTPSecret - секрет RFC 6238 в base32. Заполняется при настройке 2FA, но действует
+	// только после подтверждения кодом (TOTPEnabled). TOTPLastStep - последний принятый
+	// временной шаг, чтобы один и тот же код нельзя было предъявить дважды.
+	TOTPSecret   string `gorm:"column:totp_secret;not null;default:''" json:"-"`
+	TOTPEnabled  bool   `gorm:"column:totp_enabled;not null;default:false" json:"two_factor_enabled"`
+	TOTPLastStep int64  `gorm:"column:totp_last_step;not null;default:0" json:"-"`
 
 	Friends  []*Friendship `gorm:"foreignKey:RequesterID"`
 	FriendOf []*Friendship `gorm:"foreignKey:AccepterID"`
 }
 
+// Role - роль пользователя.
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+// FriendshipStatus - состояние заявки в друзья.
+type FriendshipStatus string
+
+const (
+	FriendshipPending   FriendshipStatus = "pending"
+	FriendshipAccepted  FriendshipStatus = "accepted"
+	FriendshipDeclined  FriendshipStatus = "declined"
+	FriendshipCancelled FriendshipStatus = "cancelled"
+)
+
+// Friendship - заявка в друзья от Requester к Accepter. Дружбой считается только заявка в статусе accepted.
+// Значение по умолчанию accepted нужно, чтобы связи, созданные до появления статусов, остались дружбой.
 type Friendship struct {
-	RequesterID int64     `gorm:"primaryKey;column:requester"`
-	AccepterID  int64     `gorm:"primaryKey;column:accepter"`
-	CreatedAt   time.Time `gorm:"column:created_at"`
+	RequesterID int64            `gorm:"primaryKey;column:requester" json:"requester_id"`
+	AccepterID  int64            `gorm:"primaryKey;column:accepter;index" json:"accepter_id"`
+	Status      FriendshipStatus `gorm:"not null;default:accepted;index" json:"status"`
+	CreatedAt   time.Time        `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt   time.Time        `gorm:"column:updated_at" json:"updated_at"`
+
+	Requester *User `gorm:"foreignKey:RequesterID;references:ID" json:"requester,omitempty"`
+	Accepter  *User `gorm:"foreignKey:AccepterID;references:ID" json:"accepter,omitempty"`
+}
+
+// Block - пользователь Blocker заблокировал пользователя Blocked. Между ними не может быть
+// дружбы или заявок, а Blocker не показывается Blocked в рекомендациях.
+type Block struct {
+	BlockerID int64     `gorm:"primaryKey;column:blocker" json:"blocker_id"`
+	BlockedID int64     `gorm:"primaryKey;column:blocked;index" json:"blocked_id"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+
+	Blocker *User `gorm:"foreignKey:BlockerID;references:ID;constraint:OnDelete:CASCADE" json:"-"`
+	Blocked *User `gorm:"foreignKey:BlockedID;references:ID;constraint:OnDelete:CASCADE" json:"blocked,omitempty"`
+}
+
+// RefreshToken - выданный refresh-токен. Сам токен не хранится, только его SHA-256.
+// При каждом обновлении токен отзывается и заменяется новым из того же семейства FamilyID;
+// повторное предъявление отозванного токена означает утечку и отзывает все семейство.
+type RefreshToken struct {
+	ID        int64     `gorm:"primaryKey"`
+	UserID    int64     `gorm:"not null;index"`
+	FamilyID  string    `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	RevokedAt *time.Time
+	CreatedAt time.Time
+
+	User *User `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+// APIKey - ключ для доступа сервисов без пользователя. Сам ключ не хранится, только его SHA-256;
+// открытый Prefix позволяет найти ключ и опознать его в логах и списке ключей.
+// Scopes - разрешенные области доступа через запятую, например "users:read,friends:write".
+type APIKey struct {
+	ID         int64      `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null;uniqueIndex" json:"prefix"`
+	KeyHash    string     `gorm:"not null" json:"-"`
+	Scopes     string     `gorm:"not null" json:"scopes"`
+	CreatedBy  int64      `gorm:"not null;index" json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RecoveryCode - одноразовый код восстановления для входа без TOTP. Хранится только SHA-256 кода.
+type RecoveryCode struct {
+	ID       int64  `gorm:"primaryKey"`
+	UserID   int64  `gorm:"not null;index"`
+	CodeHash string `gorm:"not null"`
+	UsedAt   *time.Time
+
+	User *User `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+// EmailToken - выданный одноразовый токен из письма (подтверждение email или сброс пароля).
+// Сам токен подписан и не хранится, запись по Nonce нужна, чтобы погасить его после использования.
+type EmailToken struct {
+	ID        int64     `gorm:"primaryKey"`
+	UserID    int64     `gorm:"not null;index"`
+	Purpose   string    `gorm:"not null"`
+	Nonce     string    `gorm:"not null;uniqueIndex"`
+	Email     string    `gorm:"not null"` //адрес, на который ушло письмо; после смены email токен не действует
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
 
-	Requester *User `gorm:"foreignKey:RequesterID;references:ID"`
-	Accepter  *User `gorm:"foreignKey:AccepterID;references:ID"`
+	User *User `gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE"`
 }
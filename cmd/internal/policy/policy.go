@@ -0,0 +1,145 @@
+// Package policy решает, может ли аутентифицированный пользователь изменять данные аккаунта.
+// Обычный пользователь действует только от своего имени, администратор - от имени любого.
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"gorm.io/gorm"
+)
+
+// Action - проверяемое действие, попадает в тело ответа 403.
+type Action string
+
+const (
+	AssignRole    Action = "user.assign_role"
+	UpdateUser    Action = "user.update"
+	DeleteUser    Action = "user.delete"
+	RestoreUser   Action = "user.restore"
+	ManageFriends Action = "friendship.manage"
+	ManageBlocks  Action = "block.manage"
+	ManageAPIKeys Action = "api_key.manage"
+	ManageTOTP    Action = "two_factor.manage"
+	ManageEmail   Action = "user.email"
+	UseScope      Action = "api_key.scope"
+)
+
+var ErrForbidden = errors.New("forbidden")
+
+// Denial - отказ в доступе. Сравнивается с ErrForbidden через errors.Is.
+type Denial struct {
+	Action   Action  `json:"action"`
+	Reason   string  `json:"reason"`
+	CallerID int64   `json:"caller_id,omitempty"`
+	OwnerIDs []int64 `json:"owner_ids,omitempty"`
+	APIKey   string  `json:"api_key,omitempty"`
+	Scope    string  `json:"scope,omitempty"`
+}
+
+func (d *Denial) Error() string {
+	return fmt.Sprintf("%s: %s: %s", ErrForbidden, d.Action, d.Reason)
+}
+
+func (d *Denial) Unwrap() error {
+	return ErrForbidden
+}
+
+// Policy проверяет права вызывающего, роль которого читается из базы при каждой проверке,
+// чтобы снятие роли администратора действовало сразу, без перевыпуска токенов.
+type Policy struct {
+	Users repository.UserRepository
+}
+
+func NewPolicy(users repository.UserRepository) Policy {
+	return Policy{Users: users}
+}
+
+// Authorize разрешает действие, если вызывающий - один из владельцев owners или администратор.
+// Сервисы с API-ключом действуют от имени любого пользователя: их ограничивают области ключа (см. RequireScope).
+func (p Policy) Authorize(ctx context.Context, action Action, owners ...int64) error {
+	if _, ok := auth.APIKey(ctx); ok {
+		return nil
+	}
+	callerID, ok := auth.UserID(ctx)
+	if !ok {
+		return &Denial{Action: action, Reason: "caller is not authenticated", OwnerIDs: owners}
+	}
+	for _, owner := range owners {
+		if owner == callerID {
+			return nil
+		}
+	}
+	admin, err := p.isAdmin(ctx, callerID)
+	if err != nil {
+		return err
+	}
+	if admin {
+		return nil
+	}
+	return &Denial{Action: action, Reason: "action is allowed only on the caller's own account", CallerID: callerID, OwnerIDs: owners}
+}
+
+// RequireSelf разрешает действие только самому владельцу аккаунта: ни администратор, ни API-ключ
+// не могут действовать за него, например настраивать его второй фактор.
+func (p Policy) RequireSelf(ctx context.Context, action Action, owner int64) error {
+	if key, ok := auth.APIKey(ctx); ok {
+		return &Denial{Action: action, Reason: "only the account owner can perform this action", APIKey: key.Prefix, OwnerIDs: []int64{owner}}
+	}
+	callerID, ok := auth.UserID(ctx)
+	if !ok {
+		return &Denial{Action: action, Reason: "caller is not authenticated", OwnerIDs: []int64{owner}}
+	}
+	if callerID != owner {
+		return &Denial{Action: action, Reason: "only the account owner can perform this action", CallerID: callerID, OwnerIDs: []int64{owner}}
+	}
+	return nil
+}
+
+// RequireAdmin разрешает действие только администратору. API-ключам такие действия недоступны.
+func (p Policy) RequireAdmin(ctx context.Context, action Action) error {
+	if key, ok := auth.APIKey(ctx); ok {
+		return &Denial{Action: action, Reason: "admin role required, api keys are not allowed", APIKey: key.Prefix}
+	}
+	callerID, ok := auth.UserID(ctx)
+	if !ok {
+		return &Denial{Action: action, Reason: "caller is not authenticated"}
+	}
+	admin, err := p.isAdmin(ctx, callerID)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return &Denial{Action: action, Reason: "admin role required", CallerID: callerID}
+	}
+	return nil
+}
+
+// isAdmin считает удаленного или несуществующего вызывающего обычным пользователем.
+func (p Policy) isAdmin(ctx context.Context, callerID int64) (bool, error) {
+	if p.Users == nil {
+		return false, nil
+	}
+	caller, err := p.Users.GetUserByID(callerID, ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("Failed to check caller role: %w", err)
+	}
+	return caller.Role == model.RoleAdmin, nil
+}
+
+// RequireScope проверяет, что API-ключ, которым аутентифицирован запрос, имеет область scope.
+// Запросы пользователей проходят без проверки.
+func RequireScope(ctx context.Context, scope auth.Scope) error {
+	key, ok := auth.APIKey(ctx)
+	if !ok || key.Has(scope) {
+		return nil
+	}
+	return &Denial{Action: UseScope, Reason: "api key lacks required scope", APIKey: key.Prefix, Scope: string(scope)}
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"gorm.io/gorm"
+)
+
+// APIKeyRepository определяет контракт хранения API-ключей.
+type APIKeyRepository interface {
+	// CreateAPIKey сохраняет новый ключ.
+	CreateAPIKey(ctx context.Context, key *model.APIKey) error
+
+	// GetAPIKeyByPrefix возвращает ключ по открытому префиксу или gorm.ErrRecordNotFound.
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*model.APIKey, error)
+
+	// ListAPIKeys возвращает все ключи, включая отозванные, новые первыми.
+	ListAPIKeys(ctx context.Context) ([]model.APIKey, error)
+
+	// RevokeAPIKey отзывает ключ. Возвращает ErrAPIKeyNotFound, если действующего ключа с таким id нет.
+	RevokeAPIKey(ctx context.Context, id int64) error
+
+	// TouchAPIKey записывает время последнего использования ключа.
+	TouchAPIKey(ctx context.Context, id int64, at time.Time) error
+}
+
+// GormAPIKeyRepository — реализация APIKeyRepository на базе GORM ORM.
+type GormAPIKeyRepository struct {
+	DB *gorm.DB
+}
+
+// NewGormAPIKeyRepository создает новый экземпляр GormAPIKeyRepository.
+func NewGormAPIKeyRepository(db *gorm.DB) *GormAPIKeyRepository {
+	return &GormAPIKeyRepository{DB: db}
+}
+
+func (r *GormAPIKeyRepository) CreateAPIKey(ctx context.Context, key *model.APIKey) error {
+	return r.DB.WithContext(ctx).Create(key).Error
+}
+func (r *GormAPIKeyRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*model.APIKey, error) {
+	var key model.APIKey
+	if err := r.DB.WithContext(ctx).Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+func (r *GormAPIKeyRepository) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := r.DB.WithContext(ctx).Order("id DESC").Find(&keys).Error
+	return keys, err
+}
+func (r *GormAPIKeyRepository) RevokeAPIKey(ctx context.Context, id int64) error {
+	res := r.DB.WithContext(ctx).Model(&model.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+func (r *GormAPIKeyRepository) TouchAPIKey(ctx context.Context, id int64, at time.Time) error {
+	return r.DB.WithContext(ctx).Model(&model.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
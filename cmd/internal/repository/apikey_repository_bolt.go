@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	bolt "go.etcd.io/bbolt"
+	"gorm.io/gorm"
+)
+
+// BoltAPIKeyRepository - реализация APIKeyRepository во встроенной базе bbolt.
+type BoltAPIKeyRepository struct {
+	Store *BoltStore
+}
+
+// NewBoltAPIKeyRepository создает репозиторий API-ключей поверх хранилища store.
+func NewBoltAPIKeyRepository(store *BoltStore) *BoltAPIKeyRepository {
+	return &BoltAPIKeyRepository{Store: store}
+}
+
+func (r *BoltAPIKeyRepository) CreateAPIKey(ctx context.Context, key *model.APIKey) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		prefixes := tx.Bucket(bucketAPIKeyPrefixes)
+		if prefixes.Get([]byte(key.Prefix)) != nil {
+			return fmt.Errorf("API key prefix %q already exists", key.Prefix)
+		}
+		keys := tx.Bucket(bucketAPIKeys)
+		id, err := boltID(keys, key.ID)
+		if err != nil {
+			return err
+		}
+		stored := *key
+		stored.ID = id
+		if stored.CreatedAt.IsZero() {
+			stored.CreatedAt = time.Now()
+		}
+		if err := boltPut(keys, boltKey(id), stored); err != nil {
+			return err
+		}
+		if err := prefixes.Put([]byte(stored.Prefix), boltKey(id)); err != nil {
+			return err
+		}
+		key.ID, key.CreatedAt = stored.ID, stored.CreatedAt
+		return nil
+	})
+}
+func (r *BoltAPIKeyRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*model.APIKey, error) {
+	var key model.APIKey
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		id := tx.Bucket(bucketAPIKeyPrefixes).Get([]byte(prefix))
+		if id == nil {
+			return gorm.ErrRecordNotFound
+		}
+		_, err := boltGet(tx.Bucket(bucketAPIKeys), id, &key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+func (r *BoltAPIKeyRepository) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketAPIKeys).Cursor()
+		for k, data := c.Last(); k != nil; k, data = c.Prev() {
+			var key model.APIKey
+			if err := boltDecode(data, &key); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+func (r *BoltAPIKeyRepository) RevokeAPIKey(ctx context.Context, id int64) error {
+	return r.updateAPIKey(ctx, id, func(key *model.APIKey) error {
+		if key.RevokedAt != nil {
+			return ErrAPIKeyNotFound
+		}
+		now := time.Now()
+		key.RevokedAt = &now
+		return nil
+	}, ErrAPIKeyNotFound)
+}
+func (r *BoltAPIKeyRepository) TouchAPIKey(ctx context.Context, id int64, at time.Time) error {
+	return r.updateAPIKey(ctx, id, func(key *model.APIKey) error {
+		key.LastUsedAt = &at
+		return nil
+	}, nil)
+}
+
+// updateAPIKey меняет ключ функцией change и сохраняет его. Если ключа нет, возвращает notFound
+func (r *BoltAPIKeyRepository) updateAPIKey(ctx context.Context, id int64, change func(*model.APIKey) error, notFound error) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		keys := tx.Bucket(bucketAPIKeys)
+		var key model.APIKey
+		found, err := boltGet(keys, boltKey(id), &key)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return notFound
+		}
+		if err := change(&key); err != nil {
+			return err
+		}
+		return boltPut(keys, boltKey(id), key)
+	})
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"gorm.io/gorm"
+)
+
+// MemoryAPIKeyRepository - реализация APIKeyRepository в памяти процесса.
+type MemoryAPIKeyRepository struct {
+	Store *MemoryStore
+}
+
+// NewMemoryAPIKeyRepository создает репозиторий API-ключей поверх хранилища store.
+func NewMemoryAPIKeyRepository(store *MemoryStore) *MemoryAPIKeyRepository {
+	return &MemoryAPIKeyRepository{Store: store}
+}
+
+func (r *MemoryAPIKeyRepository) CreateAPIKey(ctx context.Context, key *model.APIKey) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		if _, taken := s.apiKeyPrefixes[key.Prefix]; taken {
+			return fmt.Errorf("API key prefix %q already exists", key.Prefix)
+		}
+		key.ID = s.nextID("api_keys", key.ID)
+		if key.CreatedAt.IsZero() {
+			key.CreatedAt = time.Now()
+		}
+		s.apiKeys[key.ID] = *key
+		s.apiKeyPrefixes[key.Prefix] = key.ID
+		return nil
+	})
+}
+func (r *MemoryAPIKeyRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*model.APIKey, error) {
+	var key model.APIKey
+	err := r.Store.read(ctx, func() error {
+		id, ok := r.Store.apiKeyPrefixes[prefix]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		key = r.Store.apiKeys[id]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+func (r *MemoryAPIKeyRepository) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := r.Store.read(ctx, func() error {
+		keys = slices.SortedFunc(maps.Values(r.Store.apiKeys), func(a, b model.APIKey) int {
+			return cmp.Compare(b.ID, a.ID)
+		})
+		return nil
+	})
+	return keys, err
+}
+func (r *MemoryAPIKeyRepository) RevokeAPIKey(ctx context.Context, id int64) error {
+	return r.updateAPIKey(ctx, id, func(key *model.APIKey) error {
+		if key.RevokedAt != nil {
+			return ErrAPIKeyNotFound
+		}
+		now := time.Now()
+		key.RevokedAt = &now
+		return nil
+	}, ErrAPIKeyNotFound)
+}
+func (r *MemoryAPIKeyRepository) TouchAPIKey(ctx context.Context, id int64, at time.Time) error {
+	return r.updateAPIKey(ctx, id, func(key *model.APIKey) error {
+		key.LastUsedAt = &at
+		return nil
+	}, nil)
+}
+
+// updateAPIKey меняет ключ функцией change и сохраняет его. Если ключа нет, возвращает notFound
+func (r *MemoryAPIKeyRepository) updateAPIKey(ctx context.Context, id int64, change func(*model.APIKey) error, notFound error) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		key, ok := s.apiKeys[id]
+		if !ok {
+			return notFound
+		}
+		if err := change(&key); err != nil {
+			return err
+		}
+		s.apiKeys[id] = key
+		return nil
+	})
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"gorm.io/gorm"
+)
+
+// BlockUser сохраняет блокировку и удаляет дружбу и заявки между пользователями. Повторную блокировку
+// отсекает первичный ключ (ErrBlockExists), несуществующего пользователя - внешний ключ (ErrUserNotFound).
+func (r *GormFriendRepository) BlockUser(ctx context.Context, block *model.Block) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(block).Error; err != nil {
+			return translateConstraint(tx, err, ErrBlockExists, ErrUserNotFound)
+		}
+		if err := requireActiveUsers(tx, block.BlockerID, block.BlockedID); err != nil {
+			return err
+		}
+		a, b := block.BlockerID, block.BlockedID
+		return tx.Where("(requester = ? AND accepter = ?) OR (requester = ? AND accepter = ?)", a, b, b, a).
+			Delete(&model.Friendship{}).Error
+	})
+}
+func (r *GormFriendRepository) UnblockUser(ctx context.Context, block *model.Block) error {
+	res := r.DB.WithContext(ctx).
+		Where("blocker = ? AND blocked = ?", block.BlockerID, block.BlockedID).
+		Delete(&model.Block{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrBlockNotFound
+	}
+	return nil
+}
+func (r *GormFriendRepository) GetBlockedUsers(ctx context.Context, user int64) ([]model.Block, error) {
+	var blocks []model.Block
+	err := r.DB.WithContext(ctx).Preload("Blocked").
+		Joins("JOIN users ON users.id = blocks.blocked AND users.deleted_at IS NULL").
+		Where("blocks.blocker = ?", user).
+		Order("blocks.created_at DESC").
+		Find(&blocks).Error
+	return blocks, err
+}
+func (r *GormFriendRepository) IsBlocked(ctx context.Context, user, other int64) (bool, error) {
+	var count int64
+	err := r.DB.WithContext(ctx).Model(&model.Block{}).
+		Where("(blocker = ? AND blocked = ?) OR (blocker = ? AND blocked = ?)", user, other, other, user).
+		Count(&count).Error
+	return count > 0, err
+}
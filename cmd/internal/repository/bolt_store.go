@@ -0,0 +1,411 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltStore - все данные сервиса во встроенной key-value базе bbolt: один файл, чистый Go, без сервера и cgo.
+// Записи хранятся в gob, а не в JSON, потому что JSON-теги моделей скрывают от API нужные хранилищу поля
+// (хэш пароля, секрет TOTP, время удаления). Ограничения схемы БД поддерживаются вторичными индексами,
+// которые меняются в той же транзакции bbolt, что и сами записи: уникальность email без учета регистра,
+// одна связь на пару пользователей и связи обоих участников, каскадное удаление при очистке.
+// Транзакции на запись в bbolt выполняются по одной, на чтение - параллельно.
+type BoltStore struct {
+	DB *bolt.DB
+}
+
+var (
+	// users: id -> User, последовательность бакета выдает id новых пользователей
+	bucketUsers = []byte("users")
+	// user_emails: email в нижнем регистре -> id, в том числе у мягко удаленных, как уникальный индекс в БД
+	bucketUserEmails = []byte("user_emails")
+	// friendships: неупорядоченная пара (меньший id, больший id) -> Friendship, направление хранится в самой связи
+	bucketFriendships = []byte("friendships")
+	// user_friendships: (id, id другого участника) -> пусто, по записи на каждого участника связи
+	bucketUserFriendships = []byte("user_friendships")
+	// blocks: (blocker, blocked) -> Block
+	bucketBlocks = []byte("blocks")
+	// blocked_by: (blocked, blocker) -> пусто
+	bucketBlockedBy = []byte("blocked_by")
+	// refresh_tokens: (user_id, id) -> RefreshToken
+	bucketRefreshTokens = []byte("refresh_tokens")
+	// refresh_token_hashes: хэш токена -> ключ в refresh_tokens
+	bucketRefreshTokenHashes = []byte("refresh_token_hashes")
+	// recovery_codes: (user_id, id) -> RecoveryCode
+	bucketRecoveryCodes = []byte("recovery_codes")
+	// email_tokens: (user_id, id) -> EmailToken
+	bucketEmailTokens = []byte("email_tokens")
+	// email_token_nonces: nonce -> ключ в email_tokens
+	bucketEmailTokenNonces = []byte("email_token_nonces")
+	// api_keys: id -> APIKey
+	bucketAPIKeys = []byte("api_keys")
+	// api_key_prefixes: открытый префикс -> id
+	bucketAPIKeyPrefixes = []byte("api_key_prefixes")
+)
+
+var boltBuckets = [][]byte{
+	bucketUsers, bucketUserEmails, bucketFriendships, bucketUserFriendships, bucketBlocks, bucketBlockedBy,
+	bucketRefreshTokens, bucketRefreshTokenHashes, bucketRecoveryCodes, bucketEmailTokens, bucketEmailTokenNonces,
+	bucketAPIKeys, bucketAPIKeyPrefixes,
+}
+
+// OpenBoltStore открывает (или создает) файл базы bbolt и недостающие бакеты. Файл открывает только один
+// процесс: если он уже занят, через секунду ожидания возвращается ошибка.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range boltBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to create buckets: %w", err)
+	}
+	return &BoltStore{DB: db}, nil
+}
+
+// Close закрывает файл базы.
+func (s *BoltStore) Close() error {
+	return s.DB.Close()
+}
+
+// view выполняет fn в транзакции на чтение, если контекст еще не отменен
+func (s *BoltStore) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.DB.View(fn)
+}
+
+// update выполняет fn в транзакции на запись: ошибка fn откатывает все ее изменения
+func (s *BoltStore) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.DB.Update(fn)
+}
+
+// boltKey - ключ из id в big-endian, чтобы порядок ключей в бакете совпадал с порядком id,
+// а составные ключи с общим первым id шли подряд и читались по префиксу
+func boltKey(ids ...int64) []byte {
+	key := make([]byte, 0, 8*len(ids))
+	for _, id := range ids {
+		key = binary.BigEndian.AppendUint64(key, uint64(id))
+	}
+	return key
+}
+
+// boltKeyID возвращает i-й id составного ключа
+func boltKeyID(key []byte, i int) int64 {
+	return int64(binary.BigEndian.Uint64(key[8*i:]))
+}
+
+// boltID назначает записи id из последовательности бакета, если он не задан, а заданный явно id
+// сдвигает последовательность, чтобы следующие записи его не повторили
+func boltID(b *bolt.Bucket, id int64) (int64, error) {
+	if id == 0 {
+		seq, err := b.NextSequence()
+		return int64(seq), err
+	}
+	if uint64(id) > b.Sequence() {
+		return id, b.SetSequence(uint64(id))
+	}
+	return id, nil
+}
+
+// boltPut сохраняет значение v под ключом key
+func boltPut(b *bolt.Bucket, key []byte, v any) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return fmt.Errorf("Failed to encode %T: %w", v, err)
+	}
+	return b.Put(key, buf.Bytes())
+}
+
+// boltGet читает значение по ключу key в v и сообщает, было ли оно
+func boltGet(b *bolt.Bucket, key []byte, v any) (bool, error) {
+	data := b.Get(key)
+	if data == nil {
+		return false, nil
+	}
+	return true, boltDecode(data, v)
+}
+
+// boltDecode декодирует значение из бакета в v
+func boltDecode(data []byte, v any) error {
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(v); err != nil {
+		return fmt.Errorf("Failed to decode %T: %w", v, err)
+	}
+	return nil
+}
+
+// boltEach вызывает fn для каждой записи бакета, ключ которой начинается с prefix, по порядку ключей
+func boltEach[T any](b *bolt.Bucket, prefix []byte, fn func(key []byte, v T) error) error {
+	c := b.Cursor()
+	for k, data := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, data = c.Next() {
+		var v T
+		if err := boltDecode(data, &v); err != nil {
+			return err
+		}
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boltDeletePrefix удаляет из бакета все ключи, начинающиеся с prefix
+func boltDeletePrefix(b *bolt.Bucket, prefix []byte) error {
+	var keys [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, bytes.Clone(k))
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boltUser возвращает пользователя по id, включая мягко удаленных
+func boltUser(tx *bolt.Tx, id int64) (model.User, bool, error) {
+	var user model.User
+	found, err := boltGet(tx.Bucket(bucketUsers), boltKey(id), &user)
+	return user, found, err
+}
+
+// boltActiveUser возвращает пользователя, если он есть и не удален мягко
+func boltActiveUser(tx *bolt.Tx, id int64) (model.User, bool, error) {
+	user, found, err := boltUser(tx, id)
+	if err != nil || !found || user.DeletedAt.Valid {
+		return model.User{}, false, err
+	}
+	return user, true, nil
+}
+
+// boltPutUser сохраняет пользователя без связей
+func boltPutUser(tx *bolt.Tx, user model.User) error {
+	user.Friends, user.FriendOf = nil, nil
+	return boltPut(tx.Bucket(bucketUsers), boltKey(user.ID), user)
+}
+
+// boltUsers возвращает всех пользователей, включая мягко удаленных, по возрастанию id
+func boltUsers(tx *bolt.Tx) ([]model.User, error) {
+	var users []model.User
+	err := boltEach(tx.Bucket(bucketUsers), nil, func(_ []byte, user model.User) error {
+		users = append(users, user)
+		return nil
+	})
+	return users, err
+}
+
+// boltRequireUsers проверяет ссылки новой связи: несуществующий и мягко удаленный пользователь - ErrUserNotFound
+func boltRequireUsers(tx *bolt.Tx, ids ...int64) error {
+	for _, id := range ids {
+		_, ok, err := boltActiveUser(tx, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrUserNotFound
+		}
+	}
+	return nil
+}
+
+// boltFriendship возвращает связь между пользователями в любом направлении
+func boltFriendship(tx *bolt.Tx, a, b int64) (model.Friendship, bool, error) {
+	var friendship model.Friendship
+	pair := pairOf(a, b)
+	found, err := boltGet(tx.Bucket(bucketFriendships), boltKey(pair[0], pair[1]), &friendship)
+	return friendship, found, err
+}
+
+// boltPutFriendship сохраняет связь вместе с записями индекса обоих участников
+func boltPutFriendship(tx *bolt.Tx, friendship model.Friendship) error {
+	friendship.Requester, friendship.Accepter = nil, nil
+	pair := pairOf(friendship.RequesterID, friendship.AccepterID)
+	if err := boltPut(tx.Bucket(bucketFriendships), boltKey(pair[0], pair[1]), friendship); err != nil {
+		return err
+	}
+	index := tx.Bucket(bucketUserFriendships)
+	if err := index.Put(boltKey(pair[0], pair[1]), nil); err != nil {
+		return err
+	}
+	return index.Put(boltKey(pair[1], pair[0]), nil)
+}
+
+// boltDeleteFriendship удаляет связь между пользователями вместе с записями индекса
+func boltDeleteFriendship(tx *bolt.Tx, a, b int64) error {
+	pair := pairOf(a, b)
+	if err := tx.Bucket(bucketFriendships).Delete(boltKey(pair[0], pair[1])); err != nil {
+		return err
+	}
+	index := tx.Bucket(bucketUserFriendships)
+	if err := index.Delete(boltKey(pair[0], pair[1])); err != nil {
+		return err
+	}
+	return index.Delete(boltKey(pair[1], pair[0]))
+}
+
+// boltFriendships вызывает fn для каждой связи пользователя в любом направлении и любом статусе
+// вместе с id второго участника, по возрастанию этого id
+func boltFriendships(tx *bolt.Tx, user int64, fn func(other int64, friendship model.Friendship) error) error {
+	c := tx.Bucket(bucketUserFriendships).Cursor()
+	prefix := boltKey(user)
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		other := boltKeyID(k, 1)
+		friendship, found, err := boltFriendship(tx, user, other)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("friendship index of user %d points to missing friendship with %d", user, other)
+		}
+		if err := fn(other, friendship); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boltFriendIDs возвращает id не удаленных друзей пользователя по возрастанию
+func boltFriendIDs(tx *bolt.Tx, user int64) ([]int64, error) {
+	var ids []int64
+	err := boltFriendships(tx, user, func(other int64, f model.Friendship) error {
+		if f.Status != model.FriendshipAccepted {
+			return nil
+		}
+		_, active, err := boltActiveUser(tx, other)
+		if active {
+			ids = append(ids, other)
+		}
+		return err
+	})
+	return ids, err
+}
+
+// boltIsBlocked сообщает, заблокировал ли кто-то из двух пользователей другого
+func boltIsBlocked(tx *bolt.Tx, user, other int64) bool {
+	blocks := tx.Bucket(bucketBlocks)
+	return blocks.Get(boltKey(user, other)) != nil || blocks.Get(boltKey(other, user)) != nil
+}
+
+// boltPurgeUser окончательно удаляет пользователя со всеми ссылающимися на него записями
+func boltPurgeUser(tx *bolt.Tx, user model.User) error {
+	var others []int64
+	err := boltFriendships(tx, user.ID, func(other int64, _ model.Friendship) error {
+		others = append(others, other)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		if err := boltDeleteFriendship(tx, user.ID, other); err != nil {
+			return err
+		}
+	}
+	if err := boltUnblockAll(tx, user.ID); err != nil {
+		return err
+	}
+	err = boltEach(tx.Bucket(bucketRefreshTokens), boltKey(user.ID), func(_ []byte, t model.RefreshToken) error {
+		return tx.Bucket(bucketRefreshTokenHashes).Delete([]byte(t.TokenHash))
+	})
+	if err != nil {
+		return err
+	}
+	err = boltEach(tx.Bucket(bucketEmailTokens), boltKey(user.ID), func(_ []byte, t model.EmailToken) error {
+		return tx.Bucket(bucketEmailTokenNonces).Delete([]byte(t.Nonce))
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range [][]byte{bucketRefreshTokens, bucketRecoveryCodes, bucketEmailTokens} {
+		if err := boltDeletePrefix(tx.Bucket(name), boltKey(user.ID)); err != nil {
+			return err
+		}
+	}
+	if err := boltDeleteAPIKeys(tx, user.ID); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketUserEmails).Delete([]byte(emailKey(user.Email))); err != nil {
+		return err
+	}
+	return tx.Bucket(bucketUsers).Delete(boltKey(user.ID))
+}
+
+// boltDeleteAPIKeys удаляет API-ключи, выпущенные пользователем. Ключи хранятся по id, поэтому
+// их приходится перебирать все; очистка идет в фоне, и ключей немного.
+func boltDeleteAPIKeys(tx *bolt.Tx, user int64) error {
+	keys, prefixes := tx.Bucket(bucketAPIKeys), tx.Bucket(bucketAPIKeyPrefixes)
+	var owned []model.APIKey
+	err := keys.ForEach(func(_, data []byte) error {
+		var key model.APIKey
+		if err := boltDecode(data, &key); err != nil {
+			return err
+		}
+		if key.CreatedBy == user {
+			owned = append(owned, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range owned {
+		if err := prefixes.Delete([]byte(key.Prefix)); err != nil {
+			return err
+		}
+		if err := keys.Delete(boltKey(key.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boltUnblockAll удаляет все блокировки, где участвует пользователь, в обе стороны
+func boltUnblockAll(tx *bolt.Tx, user int64) error {
+	blocks, blockedBy := tx.Bucket(bucketBlocks), tx.Bucket(bucketBlockedBy)
+	var blockers []int64
+	c := blockedBy.Cursor()
+	for k, _ := c.Seek(boltKey(user)); k != nil && bytes.HasPrefix(k, boltKey(user)); k, _ = c.Next() {
+		blockers = append(blockers, boltKeyID(k, 1))
+	}
+	for _, blocker := range blockers {
+		if err := blocks.Delete(boltKey(blocker, user)); err != nil {
+			return err
+		}
+	}
+	var blocked []int64
+	c = blocks.Cursor()
+	for k, _ := c.Seek(boltKey(user)); k != nil && bytes.HasPrefix(k, boltKey(user)); k, _ = c.Next() {
+		blocked = append(blocked, boltKeyID(k, 1))
+	}
+	for _, id := range blocked {
+		if err := blockedBy.Delete(boltKey(id, user)); err != nil {
+			return err
+		}
+	}
+	if err := boltDeletePrefix(blocks, boltKey(user)); err != nil {
+		return err
+	}
+	return boltDeletePrefix(blockedBy, boltKey(user))
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// translateConstraint переводит нарушение ограничения БД в ошибку домена: нарушение уникальности
+// (Postgres 23505, SQLite UNIQUE/PRIMARY KEY) - в onDuplicate, нарушение внешнего ключа
+// (Postgres 23503, SQLite FOREIGN KEY) - в onMissingRef. Коды разбирает диалект GORM, поэтому
+// репозиторию не нужны типы ошибок конкретных драйверов. Нулевая ошибка-замена оставляет err как есть.
+func translateConstraint(db *gorm.DB, err error, onDuplicate, onMissingRef error) error {
+	if err == nil {
+		return nil
+	}
+	translated := err
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		//диалект распознает только ошибку драйвера, поэтому ищем ее по всей цепочке обертки
+		for e := err; e != nil; e = errors.Unwrap(e) {
+			if t := translator.Translate(e); errors.Is(t, gorm.ErrDuplicatedKey) || errors.Is(t, gorm.ErrForeignKeyViolated) {
+				translated = t
+				break
+			}
+		}
+	}
+	switch {
+	case onDuplicate != nil && errors.Is(translated, gorm.ErrDuplicatedKey):
+		return onDuplicate
+	case onMissingRef != nil && errors.Is(translated, gorm.ErrForeignKeyViolated):
+		return onMissingRef
+	}
+	return err
+}
+
+// emailConstraintNames - как нарушение уникальности email называют драйверы: Postgres пишет имя
+// индекса (idx_users_email, idx_users_email_lower), SQLite - колонку (users.email, users.email_lower)
+var emailConstraintNames = []string{"idx_users_email", "users.email"}
+
+// translateEmailConstraint переводит в ErrEmailExists только нарушение уникальности email.
+// Нарушения других уникальных ограничений users (например, первичного ключа) возвращаются как есть.
+func translateEmailConstraint(db *gorm.DB, err error) error {
+	if err == nil || !slices.ContainsFunc(emailConstraintNames, func(name string) bool {
+		return strings.Contains(err.Error(), name)
+	}) {
+		return err
+	}
+	return translateConstraint(db, err, ErrEmailExists, nil)
+}
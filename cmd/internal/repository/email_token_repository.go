@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"gorm.io/gorm"
+)
+
+// EmailTokenRepository определяет контракт хранения одноразовых токенов из писем
+// и действий, которые выполняются при их погашении.
+type EmailTokenRepository interface {
+	// CreateEmailToken сохраняет новый токен и гасит прежние неиспользованные токены
+	// того же пользователя и назначения, чтобы действовала только последняя ссылка.
+	CreateEmailToken(ctx context.Context, token *model.EmailToken) error
+
+	// VerifyEmail погашает токен подтверждения и отмечает email пользователя подтвержденным.
+	// Возвращает ErrInvalidToken, если токен уже использован, погашен, принадлежит другому пользователю
+	// или выдан на адрес, который уже не совпадает с email пользователя.
+	VerifyEmail(ctx context.Context, userID int64, nonce string, at time.Time) error
+
+	// ResetPassword погашает токен сброса, меняет хэш пароля и отзывает все refresh-токены пользователя.
+	// Ссылка пришла на email, поэтому он тоже считается подтвержденным; токен, выданный на прежний
+	// адрес, не действует.
+	ResetPassword(ctx context.Context, userID int64, nonce string, passwordHash string, at time.Time) error
+}
+
+// GormEmailTokenRepository — реализация EmailTokenRepository на базе GORM ORM.
+type GormEmailTokenRepository struct {
+	DB *gorm.DB
+}
+
+// NewGormEmailTokenRepository создает новый экземпляр GormEmailTokenRepository.
+func NewGormEmailTokenRepository(db *gorm.DB) *GormEmailTokenRepository {
+	return &GormEmailTokenRepository{DB: db}
+}
+
+func (r *GormEmailTokenRepository) CreateEmailToken(ctx context.Context, token *model.EmailToken) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.EmailToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserID, token.Purpose).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+func (r *GormEmailTokenRepository) VerifyEmail(ctx context.Context, userID int64, nonce string, at time.Time) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := consumeEmailToken(tx, userID, auth.PurposeVerifyEmail, nonce, at); err != nil {
+			return err
+		}
+		return tx.Model(&model.User{}).Where("id = ?", userID).
+			Updates(map[string]any{"email_verified_at": at, "version": nextVersion}).Error
+	})
+}
+func (r *GormEmailTokenRepository) ResetPassword(ctx context.Context, userID int64, nonce string, passwordHash string, at time.Time) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := consumeEmailToken(tx, userID, auth.PurposePasswordReset, nonce, at); err != nil {
+			return err
+		}
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).
+			Update("password_hash", passwordHash).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.User{}).Where("id = ? AND email_verified_at IS NULL", userID).
+			Updates(map[string]any{"email_verified_at": at, "version": nextVersion}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", at).Error
+	})
+}
+
+// consumeEmailToken помечает токен использованным, только если он еще действует и выдан
+// на текущий email пользователя
+func consumeEmailToken(tx *gorm.DB, userID int64, purpose auth.Purpose, nonce string, at time.Time) error {
+	res := tx.Model(&model.EmailToken{}).
+		Where("nonce = ? AND user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", nonce, userID, purpose, at).
+		Where("email = (?)", tx.Model(&model.User{}).Select("email").Where("id = ?", userID)).
+		Update("used_at", at)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// revokeEmailTokens гасит неиспользованные токены пользователя, выданные не на адрес email:
+// после смены email ссылки из писем на прежний адрес перестают действовать
+func revokeEmailTokens(tx *gorm.DB, userID int64, email string, at time.Time) error {
+	return tx.Model(&model.EmailToken{}).
+		Where("user_id = ? AND used_at IS NULL AND email <> ?", userID, email).
+		Update("used_at", at).Error
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltEmailTokenRepository - реализация EmailTokenRepository во встроенной базе bbolt.
+type BoltEmailTokenRepository struct {
+	Store *BoltStore
+}
+
+// NewBoltEmailTokenRepository создает репозиторий токенов из писем поверх хранилища store.
+func NewBoltEmailTokenRepository(store *BoltStore) *BoltEmailTokenRepository {
+	return &BoltEmailTokenRepository{Store: store}
+}
+
+func (r *BoltEmailTokenRepository) CreateEmailToken(ctx context.Context, token *model.EmailToken) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		tokens, nonces := tx.Bucket(bucketEmailTokens), tx.Bucket(bucketEmailTokenNonces)
+		if nonces.Get([]byte(token.Nonce)) != nil {
+			return fmt.Errorf("email token nonce already exists")
+		}
+		if _, found, err := boltUser(tx, token.UserID); err != nil {
+			return err
+		} else if !found {
+			return ErrUserNotFound
+		}
+		now := time.Now()
+		var superseded []model.EmailToken
+		err := boltEach(tokens, boltKey(token.UserID), func(_ []byte, t model.EmailToken) error {
+			if t.Purpose == token.Purpose && t.UsedAt == nil {
+				t.UsedAt = &now
+				superseded = append(superseded, t)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, t := range superseded {
+			if err := boltPut(tokens, boltKey(t.UserID, t.ID), t); err != nil {
+				return err
+			}
+		}
+		id, err := boltID(tokens, token.ID)
+		if err != nil {
+			return err
+		}
+		stored := *token
+		stored.ID, stored.User = id, nil
+		if stored.CreatedAt.IsZero() {
+			stored.CreatedAt = now
+		}
+		key := boltKey(stored.UserID, id)
+		if err := boltPut(tokens, key, stored); err != nil {
+			return err
+		}
+		if err := nonces.Put([]byte(stored.Nonce), key); err != nil {
+			return err
+		}
+		token.ID, token.CreatedAt = stored.ID, stored.CreatedAt
+		return nil
+	})
+}
+func (r *BoltEmailTokenRepository) VerifyEmail(ctx context.Context, userID int64, nonce string, at time.Time) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		if err := boltConsumeEmailToken(tx, userID, auth.PurposeVerifyEmail, nonce, at); err != nil {
+			return err
+		}
+		return boltUpdateUser(tx, userID, func(user *model.User) error {
+			user.EmailVerifiedAt = &at
+			user.Version++
+			return nil
+		}, nil)
+	})
+}
+func (r *BoltEmailTokenRepository) ResetPassword(ctx context.Context, userID int64, nonce string, passwordHash string, at time.Time) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		if err := boltConsumeEmailToken(tx, userID, auth.PurposePasswordReset, nonce, at); err != nil {
+			return err
+		}
+		err := boltUpdateUser(tx, userID, func(user *model.User) error {
+			user.PasswordHash = passwordHash
+			if user.EmailVerifiedAt == nil {
+				user.EmailVerifiedAt = &at
+				user.Version++
+			}
+			return nil
+		}, nil)
+		if err != nil {
+			return err
+		}
+		return boltRevokeRefreshTokens(tx, boltKey(userID), at, func(model.RefreshToken) bool { return true })
+	})
+}
+
+// boltConsumeEmailToken помечает токен использованным, только если он еще действует и выдан
+// на текущий email пользователя
+func boltConsumeEmailToken(tx *bolt.Tx, userID int64, purpose auth.Purpose, nonce string, at time.Time) error {
+	key := tx.Bucket(bucketEmailTokenNonces).Get([]byte(nonce))
+	if key == nil || boltKeyID(key, 0) != userID {
+		return ErrInvalidToken
+	}
+	tokens := tx.Bucket(bucketEmailTokens)
+	var token model.EmailToken
+	if _, err := boltGet(tokens, key, &token); err != nil {
+		return err
+	}
+	if token.Purpose != string(purpose) || token.UsedAt != nil || !token.ExpiresAt.After(at) {
+		return ErrInvalidToken
+	}
+	user, found, err := boltUser(tx, userID)
+	if err != nil {
+		return err
+	}
+	if !found || user.Email != token.Email {
+		return ErrInvalidToken
+	}
+	token.UsedAt = &at
+	return boltPut(tokens, key, token)
+}
+
+// boltRevokeEmailTokens гасит неиспользованные токены пользователя, выданные не на адрес email
+func boltRevokeEmailTokens(tx *bolt.Tx, userID int64, email string, at time.Time) error {
+	tokens := tx.Bucket(bucketEmailTokens)
+	var revoked []model.EmailToken
+	err := boltEach(tokens, boltKey(userID), func(_ []byte, t model.EmailToken) error {
+		if t.UsedAt == nil && t.Email != email {
+			t.UsedAt = &at
+			revoked = append(revoked, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, t := range revoked {
+		if err := boltPut(tokens, boltKey(t.UserID, t.ID), t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
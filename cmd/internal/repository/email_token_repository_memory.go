@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+)
+
+// MemoryEmailTokenRepository - реализация EmailTokenRepository в памяти процесса.
+type MemoryEmailTokenRepository struct {
+	Store *MemoryStore
+}
+
+// NewMemoryEmailTokenRepository создает репозиторий токенов из писем поверх хранилища store.
+func NewMemoryEmailTokenRepository(store *MemoryStore) *MemoryEmailTokenRepository {
+	return &MemoryEmailTokenRepository{Store: store}
+}
+
+func (r *MemoryEmailTokenRepository) CreateEmailToken(ctx context.Context, token *model.EmailToken) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		if _, taken := s.emailNonces[token.Nonce]; taken {
+			return fmt.Errorf("email token nonce already exists")
+		}
+		if _, ok := s.users[token.UserID]; !ok {
+			return ErrUserNotFound
+		}
+		now := time.Now()
+		for id, t := range s.emailTokens {
+			if t.UserID == token.UserID && t.Purpose == token.Purpose && t.UsedAt == nil {
+				t.UsedAt = &now
+				s.emailTokens[id] = t
+			}
+		}
+		token.ID = s.nextID("email_tokens", token.ID)
+		if token.CreatedAt.IsZero() {
+			token.CreatedAt = now
+		}
+		stored := *token
+		stored.User = nil
+		s.emailTokens[stored.ID] = stored
+		s.emailNonces[stored.Nonce] = stored.ID
+		return nil
+	})
+}
+func (r *MemoryEmailTokenRepository) VerifyEmail(ctx context.Context, userID int64, nonce string, at time.Time) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		if err := s.checkEmailToken(userID, auth.PurposeVerifyEmail, nonce, at); err != nil {
+			return err
+		}
+		err := s.updateUser(userID, func(user *model.User) error {
+			user.EmailVerifiedAt = &at
+			user.Version++
+			return nil
+		}, nil)
+		if err != nil {
+			return err
+		}
+		s.consumeEmailToken(nonce, at)
+		return nil
+	})
+}
+func (r *MemoryEmailTokenRepository) ResetPassword(ctx context.Context, userID int64, nonce string, passwordHash string, at time.Time) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		if err := s.checkEmailToken(userID, auth.PurposePasswordReset, nonce, at); err != nil {
+			return err
+		}
+		err := s.updateUser(userID, func(user *model.User) error {
+			user.PasswordHash = passwordHash
+			if user.EmailVerifiedAt == nil {
+				user.EmailVerifiedAt = &at
+				user.Version++
+			}
+			return nil
+		}, nil)
+		if err != nil {
+			return err
+		}
+		s.consumeEmailToken(nonce, at)
+		s.revokeRefreshTokens(at, func(t model.RefreshToken) bool { return t.UserID == userID })
+		return nil
+	})
+}
+
+// checkEmailToken проверяет, что токен выдан пользователю для purpose на его текущий email и еще действует. Погашает его
+// consumeEmailToken - после всех проверок, чтобы ошибка не оставила токен погашенным.
+func (s *MemoryStore) checkEmailToken(userID int64, purpose auth.Purpose, nonce string, at time.Time) error {
+	id, ok := s.emailNonces[nonce]
+	if !ok {
+		return ErrInvalidToken
+	}
+	token := s.emailTokens[id]
+	if token.UserID != userID || token.Purpose != string(purpose) || token.UsedAt != nil || !token.ExpiresAt.After(at) {
+		return ErrInvalidToken
+	}
+	if user, ok := s.users[userID]; !ok || user.Email != token.Email {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// consumeEmailToken помечает токен, проверенный checkEmailToken, использованным
+func (s *MemoryStore) consumeEmailToken(nonce string, at time.Time) {
+	id := s.emailNonces[nonce]
+	token := s.emailTokens[id]
+	token.UsedAt = &at
+	s.emailTokens[id] = token
+}
+
+// revokeEmailTokens гасит неиспользованные токены пользователя, выданные не на адрес email
+func (s *MemoryStore) revokeEmailTokens(userID int64, email string, at time.Time) {
+	for id, t := range s.emailTokens {
+		if t.UserID == userID && t.UsedAt == nil && t.Email != email {
+			t.UsedAt = &at
+			s.emailTokens[id] = t
+		}
+	}
+}
@@ -2,6 +2,9 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"time"
 
 	"github.com/UnendingLoop/users-api/cmd/internal/model"
 	"gorm.io/gorm"
@@ -13,11 +16,62 @@ type FriendRepository interface {
 	// AddFriend создает новую связь дружбы между двумя пользователями.
 	AddFriend(ctx context.Context, friendship *model.Friendship) error
 
-	// RemoveFriend удаляет существующую связь дружбы между двумя пользователями.
+	// RemoveFriend удаляет принятую дружбу между двумя пользователями независимо от того,
+	// кто из них отправлял заявку. Если дружбы нет, возвращает ErrFriendshipNotFound.
 	RemoveFriend(ctx context.Context, friendship *model.Friendship) error
 
-	// GetFriends возвращает список пользователей, являющихся друзьями указанного пользователя.
+	// GetFriends возвращает список пользователей, являющихся друзьями указанного пользователя,
+	// независимо от того, кто из них отправлял заявку.
 	GetFriends(ctx context.Context, user int64) ([]model.User, error)
+
+	// GetMutualFriends возвращает страницу общих друзей двух пользователей, упорядоченных по id,
+	// и общее количество общих друзей.
+	GetMutualFriends(ctx context.Context, user, other int64, limit, offset int) ([]model.User, int64, error)
+
+	// GetSuggestions возвращает друзей друзей пользователя, которые еще не являются его друзьями,
+	// не состоят с ним в ожидающей заявке и не блокировали его (и не заблокированы им),
+	// по убыванию количества общих друзей.
+	GetSuggestions(ctx context.Context, user int64, limit, offset int) ([]FriendSuggestion, error)
+
+	// GetFriendIDs возвращает id друзей для каждого из переданных пользователей.
+	GetFriendIDs(ctx context.Context, users []int64) (map[int64][]int64, error)
+
+	// GetFriendship возвращает связь между requester и accepter в любом статусе или gorm.ErrRecordNotFound.
+	GetFriendship(ctx context.Context, requester, accepter int64) (*model.Friendship, error)
+
+	// SetFriendshipStatus переводит связь из статуса from в статус to.
+	// Если связи в статусе from нет, возвращает ErrFriendRequestNotFound.
+	SetFriendshipStatus(ctx context.Context, friendship *model.Friendship, from, to model.FriendshipStatus) error
+
+	// ReverseFriendRequest превращает встречную связь accepter -> requester в статусе from (отклоненную
+	// или отозванную заявку) в новую ожидающую заявку requester -> accepter: у пары остается одна запись.
+	// Если встречной связи в статусе from нет, возвращает ErrFriendRequestNotFound.
+	ReverseFriendRequest(ctx context.Context, friendship *model.Friendship, from model.FriendshipStatus) error
+
+	// BlockUser сохраняет блокировку и в той же транзакции удаляет любые связи между пользователями.
+	// Если блокировка уже есть, возвращает ErrBlockExists.
+	BlockUser(ctx context.Context, block *model.Block) error
+
+	// UnblockUser снимает блокировку. Если ее нет, возвращает ErrBlockNotFound.
+	UnblockUser(ctx context.Context, block *model.Block) error
+
+	// GetBlockedUsers возвращает блокировки, установленные пользователем, вместе с заблокированными.
+	GetBlockedUsers(ctx context.Context, user int64) ([]model.Block, error)
+
+	// IsBlocked сообщает, заблокировал ли кто-то из двух пользователей другого.
+	IsBlocked(ctx context.Context, user, other int64) (bool, error)
+
+	// GetIncomingRequests возвращает ожидающие заявки, отправленные пользователю, вместе с отправителями.
+	GetIncomingRequests(ctx context.Context, user int64) ([]model.Friendship, error)
+
+	// GetOutgoingRequests возвращает ожидающие заявки, отправленные пользователем, вместе с получателями.
+	GetOutgoingRequests(ctx context.Context, user int64) ([]model.Friendship, error)
+}
+
+// FriendSuggestion - предлагаемый в друзья пользователь и количество общих с ним друзей.
+type FriendSuggestion struct {
+	model.User
+	MutualFriends int64 `json:"mutual_friends"`
 }
 
 // GormFriendRepository — реализация FriendRepository на базе GORM ORM.
@@ -30,19 +84,242 @@ func NewGormFriendRepository(db *gorm.DB) *GormFriendRepository {
 	return &GormFriendRepository{DB: db}
 }
 
+// AddFriend сохраняет заявку. Повтор пары в любом направлении отсекает уникальный индекс (ErrFriendshipExists),
+// несуществующего пользователя - внешний ключ (ErrUserNotFound).
 func (r *GormFriendRepository) AddFriend(ctx context.Context, friendship *model.Friendship) error {
-	return r.DB.WithContext(ctx).Create(&friendship).Error
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&friendship).Error; err != nil {
+			return translateConstraint(tx, err, ErrFriendshipExists, ErrUserNotFound)
+		}
+		return requireActiveUsers(tx, friendship.RequesterID, friendship.AccepterID)
+	})
 }
 func (r *GormFriendRepository) RemoveFriend(ctx context.Context, friendship *model.Friendship) error {
-	return r.DB.WithContext(ctx).Delete(&friendship).Error
+	a, b := friendship.RequesterID, friendship.AccepterID
+	res := r.DB.WithContext(ctx).
+		Where("((requester = ? AND accepter = ?) OR (requester = ? AND accepter = ?)) AND status = ?",
+			a, b, b, a, model.FriendshipAccepted).
+		Delete(&model.Friendship{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrFriendshipNotFound
+	}
+	return nil
 }
 func (r *GormFriendRepository) GetFriends(ctx context.Context, user int64) ([]model.User, error) {
 	var friends []model.User
 
 	err := r.DB.WithContext(ctx).
-		Joins("JOIN friendships ON users.id = friendships.accepter").
-		Where("friendships.requester = ?", user).
+		Joins("JOIN friendships ON (friendships.requester = ? AND users.id = friendships.accepter) OR (friendships.accepter = ? AND users.id = friendships.requester)", user, user).
+		Where("friendships.status = ?", model.FriendshipAccepted).
+		Order("users.id ASC").
 		Find(&friends).Error
 
 	return friends, err
 }
+// friendIDsQuery - подзапрос id друзей пользователя из именованного параметра @param.
+// Дружба симметрична, поэтому друг - это "другая сторона" принятой связи. Две ветки UNION ALL
+// вместо OR позволяют использовать индексы и по requester, и по accepter.
+// Мягко удаленные друзья в выборку не попадают.
+func friendIDsQuery(param string) string {
+	return fmt.Sprintf(`SELECT f.accepter AS friend_id FROM friendships AS f JOIN users AS fu ON fu.id = f.accepter
+		WHERE f.requester = @%[1]s AND f.status = 'accepted' AND fu.deleted_at IS NULL
+		UNION ALL
+		SELECT f.requester AS friend_id FROM friendships AS f JOIN users AS fu ON fu.id = f.requester
+		WHERE f.accepter = @%[1]s AND f.status = 'accepted' AND fu.deleted_at IS NULL`, param)
+}
+
+// friendsOfFriendsQuery - подзапрос друзей друзей пользователя из параметра @param: строка
+// (candidate) на каждую принятую связь его друга. Id друзей подставляются в обе ветки UNION ALL,
+// поэтому читаются по индексам только связи друзей, а не все принятые дружбы. Мягко удаленные
+// друзья отсеиваются в friendIDsQuery и не становятся общими.
+func friendsOfFriendsQuery(param string) string {
+	return fmt.Sprintf(`SELECT e.accepter AS candidate FROM friendships AS e
+		WHERE e.status = 'accepted' AND e.requester IN (%[1]s)
+		UNION ALL
+		SELECT e.requester AS candidate FROM friendships AS e
+		WHERE e.status = 'accepted' AND e.accepter IN (%[1]s)`, friendIDsQuery(param))
+}
+
+func (r *GormFriendRepository) GetMutualFriends(ctx context.Context, user, other int64, limit, offset int) ([]model.User, int64, error) {
+	//общее количество считается оконной функцией в том же запросе
+	var rows []struct {
+		ID      int64
+		Name    string
+		Surname string
+		Email   string
+		Total   int64
+	}
+	err := r.DB.WithContext(ctx).Raw(`
+		SELECT users.id, users.name, users.surname, users.email, COUNT(*) OVER () AS total
+		FROM users
+		JOIN (`+friendIDsQuery("user")+`) AS fu ON fu.friend_id = users.id
+		JOIN (`+friendIDsQuery("other")+`) AS fo ON fo.friend_id = users.id
+		WHERE users.deleted_at IS NULL
+		ORDER BY users.id ASC
+		LIMIT @limit OFFSET @offset`,
+		sql.Named("user", user), sql.Named("other", other),
+		sql.Named("limit", limit), sql.Named("offset", offset)).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users := make([]model.User, 0, len(rows))
+	var total int64
+	for _, row := range rows {
+		users = append(users, model.User{ID: row.ID, Name: row.Name, Surname: row.Surname, Email: row.Email})
+		total = row.Total
+	}
+	return users, total, nil
+}
+
+func (r *GormFriendRepository) GetSuggestions(ctx context.Context, user int64, limit, offset int) ([]FriendSuggestion, error) {
+	var rows []struct {
+		ID      int64
+		Name    string
+		Surname string
+		Email   string
+		Mutual  int64
+	}
+	//каждый путь user -> друг -> кандидат дает кандидату одного общего друга
+	err := r.DB.WithContext(ctx).Raw(`
+		SELECT users.id, users.name, users.surname, users.email, COUNT(*) AS mutual
+		FROM (`+friendsOfFriendsQuery("user")+`) AS edges
+		JOIN users ON users.id = edges.candidate
+		WHERE edges.candidate <> @user AND users.deleted_at IS NULL
+			AND edges.candidate NOT IN (`+friendIDsQuery("user")+`)
+			AND NOT EXISTS (
+				SELECT 1 FROM blocks
+				WHERE (blocks.blocker = @user AND blocks.blocked = edges.candidate)
+					OR (blocks.blocker = edges.candidate AND blocks.blocked = @user))
+			AND NOT EXISTS (
+				SELECT 1 FROM friendships AS pending
+				WHERE pending.status = 'pending'
+					AND ((pending.requester = @user AND pending.accepter = edges.candidate)
+						OR (pending.accepter = @user AND pending.requester = edges.candidate)))
+		GROUP BY users.id, users.name, users.surname, users.email
+		ORDER BY mutual DESC, users.id ASC
+		LIMIT @limit OFFSET @offset`,
+		sql.Named("user", user), sql.Named("limit", limit), sql.Named("offset", offset)).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]FriendSuggestion, 0, len(rows))
+	for _, row := range rows {
+		suggestions = append(suggestions, FriendSuggestion{
+			User:          model.User{ID: row.ID, Name: row.Name, Surname: row.Surname, Email: row.Email},
+			MutualFriends: row.Mutual,
+		})
+	}
+	return suggestions, nil
+}
+
+// friendIDsBatch ограничивает количество id в одном IN (...), чтобы не упереться в лимит параметров SQLite.
+const friendIDsBatch = 500
+
+func (r *GormFriendRepository) GetFriendIDs(ctx context.Context, users []int64) (map[int64][]int64, error) {
+	friends := make(map[int64][]int64, len(users))
+	for start := 0; start < len(users); start += friendIDsBatch {
+		batch := users[start:min(start+friendIDsBatch, len(users))]
+		var edges []struct {
+			UserID   int64
+			FriendID int64
+		}
+		err := r.DB.WithContext(ctx).Raw(`
+			SELECT f.requester AS user_id, f.accepter AS friend_id FROM friendships AS f JOIN users ON users.id = f.accepter
+			WHERE f.requester IN @users AND f.status = 'accepted' AND users.deleted_at IS NULL
+			UNION ALL
+			SELECT f.accepter AS user_id, f.requester AS friend_id FROM friendships AS f JOIN users ON users.id = f.requester
+			WHERE f.accepter IN @users AND f.status = 'accepted' AND users.deleted_at IS NULL`,
+			sql.Named("users", batch)).
+			Scan(&edges).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range edges {
+			friends[e.UserID] = append(friends[e.UserID], e.FriendID)
+		}
+	}
+	return friends, nil
+}
+
+func (r *GormFriendRepository) GetFriendship(ctx context.Context, requester, accepter int64) (*model.Friendship, error) {
+	var friendship model.Friendship
+	err := r.DB.WithContext(ctx).
+		Where("requester = ? AND accepter = ?", requester, accepter).
+		First(&friendship).Error
+	if err != nil {
+		return nil, err
+	}
+	return &friendship, nil
+}
+func (r *GormFriendRepository) SetFriendshipStatus(ctx context.Context, friendship *model.Friendship, from, to model.FriendshipStatus) error {
+	//условие на текущий статус защищает от гонки двух одновременных переходов
+	res := r.DB.WithContext(ctx).Model(&model.Friendship{}).
+		Where("requester = ? AND accepter = ? AND status = ?", friendship.RequesterID, friendship.AccepterID, from).
+		Updates(map[string]any{"status": to, "updated_at": time.Now()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrFriendRequestNotFound
+	}
+	friendship.Status = to
+	return nil
+}
+func (r *GormFriendRepository) ReverseFriendRequest(ctx context.Context, friendship *model.Friendship, from model.FriendshipStatus) error {
+	now := time.Now()
+	res := r.DB.WithContext(ctx).Model(&model.Friendship{}).
+		Where("requester = ? AND accepter = ? AND status = ?", friendship.AccepterID, friendship.RequesterID, from).
+		Updates(map[string]any{
+			"requester":  friendship.RequesterID,
+			"accepter":   friendship.AccepterID,
+			"status":     model.FriendshipPending,
+			"created_at": now,
+			"updated_at": now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrFriendRequestNotFound
+	}
+	friendship.Status, friendship.CreatedAt, friendship.UpdatedAt = model.FriendshipPending, now, now
+	return nil
+}
+func (r *GormFriendRepository) GetIncomingRequests(ctx context.Context, user int64) ([]model.Friendship, error) {
+	var requests []model.Friendship
+	err := r.DB.WithContext(ctx).Preload("Requester").
+		Joins("JOIN users ON users.id = friendships.requester AND users.deleted_at IS NULL").
+		Where("friendships.accepter = ? AND friendships.status = ?", user, model.FriendshipPending).
+		Order("friendships.created_at DESC").
+		Find(&requests).Error
+	return requests, err
+}
+func (r *GormFriendRepository) GetOutgoingRequests(ctx context.Context, user int64) ([]model.Friendship, error) {
+	var requests []model.Friendship
+	err := r.DB.WithContext(ctx).Preload("Accepter").
+		Joins("JOIN users ON users.id = friendships.accepter AND users.deleted_at IS NULL").
+		Where("friendships.requester = ? AND friendships.status = ?", user, model.FriendshipPending).
+		Order("friendships.created_at DESC").
+		Find(&requests).Error
+	return requests, err
+}
+
+// requireActiveUsers проверяет в транзакции вставки, что пользователи не удалены мягко:
+// внешний ключ видит и удаленные строки, поэтому связь с ними откатывается с ErrUserNotFound.
+func requireActiveUsers(tx *gorm.DB, ids ...int64) error {
+	var count int64
+	if err := tx.Model(&model.User{}).Where("id IN ?", ids).Count(&count).Error; err != nil {
+		return err
+	}
+	if count != int64(len(ids)) {
+		return ErrUserNotFound
+	}
+	return nil
+}
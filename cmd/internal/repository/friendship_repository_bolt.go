@@ -0,0 +1,332 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	bolt "go.etcd.io/bbolt"
+	"gorm.io/gorm"
+)
+
+// BoltFriendRepository - реализация FriendRepository во встроенной базе bbolt.
+// Пользователей берет из того же BoltStore, что и BoltUserRepository.
+type BoltFriendRepository struct {
+	Store *BoltStore
+}
+
+// NewBoltFriendRepository создает репозиторий дружб поверх хранилища store.
+func NewBoltFriendRepository(store *BoltStore) *BoltFriendRepository {
+	return &BoltFriendRepository{Store: store}
+}
+
+// AddFriend сохраняет заявку. Связь между парой в любом направлении уже есть - ErrFriendshipExists,
+// пользователь не найден или удален - ErrUserNotFound.
+func (r *BoltFriendRepository) AddFriend(ctx context.Context, friendship *model.Friendship) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		if _, exists, err := boltFriendship(tx, friendship.RequesterID, friendship.AccepterID); err != nil {
+			return err
+		} else if exists {
+			return ErrFriendshipExists
+		}
+		if err := boltRequireUsers(tx, friendship.RequesterID, friendship.AccepterID); err != nil {
+			return err
+		}
+		now := time.Now()
+		if friendship.Status == "" {
+			friendship.Status = model.FriendshipAccepted
+		}
+		if friendship.CreatedAt.IsZero() {
+			friendship.CreatedAt = now
+		}
+		if friendship.UpdatedAt.IsZero() {
+			friendship.UpdatedAt = now
+		}
+		return boltPutFriendship(tx, *friendship)
+	})
+}
+func (r *BoltFriendRepository) RemoveFriend(ctx context.Context, friendship *model.Friendship) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		f, ok, err := boltFriendship(tx, friendship.RequesterID, friendship.AccepterID)
+		if err != nil {
+			return err
+		}
+		if !ok || f.Status != model.FriendshipAccepted {
+			return ErrFriendshipNotFound
+		}
+		return boltDeleteFriendship(tx, friendship.RequesterID, friendship.AccepterID)
+	})
+}
+func (r *BoltFriendRepository) GetFriends(ctx context.Context, user int64) ([]model.User, error) {
+	friends := []model.User{}
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		ids, err := boltFriendIDs(tx, user)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			friend, _, err := boltUser(tx, id)
+			if err != nil {
+				return err
+			}
+			friends = append(friends, friend)
+		}
+		return nil
+	})
+	return friends, err
+}
+func (r *BoltFriendRepository) GetMutualFriends(ctx context.Context, user, other int64, limit, offset int) ([]model.User, int64, error) {
+	var mutual []model.User
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		mine, err := boltFriendIDs(tx, user)
+		if err != nil {
+			return err
+		}
+		theirs, err := boltFriendIDs(tx, other)
+		if err != nil {
+			return err
+		}
+		for _, id := range mine {
+			if _, found := slices.BinarySearch(theirs, id); !found {
+				continue
+			}
+			friend, _, err := boltUser(tx, id)
+			if err != nil {
+				return err
+			}
+			mutual = append(mutual, userSummary(friend))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	users := page(mutual, limit, offset)
+	//как и COUNT(*) OVER () в SQL, общее количество известно, только если страница не пуста
+	var total int64
+	if len(users) > 0 {
+		total = int64(len(mutual))
+	}
+	return append([]model.User{}, users...), total, nil
+}
+func (r *BoltFriendRepository) GetSuggestions(ctx context.Context, user int64, limit, offset int) ([]FriendSuggestion, error) {
+	var suggestions []FriendSuggestion
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		mine, err := boltFriendIDs(tx, user)
+		if err != nil {
+			return err
+		}
+		//каждый путь user -> друг -> кандидат дает кандидату одного общего друга
+		mutual := make(map[int64]int64)
+		for _, friend := range mine {
+			err := boltFriendships(tx, friend, func(candidate int64, f model.Friendship) error {
+				if f.Status == model.FriendshipAccepted {
+					mutual[candidate]++
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		for candidate, count := range mutual {
+			if _, isFriend := slices.BinarySearch(mine, candidate); candidate == user || isFriend {
+				continue
+			}
+			u, active, err := boltActiveUser(tx, candidate)
+			if err != nil {
+				return err
+			}
+			if !active || boltIsBlocked(tx, user, candidate) {
+				continue
+			}
+			f, ok, err := boltFriendship(tx, user, candidate)
+			if err != nil {
+				return err
+			}
+			if ok && f.Status == model.FriendshipPending {
+				continue
+			}
+			suggestions = append(suggestions, FriendSuggestion{User: userSummary(u), MutualFriends: count})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(suggestions, func(a, b FriendSuggestion) int {
+		return cmp.Or(cmp.Compare(b.MutualFriends, a.MutualFriends), cmp.Compare(a.ID, b.ID))
+	})
+	return append([]FriendSuggestion{}, page(suggestions, limit, offset)...), nil
+}
+func (r *BoltFriendRepository) GetFriendIDs(ctx context.Context, users []int64) (map[int64][]int64, error) {
+	friends := make(map[int64][]int64, len(users))
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		for _, user := range users {
+			ids, err := boltFriendIDs(tx, user)
+			if err != nil {
+				return err
+			}
+			if len(ids) > 0 {
+				friends[user] = ids
+			}
+		}
+		return nil
+	})
+	return friends, err
+}
+func (r *BoltFriendRepository) GetFriendship(ctx context.Context, requester, accepter int64) (*model.Friendship, error) {
+	var friendship model.Friendship
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		f, ok, err := boltFriendship(tx, requester, accepter)
+		if err != nil {
+			return err
+		}
+		if !ok || f.RequesterID != requester {
+			return gorm.ErrRecordNotFound
+		}
+		friendship = f
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &friendship, nil
+}
+func (r *BoltFriendRepository) SetFriendshipStatus(ctx context.Context, friendship *model.Friendship, from, to model.FriendshipStatus) error {
+	err := r.Store.update(ctx, func(tx *bolt.Tx) error {
+		f, ok, err := boltFriendship(tx, friendship.RequesterID, friendship.AccepterID)
+		if err != nil {
+			return err
+		}
+		if !ok || f.RequesterID != friendship.RequesterID || f.Status != from {
+			return ErrFriendRequestNotFound
+		}
+		f.Status, f.UpdatedAt = to, time.Now()
+		return boltPutFriendship(tx, f)
+	})
+	if err != nil {
+		return err
+	}
+	friendship.Status = to
+	return nil
+}
+func (r *BoltFriendRepository) ReverseFriendRequest(ctx context.Context, friendship *model.Friendship, from model.FriendshipStatus) error {
+	var now time.Time
+	err := r.Store.update(ctx, func(tx *bolt.Tx) error {
+		f, ok, err := boltFriendship(tx, friendship.RequesterID, friendship.AccepterID)
+		if err != nil {
+			return err
+		}
+		if !ok || f.RequesterID != friendship.AccepterID || f.Status != from {
+			return ErrFriendRequestNotFound
+		}
+		now = time.Now()
+		f.RequesterID, f.AccepterID = friendship.RequesterID, friendship.AccepterID
+		f.Status, f.CreatedAt, f.UpdatedAt = model.FriendshipPending, now, now
+		return boltPutFriendship(tx, f)
+	})
+	if err != nil {
+		return err
+	}
+	friendship.Status, friendship.CreatedAt, friendship.UpdatedAt = model.FriendshipPending, now, now
+	return nil
+}
+func (r *BoltFriendRepository) GetIncomingRequests(ctx context.Context, user int64) ([]model.Friendship, error) {
+	return r.pendingRequests(ctx, user, func(f model.Friendship) bool { return f.AccepterID == user })
+}
+func (r *BoltFriendRepository) GetOutgoingRequests(ctx context.Context, user int64) ([]model.Friendship, error) {
+	return r.pendingRequests(ctx, user, func(f model.Friendship) bool { return f.RequesterID == user })
+}
+
+// pendingRequests возвращает ожидающие заявки пользователя, для которых side сообщает true, вместе
+// с пользователем с другой стороны заявки, новые первыми. Заявки от удаленных и к удаленным пропускаются.
+func (r *BoltFriendRepository) pendingRequests(ctx context.Context, user int64, side func(model.Friendship) bool) ([]model.Friendship, error) {
+	requests := []model.Friendship{}
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		return boltFriendships(tx, user, func(otherID int64, f model.Friendship) error {
+			if !side(f) || f.Status != model.FriendshipPending {
+				return nil
+			}
+			other, active, err := boltActiveUser(tx, otherID)
+			if err != nil || !active {
+				return err
+			}
+			if otherID == f.RequesterID {
+				f.Requester = &other
+			} else {
+				f.Accepter = &other
+			}
+			requests = append(requests, f)
+			return nil
+		})
+	})
+	slices.SortStableFunc(requests, func(a, b model.Friendship) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return requests, err
+}
+
+// BlockUser сохраняет блокировку и удаляет дружбу и заявки между пользователями. Повторная блокировка -
+// ErrBlockExists, пользователь не найден или удален - ErrUserNotFound.
+func (r *BoltFriendRepository) BlockUser(ctx context.Context, block *model.Block) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		key := boltKey(block.BlockerID, block.BlockedID)
+		blocks := tx.Bucket(bucketBlocks)
+		if blocks.Get(key) != nil {
+			return ErrBlockExists
+		}
+		if err := boltRequireUsers(tx, block.BlockerID, block.BlockedID); err != nil {
+			return err
+		}
+		if block.CreatedAt.IsZero() {
+			block.CreatedAt = time.Now()
+		}
+		stored := *block
+		stored.Blocker, stored.Blocked = nil, nil
+		if err := boltPut(blocks, key, stored); err != nil {
+			return err
+		}
+		if err := tx.Bucket(bucketBlockedBy).Put(boltKey(block.BlockedID, block.BlockerID), nil); err != nil {
+			return err
+		}
+		return boltDeleteFriendship(tx, block.BlockerID, block.BlockedID)
+	})
+}
+func (r *BoltFriendRepository) UnblockUser(ctx context.Context, block *model.Block) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		blocks := tx.Bucket(bucketBlocks)
+		key := boltKey(block.BlockerID, block.BlockedID)
+		if blocks.Get(key) == nil {
+			return ErrBlockNotFound
+		}
+		if err := blocks.Delete(key); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketBlockedBy).Delete(boltKey(block.BlockedID, block.BlockerID))
+	})
+}
+func (r *BoltFriendRepository) GetBlockedUsers(ctx context.Context, user int64) ([]model.Block, error) {
+	blocks := []model.Block{}
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		return boltEach(tx.Bucket(bucketBlocks), boltKey(user), func(_ []byte, b model.Block) error {
+			blocked, active, err := boltActiveUser(tx, b.BlockedID)
+			if err != nil || !active {
+				return err
+			}
+			b.Blocked = &blocked
+			blocks = append(blocks, b)
+			return nil
+		})
+	})
+	slices.SortStableFunc(blocks, func(a, b model.Block) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return blocks, err
+}
+func (r *BoltFriendRepository) IsBlocked(ctx context.Context, user, other int64) (bool, error) {
+	var blocked bool
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		blocked = boltIsBlocked(tx, user, other)
+		return nil
+	})
+	return blocked, err
+}
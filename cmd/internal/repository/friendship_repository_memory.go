@@ -0,0 +1,305 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"gorm.io/gorm"
+)
+
+// MemoryFriendRepository - реализация FriendRepository в памяти процесса для тестов и демо.
+// Пользователей берет из того же MemoryStore, что и MemoryUserRepository.
+type MemoryFriendRepository struct {
+	Store *MemoryStore
+}
+
+// NewMemoryFriendRepository создает репозиторий дружб поверх хранилища store.
+func NewMemoryFriendRepository(store *MemoryStore) *MemoryFriendRepository {
+	return &MemoryFriendRepository{Store: store}
+}
+
+// AddFriend сохраняет заявку. Связь между парой в любом направлении уже есть - ErrFriendshipExists,
+// пользователь не найден или удален - ErrUserNotFound.
+func (r *MemoryFriendRepository) AddFriend(ctx context.Context, friendship *model.Friendship) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		pair := pairOf(friendship.RequesterID, friendship.AccepterID)
+		if _, exists := s.friendships[pair]; exists {
+			return ErrFriendshipExists
+		}
+		if err := s.requireUsers(friendship.RequesterID, friendship.AccepterID); err != nil {
+			return err
+		}
+		now := time.Now()
+		if friendship.Status == "" {
+			friendship.Status = model.FriendshipAccepted
+		}
+		if friendship.CreatedAt.IsZero() {
+			friendship.CreatedAt = now
+		}
+		if friendship.UpdatedAt.IsZero() {
+			friendship.UpdatedAt = now
+		}
+		stored := *friendship
+		stored.Requester, stored.Accepter = nil, nil
+		s.friendships[pair] = stored
+		return nil
+	})
+}
+func (r *MemoryFriendRepository) RemoveFriend(ctx context.Context, friendship *model.Friendship) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		pair := pairOf(friendship.RequesterID, friendship.AccepterID)
+		if f, ok := s.friendships[pair]; !ok || f.Status != model.FriendshipAccepted {
+			return ErrFriendshipNotFound
+		}
+		delete(s.friendships, pair)
+		return nil
+	})
+}
+func (r *MemoryFriendRepository) GetFriends(ctx context.Context, user int64) ([]model.User, error) {
+	friends := []model.User{}
+	err := r.Store.read(ctx, func() error {
+		for id := range r.Store.friendIDs(user) {
+			friends = append(friends, cloneUser(r.Store.users[id]))
+		}
+		return nil
+	})
+	slices.SortFunc(friends, func(a, b model.User) int { return cmp.Compare(a.ID, b.ID) })
+	return friends, err
+}
+func (r *MemoryFriendRepository) GetMutualFriends(ctx context.Context, user, other int64, limit, offset int) ([]model.User, int64, error) {
+	var mutual []model.User
+	err := r.Store.read(ctx, func() error {
+		theirs := r.Store.friendIDs(other)
+		for id := range r.Store.friendIDs(user) {
+			if theirs[id] {
+				mutual = append(mutual, userSummary(r.Store.users[id]))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	slices.SortFunc(mutual, func(a, b model.User) int { return cmp.Compare(a.ID, b.ID) })
+	users := page(mutual, limit, offset)
+	//как и COUNT(*) OVER () в SQL, общее количество известно, только если страница не пуста
+	var total int64
+	if len(users) > 0 {
+		total = int64(len(mutual))
+	}
+	return append([]model.User{}, users...), total, nil
+}
+func (r *MemoryFriendRepository) GetSuggestions(ctx context.Context, user int64, limit, offset int) ([]FriendSuggestion, error) {
+	var suggestions []FriendSuggestion
+	s := r.Store
+	err := s.read(ctx, func() error {
+		mine := s.friendIDs(user)
+		//каждый путь user -> друг -> кандидат дает кандидату одного общего друга
+		mutual := make(map[int64]int64)
+		for friend := range mine {
+			for _, f := range s.friendships {
+				if f.Status != model.FriendshipAccepted {
+					continue
+				}
+				switch friend {
+				case f.RequesterID:
+					mutual[f.AccepterID]++
+				case f.AccepterID:
+					mutual[f.RequesterID]++
+				}
+			}
+		}
+		for candidate, count := range mutual {
+			if candidate == user || mine[candidate] {
+				continue
+			}
+			if _, ok := s.activeUser(candidate); !ok {
+				continue
+			}
+			if s.isBlocked(user, candidate) {
+				continue
+			}
+			if f, ok := s.friendships[pairOf(user, candidate)]; ok && f.Status == model.FriendshipPending {
+				continue
+			}
+			suggestions = append(suggestions, FriendSuggestion{User: userSummary(s.users[candidate]), MutualFriends: count})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(suggestions, func(a, b FriendSuggestion) int {
+		return cmp.Or(cmp.Compare(b.MutualFriends, a.MutualFriends), cmp.Compare(a.ID, b.ID))
+	})
+	return append([]FriendSuggestion{}, page(suggestions, limit, offset)...), nil
+}
+func (r *MemoryFriendRepository) GetFriendIDs(ctx context.Context, users []int64) (map[int64][]int64, error) {
+	friends := make(map[int64][]int64, len(users))
+	err := r.Store.read(ctx, func() error {
+		for _, user := range users {
+			for id := range r.Store.friendIDs(user) {
+				friends[user] = append(friends[user], id)
+			}
+			slices.Sort(friends[user])
+		}
+		return nil
+	})
+	return friends, err
+}
+func (r *MemoryFriendRepository) GetFriendship(ctx context.Context, requester, accepter int64) (*model.Friendship, error) {
+	var friendship model.Friendship
+	err := r.Store.read(ctx, func() error {
+		f, ok := r.Store.friendships[pairOf(requester, accepter)]
+		if !ok || f.RequesterID != requester {
+			return gorm.ErrRecordNotFound
+		}
+		friendship = f
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &friendship, nil
+}
+func (r *MemoryFriendRepository) SetFriendshipStatus(ctx context.Context, friendship *model.Friendship, from, to model.FriendshipStatus) error {
+	s := r.Store
+	err := s.write(ctx, func() error {
+		pair := pairOf(friendship.RequesterID, friendship.AccepterID)
+		f, ok := s.friendships[pair]
+		if !ok || f.RequesterID != friendship.RequesterID || f.Status != from {
+			return ErrFriendRequestNotFound
+		}
+		f.Status, f.UpdatedAt = to, time.Now()
+		s.friendships[pair] = f
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	friendship.Status = to
+	return nil
+}
+func (r *MemoryFriendRepository) ReverseFriendRequest(ctx context.Context, friendship *model.Friendship, from model.FriendshipStatus) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		pair := pairOf(friendship.RequesterID, friendship.AccepterID)
+		f, ok := s.friendships[pair]
+		if !ok || f.RequesterID != friendship.AccepterID || f.Status != from {
+			return ErrFriendRequestNotFound
+		}
+		now := time.Now()
+		f.RequesterID, f.AccepterID = friendship.RequesterID, friendship.AccepterID
+		f.Status, f.CreatedAt, f.UpdatedAt = model.FriendshipPending, now, now
+		s.friendships[pair] = f
+		friendship.Status, friendship.CreatedAt, friendship.UpdatedAt = f.Status, now, now
+		return nil
+	})
+}
+func (r *MemoryFriendRepository) GetIncomingRequests(ctx context.Context, user int64) ([]model.Friendship, error) {
+	return r.pendingRequests(ctx, func(f model.Friendship) (int64, bool) {
+		return f.RequesterID, f.AccepterID == user
+	})
+}
+func (r *MemoryFriendRepository) GetOutgoingRequests(ctx context.Context, user int64) ([]model.Friendship, error) {
+	return r.pendingRequests(ctx, func(f model.Friendship) (int64, bool) {
+		return f.AccepterID, f.RequesterID == user
+	})
+}
+
+// pendingRequests возвращает ожидающие заявки, для которых side сообщает true, вместе с пользователем
+// с другой стороны заявки, новые первыми. Заявки от удаленных и к удаленным пользователям пропускаются.
+func (r *MemoryFriendRepository) pendingRequests(ctx context.Context, side func(model.Friendship) (int64, bool)) ([]model.Friendship, error) {
+	requests := []model.Friendship{}
+	s := r.Store
+	err := s.read(ctx, func() error {
+		for _, f := range s.friendships {
+			otherID, ok := side(f)
+			if !ok || f.Status != model.FriendshipPending {
+				continue
+			}
+			other, active := s.activeUser(otherID)
+			if !active {
+				continue
+			}
+			other = cloneUser(other)
+			if otherID == f.RequesterID {
+				f.Requester = &other
+			} else {
+				f.Accepter = &other
+			}
+			requests = append(requests, f)
+		}
+		return nil
+	})
+	slices.SortFunc(requests, func(a, b model.Friendship) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return requests, err
+}
+
+// BlockUser сохраняет блокировку и удаляет дружбу и заявки между пользователями. Повторная блокировка -
+// ErrBlockExists, пользователь не найден или удален - ErrUserNotFound.
+func (r *MemoryFriendRepository) BlockUser(ctx context.Context, block *model.Block) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		key := [2]int64{block.BlockerID, block.BlockedID}
+		if _, exists := s.blocks[key]; exists {
+			return ErrBlockExists
+		}
+		if err := s.requireUsers(block.BlockerID, block.BlockedID); err != nil {
+			return err
+		}
+		if block.CreatedAt.IsZero() {
+			block.CreatedAt = time.Now()
+		}
+		stored := *block
+		stored.Blocker, stored.Blocked = nil, nil
+		s.blocks[key] = stored
+		delete(s.friendships, pairOf(block.BlockerID, block.BlockedID))
+		return nil
+	})
+}
+func (r *MemoryFriendRepository) UnblockUser(ctx context.Context, block *model.Block) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		key := [2]int64{block.BlockerID, block.BlockedID}
+		if _, exists := s.blocks[key]; !exists {
+			return ErrBlockNotFound
+		}
+		delete(s.blocks, key)
+		return nil
+	})
+}
+func (r *MemoryFriendRepository) GetBlockedUsers(ctx context.Context, user int64) ([]model.Block, error) {
+	blocks := []model.Block{}
+	s := r.Store
+	err := s.read(ctx, func() error {
+		for key, b := range s.blocks {
+			if key[0] != user {
+				continue
+			}
+			blocked, ok := s.activeUser(key[1])
+			if !ok {
+				continue
+			}
+			blocked = cloneUser(blocked)
+			b.Blocked = &blocked
+			blocks = append(blocks, b)
+		}
+		return nil
+	})
+	slices.SortFunc(blocks, func(a, b model.Block) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return blocks, err
+}
+func (r *MemoryFriendRepository) IsBlocked(ctx context.Context, user, other int64) (bool, error) {
+	var blocked bool
+	err := r.Store.read(ctx, func() error {
+		blocked = r.Store.isBlocked(user, other)
+		return nil
+	})
+	return blocked, err
+}
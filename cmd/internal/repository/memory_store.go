@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+)
+
+// MemoryStore - все данные сервиса в памяти процесса, общие для репозиториев Memory*. Хранилище повторяет
+// ограничения схемы БД: email уникален без учета регистра (в том числе среди мягко удаленных), на пару
+// пользователей приходится одна связь независимо от направления, а связи, блокировки и токены ссылаются
+// только на существующих пользователей. Безопасно для конкурентного доступа: каждый метод репозитория
+// выполняется под блокировкой целиком, как транзакция.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	lastID int64
+	users  map[int64]model.User
+	// emails - id пользователя по email в нижнем регистре, аналог уникального индекса
+	emails map[string]int64
+	// friendships - связи по неупорядоченной паре пользователей, направление хранится в самой связи
+	friendships map[userPair]model.Friendship
+	// blocks - блокировки по паре (blocker, blocked)
+	blocks map[[2]int64]model.Block
+	// refreshTokens, recoveryCodes, emailTokens и apiKeys - записи по id; tokenHashes, emailNonces
+	// и apiKeyPrefixes - id записи по ключу уникального индекса
+	refreshTokens  map[int64]model.RefreshToken
+	tokenHashes    map[string]int64
+	recoveryCodes  map[int64]model.RecoveryCode
+	emailTokens    map[int64]model.EmailToken
+	emailNonces    map[string]int64
+	apiKeys        map[int64]model.APIKey
+	apiKeyPrefixes map[string]int64
+	// sequences - последний выданный id записей, кроме пользователей, по таблицам
+	sequences map[string]int64
+}
+
+// userPair - неупорядоченная пара пользователей: меньший id всегда первый
+type userPair [2]int64
+
+func pairOf(a, b int64) userPair {
+	return userPair{min(a, b), max(a, b)}
+}
+
+// NewMemoryStore создает пустое хранилище в памяти.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:       make(map[int64]model.User),
+		emails:      make(map[string]int64),
+		friendships: make(map[userPair]model.Friendship),
+		blocks:      make(map[[2]int64]model.Block),
+
+		refreshTokens:  make(map[int64]model.RefreshToken),
+		tokenHashes:    make(map[string]int64),
+		recoveryCodes:  make(map[int64]model.RecoveryCode),
+		emailTokens:    make(map[int64]model.EmailToken),
+		emailNonces:    make(map[string]int64),
+		apiKeys:        make(map[int64]model.APIKey),
+		apiKeyPrefixes: make(map[string]int64),
+		sequences:      make(map[string]int64),
+	}
+}
+
+// read выполняет fn под блокировкой на чтение, если контекст еще не отменен
+func (s *MemoryStore) read(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn()
+}
+
+// write выполняет fn под блокировкой на запись. Чтобы изменение было атомарным, как транзакция,
+// fn сначала проверяет все условия и только потом меняет данные.
+func (s *MemoryStore) write(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn()
+}
+
+// activeUser возвращает пользователя, если он есть и не удален мягко
+func (s *MemoryStore) activeUser(id int64) (model.User, bool) {
+	user, ok := s.users[id]
+	if !ok || user.DeletedAt.Valid {
+		return model.User{}, false
+	}
+	return user, true
+}
+
+// requireUsers проверяет ссылки новой связи: несуществующий и мягко удаленный пользователь -
+// ErrUserNotFound, как у внешнего ключа вместе с requireActiveUsers в GORM-реализации.
+func (s *MemoryStore) requireUsers(ids ...int64) error {
+	for _, id := range ids {
+		if _, ok := s.activeUser(id); !ok {
+			return ErrUserNotFound
+		}
+	}
+	return nil
+}
+
+// nextID возвращает id новой записи таблицы table: заданный id или следующий по порядку, как автоинкремент
+func (s *MemoryStore) nextID(table string, id int64) int64 {
+	if id == 0 {
+		id = s.sequences[table] + 1
+	}
+	s.sequences[table] = max(s.sequences[table], id)
+	return id
+}
+
+// updateUser меняет не удаленного пользователя функцией change и сохраняет его с новым UpdatedAt,
+// как Updates в GORM. Если пользователя нет, возвращает notFound; ошибка change отменяет изменение.
+func (s *MemoryStore) updateUser(id int64, change func(user *model.User) error, notFound error) error {
+	user, ok := s.activeUser(id)
+	if !ok {
+		return notFound
+	}
+	if err := change(&user); err != nil {
+		return err
+	}
+	user.UpdatedAt = time.Now()
+	s.users[id] = user
+	return nil
+}
+
+// revokeRefreshTokens отзывает в момент at действующие токены, для которых match сообщает true
+func (s *MemoryStore) revokeRefreshTokens(at time.Time, match func(model.RefreshToken) bool) {
+	for id, t := range s.refreshTokens {
+		if t.RevokedAt == nil && match(t) {
+			t.RevokedAt = &at
+			s.refreshTokens[id] = t
+		}
+	}
+}
+
+// deleteUserRecords удаляет токены, коды восстановления, токены из писем и выпущенные пользователем
+// API-ключи, как каскадное удаление по внешним ключам
+func (s *MemoryStore) deleteUserRecords(user int64) {
+	for id, t := range s.refreshTokens {
+		if t.UserID == user {
+			delete(s.tokenHashes, t.TokenHash)
+			delete(s.refreshTokens, id)
+		}
+	}
+	for id, c := range s.recoveryCodes {
+		if c.UserID == user {
+			delete(s.recoveryCodes, id)
+		}
+	}
+	for id, t := range s.emailTokens {
+		if t.UserID == user {
+			delete(s.emailNonces, t.Nonce)
+			delete(s.emailTokens, id)
+		}
+	}
+	for id, k := range s.apiKeys {
+		if k.CreatedBy == user {
+			delete(s.apiKeyPrefixes, k.Prefix)
+			delete(s.apiKeys, id)
+		}
+	}
+}
+
+// friendIDs возвращает id не удаленных друзей пользователя
+func (s *MemoryStore) friendIDs(user int64) map[int64]bool {
+	ids := make(map[int64]bool)
+	for _, f := range s.friendships {
+		if f.Status != model.FriendshipAccepted {
+			continue
+		}
+		var friend int64
+		switch user {
+		case f.RequesterID:
+			friend = f.AccepterID
+		case f.AccepterID:
+			friend = f.RequesterID
+		default:
+			continue
+		}
+		if _, ok := s.activeUser(friend); ok {
+			ids[friend] = true
+		}
+	}
+	return ids
+}
+
+// isBlocked сообщает, заблокировал ли кто-то из двух пользователей другого
+func (s *MemoryStore) isBlocked(user, other int64) bool {
+	_, blocked := s.blocks[[2]int64{user, other}]
+	_, blockedBy := s.blocks[[2]int64{other, user}]
+	return blocked || blockedBy
+}
+
+// emailKey - ключ email в индексе уникальности
+func emailKey(email string) string {
+	return strings.ToLower(email)
+}
+
+// cloneUser возвращает копию пользователя, не разделяющую с хранилищем изменяемые данные
+func cloneUser(user model.User) model.User {
+	if user.EmailVerifiedAt != nil {
+		verified := *user.EmailVerifiedAt
+		user.EmailVerifiedAt = &verified
+	}
+	user.Friends, user.FriendOf = nil, nil
+	return user
+}
+
+// userSummary - пользователь только с полями, которые отдают выборки друзей GORM-реализации
+func userSummary(user model.User) model.User {
+	return model.User{ID: user.ID, Name: user.Name, Surname: user.Surname, Email: user.Email}
+}
+
+// page возвращает срез items по limit и offset так же, как LIMIT/OFFSET в SQL
+func page[T any](items []T, limit, offset int) []T {
+	offset = max(offset, 0)
+	if offset >= len(items) {
+		return items[:0]
+	}
+	items = items[offset:]
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
@@ -0,0 +1,263 @@
+package repotest
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"github.com/UnendingLoop/users-api/cmd/internal/service"
+	"gorm.io/gorm"
+)
+
+// createdAt - время создания связей в проверках: явное время делает порядок "новые первыми" однозначным
+var createdAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// addFriendship сохраняет связь в статусе status и прерывает проверку при ошибке
+func addFriendship(t *testing.T, repos Repos, requester, accepter int64, status model.FriendshipStatus) {
+	t.Helper()
+	createdAt = createdAt.Add(time.Minute)
+	friendship := model.Friendship{RequesterID: requester, AccepterID: accepter, Status: status, CreatedAt: createdAt, UpdatedAt: createdAt}
+	if err := repos.Friends.AddFriend(context.Background(), &friendship); err != nil {
+		t.Fatalf("AddFriend(%d, %d): %v", requester, accepter, err)
+	}
+}
+
+func testAddFriend(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	ann := createUser(t, repos, "Ann", "Lee", "ann@example.com")
+	bob := createUser(t, repos, "Bob", "Ray", "bob@example.com")
+	cat := createUser(t, repos, "Cat", "Fox", "cat@example.com")
+	addFriendship(t, repos, ann.ID, bob.ID, model.FriendshipPending)
+
+	same := model.Friendship{RequesterID: ann.ID, AccepterID: bob.ID, Status: model.FriendshipPending}
+	wantErr(t, "repeated request", repos.Friends.AddFriend(ctx, &same), repository.ErrFriendshipExists)
+	reverse := model.Friendship{RequesterID: bob.ID, AccepterID: ann.ID, Status: model.FriendshipPending}
+	wantErr(t, "request in the other direction", repos.Friends.AddFriend(ctx, &reverse), repository.ErrFriendshipExists)
+	missing := model.Friendship{RequesterID: ann.ID, AccepterID: cat.ID + 100, Status: model.FriendshipPending}
+	wantErr(t, "request to a missing user", repos.Friends.AddFriend(ctx, &missing), repository.ErrUserNotFound)
+
+	if _, err := repos.Users.DeleteUser(cat.ID, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+	deleted := model.Friendship{RequesterID: ann.ID, AccepterID: cat.ID, Status: model.FriendshipPending}
+	wantErr(t, "request to a deleted user", repos.Friends.AddFriend(ctx, &deleted), repository.ErrUserNotFound)
+	_, err := repos.Friends.GetFriendship(ctx, ann.ID, cat.ID)
+	wantErr(t, "failed request must not be saved", err, gorm.ErrRecordNotFound)
+}
+
+func testFriendRequests(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	ann := createUser(t, repos, "Ann", "Lee", "ann@example.com")
+	bob := createUser(t, repos, "Bob", "Ray", "bob@example.com")
+	cat := createUser(t, repos, "Cat", "Fox", "cat@example.com")
+	addFriendship(t, repos, bob.ID, ann.ID, model.FriendshipPending)
+	addFriendship(t, repos, cat.ID, ann.ID, model.FriendshipPending)
+
+	incoming, err := repos.Friends.GetIncomingRequests(ctx, ann.ID)
+	wantErr(t, "GetIncomingRequests", err, nil)
+	if len(incoming) != 2 || incoming[0].RequesterID != cat.ID || incoming[1].RequesterID != bob.ID {
+		t.Fatalf("incoming requests must be newest first, got %+v", incoming)
+	}
+	if incoming[0].Requester == nil || incoming[0].Requester.Email != "cat@example.com" {
+		t.Fatalf("incoming requests must include the requester, got %+v", incoming[0].Requester)
+	}
+	outgoing, err := repos.Friends.GetOutgoingRequests(ctx, bob.ID)
+	wantErr(t, "GetOutgoingRequests", err, nil)
+	if len(outgoing) != 1 || outgoing[0].Accepter == nil || outgoing[0].Accepter.ID != ann.ID {
+		t.Fatalf("outgoing requests must include the accepter, got %+v", outgoing)
+	}
+	friends, _ := repos.Friends.GetFriends(ctx, ann.ID)
+	wantIDs(t, "pending requests are not friends", userIDs(friends), nil)
+
+	_, err = repos.Friends.GetFriendship(ctx, ann.ID, bob.ID)
+	wantErr(t, "GetFriendship is directed", err, gorm.ErrRecordNotFound)
+	request, err := repos.Friends.GetFriendship(ctx, bob.ID, ann.ID)
+	wantErr(t, "GetFriendship", err, nil)
+	if request.Status != model.FriendshipPending {
+		t.Fatalf("GetFriendship: got status %q", request.Status)
+	}
+
+	err = repos.Friends.SetFriendshipStatus(ctx, request, model.FriendshipAccepted, model.FriendshipDeclined)
+	wantErr(t, "transition from a wrong status", err, repository.ErrFriendRequestNotFound)
+	err = repos.Friends.SetFriendshipStatus(ctx, request, model.FriendshipPending, model.FriendshipAccepted)
+	wantErr(t, "SetFriendshipStatus", err, nil)
+	if request.Status != model.FriendshipAccepted {
+		t.Fatalf("SetFriendshipStatus must update the status, got %q", request.Status)
+	}
+	wrongWay := &model.Friendship{RequesterID: ann.ID, AccepterID: cat.ID}
+	err = repos.Friends.SetFriendshipStatus(ctx, wrongWay, model.FriendshipPending, model.FriendshipAccepted)
+	wantErr(t, "SetFriendshipStatus is directed", err, repository.ErrFriendRequestNotFound)
+
+	friends, _ = repos.Friends.GetFriends(ctx, ann.ID)
+	wantIDs(t, "friends of the accepter", userIDs(friends), []int64{bob.ID})
+	friends, _ = repos.Friends.GetFriends(ctx, bob.ID)
+	wantIDs(t, "friends of the requester", userIDs(friends), []int64{ann.ID})
+	incoming, _ = repos.Friends.GetIncomingRequests(ctx, ann.ID)
+	if len(incoming) != 1 || incoming[0].RequesterID != cat.ID {
+		t.Fatalf("accepted request must leave incoming requests, got %+v", incoming)
+	}
+
+	//удалить можно только принятую дружбу, в любом направлении
+	pending := &model.Friendship{RequesterID: cat.ID, AccepterID: ann.ID}
+	wantErr(t, "RemoveFriend of a pending request", repos.Friends.RemoveFriend(ctx, pending), repository.ErrFriendshipNotFound)
+	wantErr(t, "RemoveFriend", repos.Friends.RemoveFriend(ctx, &model.Friendship{RequesterID: ann.ID, AccepterID: bob.ID}), nil)
+	wantErr(t, "RemoveFriend twice", repos.Friends.RemoveFriend(ctx, &model.Friendship{RequesterID: bob.ID, AccepterID: ann.ID}),
+		repository.ErrFriendshipNotFound)
+}
+
+func testReverseFriendRequest(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	ann := createUser(t, repos, "Ann", "Lee", "ann@example.com")
+	bob := createUser(t, repos, "Bob", "Ray", "bob@example.com")
+	cat := createUser(t, repos, "Cat", "Fox", "cat@example.com")
+	addFriendship(t, repos, ann.ID, bob.ID, model.FriendshipDeclined)
+
+	sameWay := &model.Friendship{RequesterID: ann.ID, AccepterID: bob.ID}
+	err := repos.Friends.ReverseFriendRequest(ctx, sameWay, model.FriendshipDeclined)
+	wantErr(t, "ReverseFriendRequest of an own request", err, repository.ErrFriendRequestNotFound)
+	request := &model.Friendship{RequesterID: bob.ID, AccepterID: ann.ID}
+	err = repos.Friends.ReverseFriendRequest(ctx, request, model.FriendshipCancelled)
+	wantErr(t, "ReverseFriendRequest from a wrong status", err, repository.ErrFriendRequestNotFound)
+	err = repos.Friends.ReverseFriendRequest(ctx, request, model.FriendshipDeclined)
+	wantErr(t, "ReverseFriendRequest", err, nil)
+	if request.Status != model.FriendshipPending {
+		t.Fatalf("ReverseFriendRequest must make a pending request, got %q", request.Status)
+	}
+	_, err = repos.Friends.GetFriendship(ctx, ann.ID, bob.ID)
+	wantErr(t, "reversed request must replace the old one", err, gorm.ErrRecordNotFound)
+	incoming, _ := repos.Friends.GetIncomingRequests(ctx, ann.ID)
+	if len(incoming) != 1 || incoming[0].RequesterID != bob.ID {
+		t.Fatalf("reversed request must be incoming for the old requester, got %+v", incoming)
+	}
+
+	//тот же сценарий через сервис: cat отзывает заявку к ann, и ann сама зовет cat в друзья
+	friends := service.NewFriendService(repos.Friends, repos.Users, 0, 0)
+	if _, err := friends.AddFriend(cat.ID, ann.ID, ctx); err != nil {
+		t.Fatal(err)
+	}
+	wantErr(t, "CancelFriendRequest", friends.CancelFriendRequest(cat.ID, ann.ID, ctx), nil)
+	friendship, err := friends.AddFriend(ann.ID, cat.ID, ctx)
+	wantErr(t, "AddFriend after a cancelled reverse request", err, nil)
+	if friendship.RequesterID != ann.ID || friendship.Status != model.FriendshipPending {
+		t.Fatalf("AddFriend must send a new request, got %+v", friendship)
+	}
+	wantErr(t, "AcceptFriend", friends.AcceptFriend(cat.ID, ann.ID, ctx), nil)
+	list, _ := repos.Friends.GetFriends(ctx, cat.ID)
+	wantIDs(t, "friends after the reversed request is accepted", userIDs(list), []int64{ann.ID})
+}
+
+func testMutualFriendsAndSuggestions(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	ann := createUser(t, repos, "Ann", "Lee", "ann@example.com")
+	bob := createUser(t, repos, "Bob", "Ray", "bob@example.com")
+	cat := createUser(t, repos, "Cat", "Fox", "cat@example.com")
+	dan := createUser(t, repos, "Dan", "Oak", "dan@example.com")
+	eve := createUser(t, repos, "Eve", "Elm", "eve@example.com")
+	fay := createUser(t, repos, "Fay", "Ash", "fay@example.com")
+	gus := createUser(t, repos, "Gus", "Yew", "gus@example.com")
+	accepted := model.FriendshipAccepted
+	//ann дружит с bob и cat; у bob и cat общие друзья dan и eve; fay дружит только с bob
+	addFriendship(t, repos, ann.ID, bob.ID, accepted)
+	addFriendship(t, repos, cat.ID, ann.ID, accepted)
+	addFriendship(t, repos, bob.ID, dan.ID, accepted)
+	addFriendship(t, repos, dan.ID, cat.ID, accepted)
+	addFriendship(t, repos, bob.ID, eve.ID, accepted)
+	addFriendship(t, repos, cat.ID, eve.ID, accepted)
+	addFriendship(t, repos, fay.ID, bob.ID, accepted)
+	addFriendship(t, repos, cat.ID, gus.ID, accepted)
+	addFriendship(t, repos, ann.ID, gus.ID, model.FriendshipPending)
+	//удаленный друг ann не делает своих друзей общими: hal не добавляет dan общего друга, а ivy не рекомендуется
+	hal := createUser(t, repos, "Hal", "Elm", "hal@example.com")
+	ivy := createUser(t, repos, "Ivy", "Elm", "ivy@example.com")
+	addFriendship(t, repos, ann.ID, hal.ID, accepted)
+	addFriendship(t, repos, hal.ID, dan.ID, accepted)
+	addFriendship(t, repos, ivy.ID, hal.ID, accepted)
+	if _, err := repos.Users.DeleteUser(hal.ID, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mutual, total, err := repos.Friends.GetMutualFriends(ctx, bob.ID, cat.ID, 2, 0)
+	wantErr(t, "GetMutualFriends", err, nil)
+	wantIDs(t, "mutual friends", userIDs(mutual), []int64{ann.ID, dan.ID})
+	if total != 3 {
+		t.Fatalf("GetMutualFriends: got total %d, want 3", total)
+	}
+	mutual, _, _ = repos.Friends.GetMutualFriends(ctx, bob.ID, cat.ID, 2, 2)
+	wantIDs(t, "second page of mutual friends", userIDs(mutual), []int64{eve.ID})
+
+	suggestions, err := repos.Friends.GetSuggestions(ctx, ann.ID, 10, 0)
+	wantErr(t, "GetSuggestions", err, nil)
+	var got []int64
+	var counts []int64
+	for _, s := range suggestions {
+		got = append(got, s.ID)
+		counts = append(counts, s.MutualFriends)
+	}
+	//gus отсеивается ожидающей заявкой, сами друзья ann - тоже
+	wantIDs(t, "suggestions by mutual friends", got, []int64{dan.ID, eve.ID, fay.ID})
+	wantIDs(t, "mutual friend counts", counts, []int64{2, 2, 1})
+
+	wantErr(t, "BlockUser", repos.Friends.BlockUser(ctx, &model.Block{BlockerID: eve.ID, BlockedID: ann.ID}), nil)
+	if _, err := repos.Users.DeleteUser(fay.ID, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+	suggestions, _ = repos.Friends.GetSuggestions(ctx, ann.ID, 10, 0)
+	got = nil
+	for _, s := range suggestions {
+		got = append(got, s.ID)
+	}
+	wantIDs(t, "suggestions without blocked and deleted users", got, []int64{dan.ID})
+
+	ids, err := repos.Friends.GetFriendIDs(ctx, []int64{ann.ID, gus.ID})
+	wantErr(t, "GetFriendIDs", err, nil)
+	wantIDs(t, "friend ids of ann", slices.Sorted(slices.Values(ids[ann.ID])), []int64{bob.ID, cat.ID})
+	wantIDs(t, "friend ids of gus", slices.Sorted(slices.Values(ids[gus.ID])), []int64{cat.ID})
+}
+
+func testBlocks(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	ann := createUser(t, repos, "Ann", "Lee", "ann@example.com")
+	bob := createUser(t, repos, "Bob", "Ray", "bob@example.com")
+	cat := createUser(t, repos, "Cat", "Fox", "cat@example.com")
+	addFriendship(t, repos, bob.ID, ann.ID, model.FriendshipAccepted)
+
+	first := model.Block{BlockerID: ann.ID, BlockedID: bob.ID, CreatedAt: createdAt.Add(time.Hour)}
+	wantErr(t, "BlockUser", repos.Friends.BlockUser(ctx, &first), nil)
+	_, err := repos.Friends.GetFriendship(ctx, bob.ID, ann.ID)
+	wantErr(t, "BlockUser must remove the friendship", err, gorm.ErrRecordNotFound)
+	again := model.Block{BlockerID: ann.ID, BlockedID: bob.ID}
+	wantErr(t, "repeated block", repos.Friends.BlockUser(ctx, &again), repository.ErrBlockExists)
+	missing := model.Block{BlockerID: ann.ID, BlockedID: cat.ID + 100}
+	wantErr(t, "block of a missing user", repos.Friends.BlockUser(ctx, &missing), repository.ErrUserNotFound)
+	second := model.Block{BlockerID: ann.ID, BlockedID: cat.ID, CreatedAt: createdAt.Add(2 * time.Hour)}
+	wantErr(t, "BlockUser", repos.Friends.BlockUser(ctx, &second), nil)
+
+	for _, pair := range [][2]int64{{ann.ID, bob.ID}, {bob.ID, ann.ID}} {
+		blocked, err := repos.Friends.IsBlocked(ctx, pair[0], pair[1])
+		wantErr(t, "IsBlocked", err, nil)
+		if !blocked {
+			t.Fatalf("IsBlocked(%d, %d) must see the block in both directions", pair[0], pair[1])
+		}
+	}
+	blocks, err := repos.Friends.GetBlockedUsers(ctx, ann.ID)
+	wantErr(t, "GetBlockedUsers", err, nil)
+	if len(blocks) != 2 || blocks[0].BlockedID != cat.ID || blocks[1].BlockedID != bob.ID {
+		t.Fatalf("blocks must be newest first, got %+v", blocks)
+	}
+	if blocks[0].Blocked == nil || blocks[0].Blocked.Email != "cat@example.com" {
+		t.Fatalf("blocks must include the blocked user, got %+v", blocks[0].Blocked)
+	}
+	blocks, _ = repos.Friends.GetBlockedUsers(ctx, bob.ID)
+	if len(blocks) != 0 {
+		t.Fatalf("GetBlockedUsers must list only blocks set by the user, got %+v", blocks)
+	}
+
+	wantErr(t, "UnblockUser", repos.Friends.UnblockUser(ctx, &model.Block{BlockerID: ann.ID, BlockedID: bob.ID}), nil)
+	wantErr(t, "UnblockUser twice", repos.Friends.UnblockUser(ctx, &model.Block{BlockerID: ann.ID, BlockedID: bob.ID}),
+		repository.ErrBlockNotFound)
+	wantErr(t, "UnblockUser of a reverse block", repos.Friends.UnblockUser(ctx, &model.Block{BlockerID: cat.ID, BlockedID: ann.ID}),
+		repository.ErrBlockNotFound)
+}
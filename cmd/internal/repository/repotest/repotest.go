@@ -0,0 +1,152 @@
+// Package repotest - общий набор проверок, которым должна соответствовать каждая реализация
+// UserRepository и FriendRepository: одинаковые ошибки, уникальность email, каскадное удаление
+// и порядок выдачи. Набор запускается из теста реализации (см. run_test.go):
+//
+//	func TestMemory(t *testing.T) { repotest.Run(t, repotest.Memory) }
+//	func TestBolt(t *testing.T)   { repotest.Run(t, repotest.Bolt) }
+//	func TestPostgres(t *testing.T) {
+//		repotest.Run(t, repotest.Postgres(os.Getenv("TEST_DATABASE_URL")))
+//	}
+//
+// Каждая проверка получает новое пустое хранилище от фабрики.
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/config"
+	"github.com/UnendingLoop/users-api/cmd/internal/migrations"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"gorm.io/gorm"
+)
+
+// Repos - репозитории одного хранилища. Остальные репозитории должны видеть пользователей из Users.
+type Repos struct {
+	Users       repository.UserRepository
+	Friends     repository.FriendRepository
+	EmailTokens repository.EmailTokenRepository
+	APIKeys     repository.APIKeyRepository
+}
+
+// Factory создает репозитории поверх нового пустого хранилища для одной проверки.
+type Factory func(t *testing.T) Repos
+
+// Run выполняет все проверки набора, каждую в своем подтесте.
+func Run(t *testing.T, factory Factory) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, factory(t))
+		})
+	}
+}
+
+type testCase struct {
+	name string
+	run  func(t *testing.T, repos Repos)
+}
+
+var cases = []testCase{
+	{"CreateAndGetUser", testCreateAndGetUser},
+	{"CreateIgnoresAssociations", testCreateIgnoresAssociations},
+	{"UniqueEmail", testUniqueEmail},
+	{"ListUsers", testListUsers},
+	{"UpdateUser", testUpdateUser},
+	{"DeleteAndRestoreUser", testDeleteAndRestoreUser},
+	{"PurgeCascades", testPurgeCascades},
+	{"EmailTokenBoundToAddress", testEmailTokenBoundToAddress},
+	{"SearchUsers", testSearchUsers},
+	{"AddFriend", testAddFriend},
+	{"FriendRequests", testFriendRequests},
+	{"ReverseFriendRequest", testReverseFriendRequest},
+	{"MutualFriendsAndSuggestions", testMutualFriendsAndSuggestions},
+	{"Blocks", testBlocks},
+	{"ConcurrentCreate", testConcurrentCreate},
+}
+
+// Memory - фабрика репозиториев в памяти процесса.
+func Memory(t *testing.T) Repos {
+	store := repository.NewMemoryStore()
+	return Repos{
+		Users:       repository.NewMemoryUserRepository(store),
+		Friends:     repository.NewMemoryFriendRepository(store),
+		EmailTokens: repository.NewMemoryEmailTokenRepository(store),
+		APIKeys:     repository.NewMemoryAPIKeyRepository(store),
+	}
+}
+
+// Bolt - фабрика репозиториев на новом файле bbolt во временном каталоге проверки.
+func Bolt(t *testing.T) Repos {
+	store, err := repository.OpenBoltStore(filepath.Join(t.TempDir(), "users.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return Repos{
+		Users:       repository.NewBoltUserRepository(store),
+		Friends:     repository.NewBoltFriendRepository(store),
+		EmailTokens: repository.NewBoltEmailTokenRepository(store),
+		APIKeys:     repository.NewBoltAPIKeyRepository(store),
+	}
+}
+
+var sqliteDBs atomic.Int64
+
+// SQLite - фабрика GORM-репозиториев на отдельной базе SQLite в памяти с примененными миграциями.
+// С тегом сборки sqlite_fts5 поиск проверяется на FTS5, без него - на поиске подстрокой.
+func SQLite(t *testing.T) Repos {
+	db := config.ConnectSQLite(fmt.Sprintf("file:repotest%d?mode=memory&cache=shared", sqliteDBs.Add(1)))
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//база в памяти живет, пока открыто хотя бы одно соединение; одно соединение исключает и блокировки общего кэша
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return gormRepos(t, db)
+}
+
+// Postgres возвращает фабрику GORM-репозиториев на базе Postgres по строке подключения dsn.
+// Перед каждой проверкой применяются миграции и очищаются все таблицы, поэтому база должна быть
+// отдельной, тестовой. При пустом dsn проверки пропускаются.
+func Postgres(dsn string) Factory {
+	return func(t *testing.T) Repos {
+		if dsn == "" {
+			t.Skip("Postgres DSN is not set")
+		}
+		db := config.ConnectPostgres(dsn)
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sqlDB.Close() })
+		repos := gormRepos(t, db)
+		err = db.Exec(`TRUNCATE users, friendships, blocks, refresh_tokens, api_keys, recovery_codes,
+			email_tokens, user_search RESTART IDENTITY CASCADE`).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repos
+	}
+}
+
+// gormRepos применяет миграции и создает GORM-репозитории
+func gormRepos(t *testing.T, db *gorm.DB) Repos {
+	t.Helper()
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return Repos{
+		Users:       repository.NewGormUserRepository(db),
+		Friends:     repository.NewGormFriendRepository(db),
+		EmailTokens: repository.NewGormEmailTokenRepository(db),
+		APIKeys:     repository.NewGormAPIKeyRepository(db),
+	}
+}
@@ -0,0 +1,23 @@
+package repotest_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/repository/repotest"
+)
+
+func TestMemory(t *testing.T) { repotest.Run(t, repotest.Memory) }
+
+func TestSQLite(t *testing.T) { repotest.Run(t, repotest.SQLite) }
+
+func TestBolt(t *testing.T) { repotest.Run(t, repotest.Bolt) }
+
+// TestPostgres запускается на отдельной тестовой базе из TEST_DATABASE_URL: таблицы очищаются перед каждой проверкой.
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	repotest.Run(t, repotest.Postgres(dsn))
+}
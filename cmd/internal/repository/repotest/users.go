@@ -0,0 +1,412 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"gorm.io/gorm"
+)
+
+// createUser сохраняет пользователя и прерывает проверку при ошибке
+func createUser(t *testing.T, repos Repos, name, surname, email string) model.User {
+	t.Helper()
+	user := model.User{Name: name, Surname: surname, Email: email}
+	if err := repos.Users.CreateUser(&user, context.Background()); err != nil {
+		t.Fatalf("CreateUser(%s): %v", email, err)
+	}
+	return user
+}
+
+// wantErr проверяет, что err - это target (nil - ошибки быть не должно)
+func wantErr(t *testing.T, what string, err, target error) {
+	t.Helper()
+	switch {
+	case target == nil && err != nil:
+		t.Fatalf("%s: unexpected error %v", what, err)
+	case target != nil && !errors.Is(err, target):
+		t.Fatalf("%s: got error %v, want %v", what, err, target)
+	}
+}
+
+// userIDs - id пользователей в порядке выдачи
+func userIDs(users []model.User) []int64 {
+	ids := make([]int64, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+func wantIDs(t *testing.T, what string, got, want []int64) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("%s: got ids %v, want %v", what, got, want)
+	}
+}
+
+func testCreateAndGetUser(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	first := createUser(t, repos, "Ann", "Lee", "ann@example.com")
+	second := createUser(t, repos, "Bob", "Ray", "bob@example.com")
+	if first.ID <= 0 || second.ID <= first.ID {
+		t.Fatalf("ids must be positive and increasing, got %d and %d", first.ID, second.ID)
+	}
+	if first.Version != 1 || first.Role != model.RoleUser {
+		t.Fatalf("defaults: got version %d and role %q, want 1 and %q", first.Version, first.Role, model.RoleUser)
+	}
+
+	got, err := repos.Users.GetUserByID(first.ID, ctx)
+	wantErr(t, "GetUserByID", err, nil)
+	if got.Name != "Ann" || got.Surname != "Lee" || got.Email != "ann@example.com" || got.Version != 1 {
+		t.Fatalf("GetUserByID: got %+v", got)
+	}
+	got, err = repos.Users.GetUserByEmail("ANN@Example.com", ctx)
+	wantErr(t, "GetUserByEmail ignores case", err, nil)
+	if got.ID != first.ID {
+		t.Fatalf("GetUserByEmail: got id %d, want %d", got.ID, first.ID)
+	}
+	//id назначает хранилище: занятый id не перезаписывает пользователя и не выдается за занятый email
+	third := model.User{ID: first.ID, Name: "Cid", Surname: "Roe", Email: "cid@example.com"}
+	wantErr(t, "CreateUser with a taken id", repos.Users.CreateUser(&third, ctx), nil)
+	if third.ID <= second.ID {
+		t.Fatalf("CreateUser must assign a new id, got %d", third.ID)
+	}
+	got, err = repos.Users.GetUserByID(first.ID, ctx)
+	wantErr(t, "GetUserByID", err, nil)
+	if got.Email != "ann@example.com" {
+		t.Fatalf("CreateUser with a taken id overwrote the user: got %+v", got)
+	}
+
+	_, err = repos.Users.GetUserByID(second.ID+100, ctx)
+	wantErr(t, "GetUserByID of a missing user", err, gorm.ErrRecordNotFound)
+	_, err = repos.Users.GetUserByEmail("nobody@example.com", ctx)
+	wantErr(t, "GetUserByEmail of a missing user", err, gorm.ErrRecordNotFound)
+
+	wantErr(t, "CheckIfExistsByID", repos.Users.CheckIfExistsByID(first.ID, ctx), repository.ErrUserExists)
+	wantErr(t, "CheckIfExistsByID of a missing user", repos.Users.CheckIfExistsByID(second.ID+100, ctx), repository.ErrUserNotFound)
+	wantErr(t, "CheckIfExistsByID of a negative id", repos.Users.CheckIfExistsByID(-1, ctx), repository.ErrInvalidField)
+}
+
+func testUniqueEmail(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	ann := createUser(t, repos, "Ann", "Lee", "ann@example.com")
+
+	dup := model.User{Name: "Ann", Surname: "Other", Email: "ann@example.com"}
+	wantErr(t, "duplicate email", repos.Users.CreateUser(&dup, ctx), repository.ErrEmailExists)
+	dup = model.User{Name: "Ann", Surname: "Other", Email: "Ann@Example.com"}
+	wantErr(t, "duplicate email in another case", repos.Users.CreateUser(&dup, ctx), repository.ErrEmailExists)
+	createUser(t, repos, "Ёж", "Lee", "Ёж@example.ru")
+	dup = model.User{Name: "Ёж", Surname: "Other", Email: "ёж@example.ru"}
+	wantErr(t, "duplicate email in another case outside ASCII", repos.Users.CreateUser(&dup, ctx), repository.ErrEmailExists)
+	got, err := repos.Users.GetUserByEmail("ёЖ@example.ru", ctx)
+	wantErr(t, "GetUserByEmail ignores case outside ASCII", err, nil)
+	if got.Email != "Ёж@example.ru" {
+		t.Fatalf("GetUserByEmail: got %q, want Ёж@example.ru", got.Email)
+	}
+
+	//адрес мягко удаленного пользователя остается занятым до окончательной очистки
+	_, err = repos.Users.DeleteUser(ann.ID, 0, ctx)
+	wantErr(t, "DeleteUser", err, nil)
+	dup = model.User{Name: "Ann", Surname: "Other", Email: "ann@example.com"}
+	wantErr(t, "email of a deleted user", repos.Users.CreateUser(&dup, ctx), repository.ErrEmailExists)
+	_, err = repos.Users.PurgeDeletedUsers(time.Now().Add(time.Hour), ctx)
+	wantErr(t, "PurgeDeletedUsers", err, nil)
+	createUser(t, repos, "Ann", "Other", "ann@example.com")
+}
+
+// testCreateIgnoresAssociations - дружба появляется только через заявку, поэтому связи Friends и FriendOf
+// нового пользователя не сохраняются ни одним хранилищем
+func testCreateIgnoresAssociations(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	ann := createUser(t, repos, "Ann", "Lee", "ann@example.com")
+	bob := createUser(t, repos, "Bob", "Ray", "bob@example.com")
+	cat := model.User{Name: "Cat", Surname: "Fox", Email: "cat@example.com",
+		Friends:  []*model.Friendship{{AccepterID: ann.ID, Status: model.FriendshipAccepted}},
+		FriendOf: []*model.Friendship{{RequesterID: bob.ID, Status: model.FriendshipPending}},
+	}
+	wantErr(t, "CreateUser with associations", repos.Users.CreateUser(&cat, ctx), nil)
+
+	_, err := repos.Friends.GetFriendship(ctx, cat.ID, ann.ID)
+	wantErr(t, "friendship from Friends", err, gorm.ErrRecordNotFound)
+	_, err = repos.Friends.GetFriendship(ctx, bob.ID, cat.ID)
+	wantErr(t, "friend request from FriendOf", err, gorm.ErrRecordNotFound)
+	friends, err := repos.Friends.GetFriends(ctx, ann.ID)
+	wantErr(t, "GetFriends", err, nil)
+	wantIDs(t, "friends of the user named in Friends", userIDs(friends), nil)
+}
+
+func testListUsers(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	a := createUser(t, repos, "Zoe", "Smith", "zoe@example.com")
+	b := createUser(t, repos, "Adam", "Smith", "adam@test.org")
+	c := createUser(t, repos, "Zoe", "Brown", "zb@example.com")
+	d := createUser(t, repos, "eve", "Black", "eve@example.com")
+	deleted := createUser(t, repos, "Zoe", "Gone", "gone@example.com")
+	if _, err := repos.Users.DeleteUser(deleted.ID, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(query repository.ListUsersQuery) []int64 {
+		t.Helper()
+		users, err := repos.Users.ListUsers(query, ctx)
+		wantErr(t, "ListUsers", err, nil)
+		return userIDs(users)
+	}
+	wantIDs(t, "default order", list(repository.ListUsersQuery{}), []int64{a.ID, b.ID, c.ID, d.ID})
+	//строки сравниваются побайтово: заглавные буквы раньше строчных
+	byName := []repository.SortField{{Field: "name", Desc: true}}
+	wantIDs(t, "sort by name desc", list(repository.ListUsersQuery{Sort: byName}), []int64{d.ID, a.ID, c.ID, b.ID})
+	wantIDs(t, "limit and offset", list(repository.ListUsersQuery{Sort: byName, Limit: 2, Offset: 1}), []int64{a.ID, c.ID})
+	after := &repository.Keyset{Values: []string{"Zoe"}, ID: a.ID}
+	wantIDs(t, "keyset", list(repository.ListUsersQuery{Sort: byName, After: after}), []int64{c.ID, b.ID})
+	wantIDs(t, "sort by id desc", list(repository.ListUsersQuery{Sort: []repository.SortField{{Field: "id", Desc: true}}}),
+		[]int64{d.ID, c.ID, b.ID, a.ID})
+
+	filter := repository.UserFilter{Name: "zoe"}
+	wantIDs(t, "filter by name", list(repository.ListUsersQuery{Filter: filter}), []int64{a.ID, c.ID})
+	filter = repository.UserFilter{EmailDomain: "@EXAMPLE.com", Surname: "smith"}
+	wantIDs(t, "filter by domain and surname", list(repository.ListUsersQuery{Filter: filter}), []int64{a.ID})
+	filter = repository.UserFilter{Query: "B"}
+	wantIDs(t, "filter by query", list(repository.ListUsersQuery{Filter: filter}), []int64{c.ID, d.ID})
+	count, err := repos.Users.CountUsers(repository.UserFilter{Name: "Zoe"}, ctx)
+	wantErr(t, "CountUsers", err, nil)
+	if count != 2 {
+		t.Fatalf("CountUsers: got %d, want 2", count)
+	}
+	//регистр не учитывается и вне ASCII
+	e := createUser(t, repos, "Ёжик", "Иванов", "ezh@example.ru")
+	wantIDs(t, "filter by a Cyrillic name", list(repository.ListUsersQuery{Filter: repository.UserFilter{Name: "ёЖИК"}}), []int64{e.ID})
+	wantIDs(t, "filter by a Cyrillic surname", list(repository.ListUsersQuery{Filter: repository.UserFilter{Surname: "иванов"}}), []int64{e.ID})
+	wantIDs(t, "filter by a Cyrillic query", list(repository.ListUsersQuery{Filter: repository.UserFilter{Query: "ЖИК"}}), []int64{e.ID})
+
+	_, err = repos.Users.ListUsers(repository.ListUsersQuery{Sort: []repository.SortField{{Field: "password_hash"}}}, ctx)
+	wantErr(t, "unknown sort field", err, repository.ErrInvalidSort)
+	_, err = repos.Users.ListUsers(repository.ListUsersQuery{Filter: repository.UserFilter{EmailDomain: "a@b"}}, ctx)
+	wantErr(t, "invalid email domain", err, repository.ErrInvalidFilter)
+	_, err = repos.Users.ListUsers(repository.ListUsersQuery{After: &repository.Keyset{Values: []string{"x"}}}, ctx)
+	wantErr(t, "cursor for another order", err, repository.ErrInvalidCursor)
+}
+
+func testUpdateUser(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	ann := createUser(t, repos, "Ann", "Lee", "ann@example.com")
+	createUser(t, repos, "Bob", "Ray", "bob@example.com")
+
+	ann.Name = "Anna"
+	wantErr(t, "UpdateUser", repos.Users.UpdateUser(&ann, ctx), nil)
+	if ann.Version != 2 {
+		t.Fatalf("UpdateUser must increment version, got %d", ann.Version)
+	}
+	got, _ := repos.Users.GetUserByID(ann.ID, ctx)
+	if got.Name != "Anna" || got.Version != 2 {
+		t.Fatalf("after UpdateUser: got %+v", got)
+	}
+
+	stale := ann
+	stale.Version = 1
+	stale.Name = "Stale"
+	wantErr(t, "UpdateUser of a stale version", repos.Users.UpdateUser(&stale, ctx), repository.ErrVersionMismatch)
+	if stale.Version != 1 {
+		t.Fatalf("failed UpdateUser must keep the version, got %d", stale.Version)
+	}
+
+	taken := ann
+	taken.Email = "BOB@example.com"
+	wantErr(t, "UpdateUser to a taken email", repos.Users.UpdateUser(&taken, ctx), repository.ErrEmailExists)
+	own := ann
+	own.Email = "ANN@example.com"
+	wantErr(t, "UpdateUser of own email case", repos.Users.UpdateUser(&own, ctx), nil)
+
+	if _, err := repos.Users.DeleteUser(ann.ID, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+	wantErr(t, "UpdateUser of a deleted user", repos.Users.UpdateUser(&own, ctx), repository.ErrUserNotFound)
+}
+
+func testDeleteAndRestoreUser(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	ann := createUser(t, repos, "Ann", "Lee", "ann@example.com")
+
+	_, err := repos.Users.DeleteUser(ann.ID, 5, ctx)
+	wantErr(t, "DeleteUser of another version", err, repository.ErrVersionMismatch)
+	n, err := repos.Users.DeleteUser(ann.ID, 1, ctx)
+	wantErr(t, "DeleteUser", err, nil)
+	if n != 1 {
+		t.Fatalf("DeleteUser: got %d rows, want 1", n)
+	}
+	n, err = repos.Users.DeleteUser(ann.ID, 0, ctx)
+	wantErr(t, "DeleteUser of a deleted user", err, nil)
+	if n != 0 {
+		t.Fatalf("DeleteUser of a deleted user: got %d rows, want 0", n)
+	}
+	_, err = repos.Users.DeleteUser(ann.ID, 1, ctx)
+	wantErr(t, "DeleteUser of a deleted user with version", err, repository.ErrUserNotFound)
+	_, err = repos.Users.GetUserByID(ann.ID, ctx)
+	wantErr(t, "GetUserByID of a deleted user", err, gorm.ErrRecordNotFound)
+	wantErr(t, "CheckIfExistsByID of a deleted user", repos.Users.CheckIfExistsByID(ann.ID, ctx), repository.ErrUserNotFound)
+
+	wantErr(t, "RestoreUser", repos.Users.RestoreUser(ann.ID, ctx), nil)
+	wantErr(t, "RestoreUser of an active user", repos.Users.RestoreUser(ann.ID, ctx), repository.ErrUserNotDeleted)
+	wantErr(t, "RestoreUser of a missing user", repos.Users.RestoreUser(ann.ID+100, ctx), repository.ErrUserNotFound)
+	got, err := repos.Users.GetUserByID(ann.ID, ctx)
+	wantErr(t, "GetUserByID of a restored user", err, nil)
+	if got.Version != 1 {
+		t.Fatalf("delete and restore must keep the version, got %d", got.Version)
+	}
+}
+
+func testPurgeCascades(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	ann := createUser(t, repos, "Ann", "Lee", "ann@example.com")
+	bob := createUser(t, repos, "Bob", "Ray", "bob@example.com")
+	cat := createUser(t, repos, "Cat", "Fox", "cat@example.com")
+	addFriendship(t, repos, ann.ID, bob.ID, model.FriendshipAccepted)
+	addFriendship(t, repos, cat.ID, ann.ID, model.FriendshipPending)
+	wantErr(t, "BlockUser", repos.Friends.BlockUser(ctx, &model.Block{BlockerID: bob.ID, BlockedID: cat.ID}), nil)
+	for _, key := range []model.APIKey{{Name: "ann", Prefix: "ann-key", CreatedBy: ann.ID}, {Name: "cat", Prefix: "cat-key", CreatedBy: cat.ID}} {
+		wantErr(t, "CreateAPIKey", repos.APIKeys.CreateAPIKey(ctx, &key), nil)
+	}
+
+	//мягкое удаление скрывает пользователя из друзей, восстановление возвращает связи
+	if _, err := repos.Users.DeleteUser(ann.ID, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+	friends, err := repos.Friends.GetFriends(ctx, bob.ID)
+	wantErr(t, "GetFriends", err, nil)
+	wantIDs(t, "friends of a deleted user are hidden", userIDs(friends), nil)
+	wantErr(t, "RestoreUser", repos.Users.RestoreUser(ann.ID, ctx), nil)
+	friends, _ = repos.Friends.GetFriends(ctx, bob.ID)
+	wantIDs(t, "friends after restore", userIDs(friends), []int64{ann.ID})
+
+	if _, err := repos.Users.DeleteUser(ann.ID, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Users.DeleteUser(bob.ID, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+	purged, err := repos.Users.PurgeDeletedUsers(time.Now().Add(-time.Hour), ctx)
+	wantErr(t, "PurgeDeletedUsers before deletion", err, nil)
+	if purged != 0 {
+		t.Fatalf("PurgeDeletedUsers must keep recently deleted users, purged %d", purged)
+	}
+	purged, err = repos.Users.PurgeDeletedUsers(time.Now().Add(time.Hour), ctx)
+	wantErr(t, "PurgeDeletedUsers", err, nil)
+	if purged != 2 {
+		t.Fatalf("PurgeDeletedUsers: purged %d, want 2", purged)
+	}
+	wantErr(t, "RestoreUser of a purged user", repos.Users.RestoreUser(ann.ID, ctx), repository.ErrUserNotFound)
+
+	_, err = repos.Friends.GetFriendship(ctx, cat.ID, ann.ID)
+	wantErr(t, "friend request of a purged user", err, gorm.ErrRecordNotFound)
+	blocked, err := repos.Friends.IsBlocked(ctx, bob.ID, cat.ID)
+	wantErr(t, "IsBlocked", err, nil)
+	if blocked {
+		t.Fatal("blocks of a purged user must be removed")
+	}
+	_, err = repos.APIKeys.GetAPIKeyByPrefix(ctx, "ann-key")
+	wantErr(t, "API key of a purged user", err, gorm.ErrRecordNotFound)
+	_, err = repos.APIKeys.GetAPIKeyByPrefix(ctx, "cat-key")
+	wantErr(t, "API key of an active user", err, nil)
+	createUser(t, repos, "Ann", "Again", "ann@example.com")
+}
+
+// токен из письма действует только для адреса, на который письмо ушло
+func testEmailTokenBoundToAddress(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	ann := createUser(t, repos, "Ann", "Lee", "ann@example.com")
+	now := time.Now()
+	issue := func(purpose auth.Purpose, nonce, email string) {
+		t.Helper()
+		token := model.EmailToken{UserID: ann.ID, Purpose: string(purpose), Nonce: nonce, Email: email, ExpiresAt: now.Add(time.Hour)}
+		wantErr(t, "CreateEmailToken", repos.EmailTokens.CreateEmailToken(ctx, &token), nil)
+	}
+	issue(auth.PurposePasswordReset, "reset-old", "ann@example.com")
+	issue(auth.PurposeVerifyEmail, "verify-old", "ann@example.com")
+
+	ann.Email, ann.EmailVerifiedAt = "ann@example.org", nil
+	wantErr(t, "UpdateUser", repos.Users.UpdateUser(&ann, ctx), nil)
+	wantErr(t, "ResetPassword with a link to the previous email",
+		repos.EmailTokens.ResetPassword(ctx, ann.ID, "reset-old", "hash", now), repository.ErrInvalidToken)
+	wantErr(t, "VerifyEmail with a link to the previous email",
+		repos.EmailTokens.VerifyEmail(ctx, ann.ID, "verify-old", now), repository.ErrInvalidToken)
+	//даже не погашенный при смене токен не подходит к другому адресу
+	issue(auth.PurposeVerifyEmail, "verify-stale", "ann@example.com")
+	wantErr(t, "VerifyEmail with a token for another address",
+		repos.EmailTokens.VerifyEmail(ctx, ann.ID, "verify-stale", now), repository.ErrInvalidToken)
+	got, _ := repos.Users.GetUserByID(ann.ID, ctx)
+	if got.EmailVerifiedAt != nil {
+		t.Fatal("a link to the previous email must not verify the new one")
+	}
+
+	issue(auth.PurposeVerifyEmail, "verify-new", "ann@example.org")
+	wantErr(t, "VerifyEmail", repos.EmailTokens.VerifyEmail(ctx, ann.ID, "verify-new", now), nil)
+	got, _ = repos.Users.GetUserByID(ann.ID, ctx)
+	if got.EmailVerifiedAt == nil {
+		t.Fatal("VerifyEmail must verify the current email")
+	}
+}
+
+func testSearchUsers(t *testing.T, repos Repos) {
+	ctx := context.Background()
+	ivanov := createUser(t, repos, "Иван", "Иванов", "ivan@example.com")
+	createUser(t, repos, "John", "Smith", "john@example.com")
+	deleted := createUser(t, repos, "Ivan", "Ivanov", "deleted@example.com")
+	if _, err := repos.Users.DeleteUser(deleted.ID, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err := repos.Users.SearchUsers("ivanof", 10, ctx)
+	if errors.Is(err, repository.ErrSearchUnavailable) {
+		t.Skip("search is not available")
+	}
+	wantErr(t, "SearchUsers", err, nil)
+	if len(hits) != 1 || hits[0].ID != ivanov.ID || hits[0].Score <= 0 {
+		t.Fatalf("SearchUsers must find the transliterated name with a typo, got %+v", hits)
+	}
+	updated := ivanov
+	updated.Surname = "Petrov"
+	wantErr(t, "UpdateUser", repos.Users.UpdateUser(&updated, ctx), nil)
+	hits, err = repos.Users.SearchUsers("petrov", 10, ctx)
+	wantErr(t, "SearchUsers", err, nil)
+	if len(hits) != 1 || hits[0].ID != ivanov.ID {
+		t.Fatalf("SearchUsers must see updated names, got %+v", hits)
+	}
+	//пунктуация при нормализации заменяется пробелами, и от запроса ничего не остается
+	_, err = repos.Users.SearchUsers("!!!", 10, ctx)
+	wantErr(t, "SearchUsers with punctuation only", err, repository.ErrEmptySearchQuery)
+}
+
+func testConcurrentCreate(t *testing.T, repos Repos) {
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := model.User{Name: fmt.Sprint("User", i), Surname: "Same", Email: "same@example.com"}
+			errs <- repos.Users.CreateUser(&user, context.Background())
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, repository.ErrEmailExists):
+			t.Fatalf("concurrent CreateUser: unexpected error %v", err)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("exactly one concurrent CreateUser must win, %d did", created)
+	}
+}
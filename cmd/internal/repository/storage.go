@@ -0,0 +1,64 @@
+package repository
+
+import "gorm.io/gorm"
+
+// Storage - репозитории одного хранилища данных, из которых собирается сервис.
+type Storage struct {
+	Users       UserRepository
+	Friends     FriendRepository
+	Tokens      TokenRepository
+	TwoFactor   TwoFactorRepository
+	EmailTokens EmailTokenRepository
+	APIKeys     APIKeyRepository
+	// DB - база SQL-хранилища: к ней применяются миграции и по ней строится поисковый индекс.
+	// nil у хранилищ, которым SQL-схема не нужна.
+	DB *gorm.DB
+	// Close закрывает хранилище
+	Close func() error
+}
+
+// NewGormStorage создает GORM-репозитории поверх базы db.
+func NewGormStorage(db *gorm.DB) *Storage {
+	return &Storage{
+		Users:       NewGormUserRepository(db),
+		Friends:     NewGormFriendRepository(db),
+		Tokens:      NewGormTokenRepository(db),
+		TwoFactor:   NewGormTwoFactorRepository(db),
+		EmailTokens: NewGormEmailTokenRepository(db),
+		APIKeys:     NewGormAPIKeyRepository(db),
+		DB:          db,
+		Close: func() error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.Close()
+		},
+	}
+}
+
+// NewBoltStorage создает репозитории поверх хранилища bbolt.
+func NewBoltStorage(store *BoltStore) *Storage {
+	return &Storage{
+		Users:       NewBoltUserRepository(store),
+		Friends:     NewBoltFriendRepository(store),
+		Tokens:      NewBoltTokenRepository(store),
+		TwoFactor:   NewBoltTwoFactorRepository(store),
+		EmailTokens: NewBoltEmailTokenRepository(store),
+		APIKeys:     NewBoltAPIKeyRepository(store),
+		Close:       store.Close,
+	}
+}
+
+// NewMemoryStorage создает репозитории поверх хранилища в памяти процесса.
+func NewMemoryStorage(store *MemoryStore) *Storage {
+	return &Storage{
+		Users:       NewMemoryUserRepository(store),
+		Friends:     NewMemoryFriendRepository(store),
+		Tokens:      NewMemoryTokenRepository(store),
+		TwoFactor:   NewMemoryTwoFactorRepository(store),
+		EmailTokens: NewMemoryEmailTokenRepository(store),
+		APIKeys:     NewMemoryAPIKeyRepository(store),
+		Close:       func() error { return nil },
+	}
+}
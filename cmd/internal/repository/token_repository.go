@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"gorm.io/gorm"
+)
+
+// TokenRepository определяет контракт хранения refresh-токенов.
+type TokenRepository interface {
+	// CreateRefreshToken сохраняет новый refresh-токен.
+	CreateRefreshToken(ctx context.Context, token *model.RefreshToken) error
+
+	// GetRefreshToken возвращает токен по хэшу или gorm.ErrRecordNotFound.
+	GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error)
+
+	// RotateRefreshToken атомарно отзывает old и сохраняет next. Если old уже отозван
+	// параллельным запросом, возвращает ErrInvalidToken и ничего не сохраняет.
+	RotateRefreshToken(ctx context.Context, old *model.RefreshToken, next *model.RefreshToken) error
+
+	// RevokeTokenFamily отзывает все действующие токены семейства.
+	RevokeTokenFamily(ctx context.Context, familyID string) error
+}
+
+// GormTokenRepository — реализация TokenRepository на базе GORM ORM.
+type GormTokenRepository struct {
+	DB *gorm.DB
+}
+
+// NewGormTokenRepository создает новый экземпляр GormTokenRepository.
+func NewGormTokenRepository(db *gorm.DB) *GormTokenRepository {
+	return &GormTokenRepository{DB: db}
+}
+
+func (r *GormTokenRepository) CreateRefreshToken(ctx context.Context, token *model.RefreshToken) error {
+	return r.DB.WithContext(ctx).Create(token).Error
+}
+func (r *GormTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	var token model.RefreshToken
+	err := r.DB.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+func (r *GormTokenRepository) RotateRefreshToken(ctx context.Context, old *model.RefreshToken, next *model.RefreshToken) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", old.ID).
+			Update("revoked_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidToken
+		}
+		return tx.Create(next).Error
+	})
+}
+func (r *GormTokenRepository) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	return r.DB.WithContext(ctx).Model(&model.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
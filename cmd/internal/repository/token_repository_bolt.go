@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	bolt "go.etcd.io/bbolt"
+	"gorm.io/gorm"
+)
+
+// BoltTokenRepository - реализация TokenRepository во встроенной базе bbolt.
+type BoltTokenRepository struct {
+	Store *BoltStore
+}
+
+// NewBoltTokenRepository создает репозиторий refresh-токенов поверх хранилища store.
+func NewBoltTokenRepository(store *BoltStore) *BoltTokenRepository {
+	return &BoltTokenRepository{Store: store}
+}
+
+func (r *BoltTokenRepository) CreateRefreshToken(ctx context.Context, token *model.RefreshToken) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		return boltCreateRefreshToken(tx, token)
+	})
+}
+func (r *BoltTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	var token model.RefreshToken
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		key := tx.Bucket(bucketRefreshTokenHashes).Get([]byte(tokenHash))
+		if key == nil {
+			return gorm.ErrRecordNotFound
+		}
+		_, err := boltGet(tx.Bucket(bucketRefreshTokens), key, &token)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+func (r *BoltTokenRepository) RotateRefreshToken(ctx context.Context, old *model.RefreshToken, next *model.RefreshToken) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		tokens := tx.Bucket(bucketRefreshTokens)
+		key := boltKey(old.UserID, old.ID)
+		var stored model.RefreshToken
+		found, err := boltGet(tokens, key, &stored)
+		if err != nil {
+			return err
+		}
+		if !found || stored.RevokedAt != nil {
+			return ErrInvalidToken
+		}
+		now := time.Now()
+		stored.RevokedAt = &now
+		if err := boltPut(tokens, key, stored); err != nil {
+			return err
+		}
+		return boltCreateRefreshToken(tx, next)
+	})
+}
+
+// RevokeTokenFamily перебирает все токены: семейство отзывается только при повторном
+// предъявлении токена, поэтому отдельный индекс по нему не нужен.
+func (r *BoltTokenRepository) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		return boltRevokeRefreshTokens(tx, nil, time.Now(), func(t model.RefreshToken) bool {
+			return t.FamilyID == familyID
+		})
+	})
+}
+
+// boltCreateRefreshToken сохраняет новый токен, назначая ему id. Хэш токена уникален, а владелец
+// должен существовать, как того требуют ограничения таблицы refresh_tokens.
+func boltCreateRefreshToken(tx *bolt.Tx, token *model.RefreshToken) error {
+	hashes := tx.Bucket(bucketRefreshTokenHashes)
+	if hashes.Get([]byte(token.TokenHash)) != nil {
+		return fmt.Errorf("refresh token hash already exists")
+	}
+	if _, found, err := boltUser(tx, token.UserID); err != nil {
+		return err
+	} else if !found {
+		return ErrUserNotFound
+	}
+	tokens := tx.Bucket(bucketRefreshTokens)
+	id, err := boltID(tokens, token.ID)
+	if err != nil {
+		return err
+	}
+	stored := *token
+	stored.ID, stored.User = id, nil
+	if stored.CreatedAt.IsZero() {
+		stored.CreatedAt = time.Now()
+	}
+	key := boltKey(stored.UserID, id)
+	if err := boltPut(tokens, key, stored); err != nil {
+		return err
+	}
+	if err := hashes.Put([]byte(stored.TokenHash), key); err != nil {
+		return err
+	}
+	token.ID, token.CreatedAt = stored.ID, stored.CreatedAt
+	return nil
+}
+
+// boltRevokeRefreshTokens отзывает в момент at действующие токены, ключ которых начинается с prefix
+// и для которых match сообщает true
+func boltRevokeRefreshTokens(tx *bolt.Tx, prefix []byte, at time.Time, match func(model.RefreshToken) bool) error {
+	tokens := tx.Bucket(bucketRefreshTokens)
+	var revoked []model.RefreshToken
+	err := boltEach(tokens, prefix, func(_ []byte, t model.RefreshToken) error {
+		if t.RevokedAt == nil && match(t) {
+			t.RevokedAt = &at
+			revoked = append(revoked, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, t := range revoked {
+		if err := boltPut(tokens, boltKey(t.UserID, t.ID), t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"gorm.io/gorm"
+)
+
+// MemoryTokenRepository - реализация TokenRepository в памяти процесса.
+type MemoryTokenRepository struct {
+	Store *MemoryStore
+}
+
+// NewMemoryTokenRepository создает репозиторий refresh-токенов поверх хранилища store.
+func NewMemoryTokenRepository(store *MemoryStore) *MemoryTokenRepository {
+	return &MemoryTokenRepository{Store: store}
+}
+
+func (r *MemoryTokenRepository) CreateRefreshToken(ctx context.Context, token *model.RefreshToken) error {
+	return r.Store.write(ctx, func() error {
+		return r.Store.createRefreshToken(token)
+	})
+}
+func (r *MemoryTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	var token model.RefreshToken
+	err := r.Store.read(ctx, func() error {
+		id, ok := r.Store.tokenHashes[tokenHash]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		token = r.Store.refreshTokens[id]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+func (r *MemoryTokenRepository) RotateRefreshToken(ctx context.Context, old *model.RefreshToken, next *model.RefreshToken) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		stored, ok := s.refreshTokens[old.ID]
+		if !ok || stored.RevokedAt != nil {
+			return ErrInvalidToken
+		}
+		if err := s.createRefreshToken(next); err != nil {
+			return err
+		}
+		now := time.Now()
+		stored.RevokedAt = &now
+		s.refreshTokens[stored.ID] = stored
+		return nil
+	})
+}
+func (r *MemoryTokenRepository) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	return r.Store.write(ctx, func() error {
+		r.Store.revokeRefreshTokens(time.Now(), func(t model.RefreshToken) bool {
+			return t.FamilyID == familyID
+		})
+		return nil
+	})
+}
+
+// createRefreshToken сохраняет новый токен, назначая ему id. Хэш токена уникален, а владелец
+// должен существовать, как того требуют ограничения таблицы refresh_tokens.
+func (s *MemoryStore) createRefreshToken(token *model.RefreshToken) error {
+	if _, taken := s.tokenHashes[token.TokenHash]; taken {
+		return fmt.Errorf("refresh token hash already exists")
+	}
+	if _, ok := s.users[token.UserID]; !ok {
+		return ErrUserNotFound
+	}
+	token.ID = s.nextID("refresh_tokens", token.ID)
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	stored := *token
+	stored.User = nil
+	s.refreshTokens[stored.ID] = stored
+	s.tokenHashes[stored.TokenHash] = stored.ID
+	return nil
+}
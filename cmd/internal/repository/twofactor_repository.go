@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"gorm.io/gorm"
+)
+
+// TwoFactorRepository определяет контракт хранения TOTP-секретов и кодов восстановления.
+type TwoFactorRepository interface {
+	// SetTOTPSecret сохраняет секрет неподтвержденной настройки 2FA, заменяя предыдущий.
+	// Возвращает ErrTOTPAlreadyEnabled, если 2FA у пользователя уже включена.
+	SetTOTPSecret(ctx context.Context, userID int64, secret string) error
+
+	// EnableTOTP включает 2FA, запоминает принятый шаг и заменяет коды восстановления.
+	EnableTOTP(ctx context.Context, userID int64, step int64, codes []model.RecoveryCode) error
+
+	// DisableTOTP выключает 2FA, стирает секрет и коды восстановления.
+	DisableTOTP(ctx context.Context, userID int64) error
+
+	// AdvanceTOTPStep принимает временной шаг, только если он новее последнего принятого.
+	// Повторное предъявление кода того же или более раннего шага возвращает ErrInvalidOTP.
+	AdvanceTOTPStep(ctx context.Context, userID int64, step int64) error
+
+	// UseRecoveryCode погашает неиспользованный код восстановления по хэшу или возвращает ErrInvalidOTP.
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string, at time.Time) error
+}
+
+// GormTwoFactorRepository — реализация TwoFactorRepository на базе GORM ORM.
+type GormTwoFactorRepository struct {
+	DB *gorm.DB
+}
+
+// NewGormTwoFactorRepository создает новый экземпляр GormTwoFactorRepository.
+func NewGormTwoFactorRepository(db *gorm.DB) *GormTwoFactorRepository {
+	return &GormTwoFactorRepository{DB: db}
+}
+
+func (r *GormTwoFactorRepository) SetTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	res := r.DB.WithContext(ctx).Model(&model.User{}).
+		Where("id = ? AND totp_enabled = ?", userID, false).
+		Updates(map[string]any{"totp_secret": secret, "totp_last_step": 0})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+func (r *GormTwoFactorRepository) EnableTOTP(ctx context.Context, userID int64, step int64, codes []model.RecoveryCode) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.User{}).
+			Where("id = ? AND totp_enabled = ? AND totp_secret <> ''", userID, false).
+			Updates(map[string]any{"totp_enabled": true, "totp_last_step": step, "version": nextVersion})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrTOTPAlreadyEnabled
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&codes).Error
+	})
+}
+func (r *GormTwoFactorRepository) DisableTOTP(ctx context.Context, userID int64) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", userID).
+			Updates(map[string]any{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0, "version": nextVersion}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error
+	})
+}
+func (r *GormTwoFactorRepository) AdvanceTOTPStep(ctx context.Context, userID int64, step int64) error {
+	res := r.DB.WithContext(ctx).Model(&model.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidOTP
+	}
+	return nil
+}
+func (r *GormTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string, at time.Time) error {
+	res := r.DB.WithContext(ctx).Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", at)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidOTP
+	}
+	return nil
+}
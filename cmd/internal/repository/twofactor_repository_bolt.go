@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltTwoFactorRepository - реализация TwoFactorRepository во встроенной базе bbolt.
+type BoltTwoFactorRepository struct {
+	Store *BoltStore
+}
+
+// NewBoltTwoFactorRepository создает репозиторий 2FA поверх хранилища store.
+func NewBoltTwoFactorRepository(store *BoltStore) *BoltTwoFactorRepository {
+	return &BoltTwoFactorRepository{Store: store}
+}
+
+func (r *BoltTwoFactorRepository) SetTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		return boltUpdateUser(tx, userID, func(user *model.User) error {
+			if user.TOTPEnabled {
+				return ErrTOTPAlreadyEnabled
+			}
+			user.TOTPSecret, user.TOTPLastStep = secret, 0
+			return nil
+		}, ErrTOTPAlreadyEnabled)
+	})
+}
+func (r *BoltTwoFactorRepository) EnableTOTP(ctx context.Context, userID int64, step int64, codes []model.RecoveryCode) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		err := boltUpdateUser(tx, userID, func(user *model.User) error {
+			if user.TOTPEnabled || user.TOTPSecret == "" {
+				return ErrTOTPAlreadyEnabled
+			}
+			user.TOTPEnabled, user.TOTPLastStep = true, step
+			user.Version++
+			return nil
+		}, ErrTOTPAlreadyEnabled)
+		if err != nil {
+			return err
+		}
+		recovery := tx.Bucket(bucketRecoveryCodes)
+		if err := boltDeletePrefix(recovery, boltKey(userID)); err != nil {
+			return err
+		}
+		for i := range codes {
+			id, err := boltID(recovery, codes[i].ID)
+			if err != nil {
+				return err
+			}
+			codes[i].ID = id
+			stored := codes[i]
+			stored.User = nil
+			if err := boltPut(recovery, boltKey(stored.UserID, id), stored); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+func (r *BoltTwoFactorRepository) DisableTOTP(ctx context.Context, userID int64) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		err := boltUpdateUser(tx, userID, func(user *model.User) error {
+			user.TOTPEnabled, user.TOTPSecret, user.TOTPLastStep = false, "", 0
+			user.Version++
+			return nil
+		}, nil)
+		if err != nil {
+			return err
+		}
+		return boltDeletePrefix(tx.Bucket(bucketRecoveryCodes), boltKey(userID))
+	})
+}
+func (r *BoltTwoFactorRepository) AdvanceTOTPStep(ctx context.Context, userID int64, step int64) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		return boltUpdateUser(tx, userID, func(user *model.User) error {
+			if user.TOTPLastStep >= step {
+				return ErrInvalidOTP
+			}
+			user.TOTPLastStep = step
+			return nil
+		}, ErrInvalidOTP)
+	})
+}
+func (r *BoltTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string, at time.Time) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		recovery := tx.Bucket(bucketRecoveryCodes)
+		var used *model.RecoveryCode
+		err := boltEach(recovery, boltKey(userID), func(_ []byte, code model.RecoveryCode) error {
+			if used == nil && code.CodeHash == codeHash && code.UsedAt == nil {
+				used = &code
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if used == nil {
+			return ErrInvalidOTP
+		}
+		used.UsedAt = &at
+		return boltPut(recovery, boltKey(userID, used.ID), *used)
+	})
+}
+
+// boltUpdateUser меняет не удаленного пользователя функцией change и сохраняет его с новым UpdatedAt,
+// как Updates в GORM. Если пользователя нет, возвращает notFound; ошибка change отменяет изменение.
+func boltUpdateUser(tx *bolt.Tx, id int64, change func(user *model.User) error, notFound error) error {
+	user, ok, err := boltActiveUser(tx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return notFound
+	}
+	if err := change(&user); err != nil {
+		return err
+	}
+	user.UpdatedAt = time.Now()
+	return boltPutUser(tx, user)
+}
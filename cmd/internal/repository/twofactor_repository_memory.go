@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+)
+
+// MemoryTwoFactorRepository - реализация TwoFactorRepository в памяти процесса.
+type MemoryTwoFactorRepository struct {
+	Store *MemoryStore
+}
+
+// NewMemoryTwoFactorRepository создает репозиторий 2FA поверх хранилища store.
+func NewMemoryTwoFactorRepository(store *MemoryStore) *MemoryTwoFactorRepository {
+	return &MemoryTwoFactorRepository{Store: store}
+}
+
+func (r *MemoryTwoFactorRepository) SetTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	return r.Store.write(ctx, func() error {
+		return r.Store.updateUser(userID, func(user *model.User) error {
+			if user.TOTPEnabled {
+				return ErrTOTPAlreadyEnabled
+			}
+			user.TOTPSecret, user.TOTPLastStep = secret, 0
+			return nil
+		}, ErrTOTPAlreadyEnabled)
+	})
+}
+func (r *MemoryTwoFactorRepository) EnableTOTP(ctx context.Context, userID int64, step int64, codes []model.RecoveryCode) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		err := s.updateUser(userID, func(user *model.User) error {
+			if user.TOTPEnabled || user.TOTPSecret == "" {
+				return ErrTOTPAlreadyEnabled
+			}
+			user.TOTPEnabled, user.TOTPLastStep = true, step
+			user.Version++
+			return nil
+		}, ErrTOTPAlreadyEnabled)
+		if err != nil {
+			return err
+		}
+		s.deleteRecoveryCodes(userID)
+		for i := range codes {
+			codes[i].ID = s.nextID("recovery_codes", codes[i].ID)
+			stored := codes[i]
+			stored.User = nil
+			s.recoveryCodes[stored.ID] = stored
+		}
+		return nil
+	})
+}
+func (r *MemoryTwoFactorRepository) DisableTOTP(ctx context.Context, userID int64) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		err := s.updateUser(userID, func(user *model.User) error {
+			user.TOTPEnabled, user.TOTPSecret, user.TOTPLastStep = false, "", 0
+			user.Version++
+			return nil
+		}, nil)
+		if err != nil {
+			return err
+		}
+		s.deleteRecoveryCodes(userID)
+		return nil
+	})
+}
+func (r *MemoryTwoFactorRepository) AdvanceTOTPStep(ctx context.Context, userID int64, step int64) error {
+	return r.Store.write(ctx, func() error {
+		return r.Store.updateUser(userID, func(user *model.User) error {
+			if user.TOTPLastStep >= step {
+				return ErrInvalidOTP
+			}
+			user.TOTPLastStep = step
+			return nil
+		}, ErrInvalidOTP)
+	})
+}
+func (r *MemoryTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string, at time.Time) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		for id, code := range s.recoveryCodes {
+			if code.UserID == userID && code.CodeHash == codeHash && code.UsedAt == nil {
+				code.UsedAt = &at
+				s.recoveryCodes[id] = code
+				return nil
+			}
+		}
+		return ErrInvalidOTP
+	})
+}
+
+// deleteRecoveryCodes удаляет все коды восстановления пользователя
+func (s *MemoryStore) deleteRecoveryCodes(userID int64) {
+	for id, code := range s.recoveryCodes {
+		if code.UserID == userID {
+			delete(s.recoveryCodes, id)
+		}
+	}
+}
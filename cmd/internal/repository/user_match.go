@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"cmp"
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+)
+
+// Выборки пользователей для хранилищ без SQL (MemoryStore, BoltStore): тот же результат, что у запросов
+// GormUserRepository, но вычисленный перебором. users - все пользователи хранилища, мягко удаленные
+// пропускаются здесь.
+
+// selectUsers фильтрует, сортирует и режет на страницы так же, как SQL-запрос ListUsers:
+// строки сравниваются побайтово, id - последний ключ сортировки.
+func selectUsers(users iter.Seq[model.User], query ListUsersQuery) ([]model.User, error) {
+	match, err := userFilterMatcher(query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	order, err := normalizeSort(query.Sort)
+	if err != nil {
+		return nil, err
+	}
+	if query.After != nil && len(query.After.Values) != len(order)-1 {
+		return nil, ErrInvalidCursor
+	}
+	selected := []model.User{}
+	for user := range users {
+		if user.DeletedAt.Valid || !match(user) {
+			continue
+		}
+		if query.After != nil && compareUserKeyset(user, order, query.After.Values, query.After.ID) <= 0 {
+			continue
+		}
+		selected = append(selected, cloneUser(user))
+	}
+	slices.SortFunc(selected, func(a, b model.User) int { return compareUsers(a, b, order) })
+	limit := -1
+	if query.Limit > 0 {
+		limit = query.Limit
+	}
+	return page(selected, limit, query.Offset), nil
+}
+
+// countUsers считает не удаленных пользователей, подходящих под фильтр
+func countUsers(users iter.Seq[model.User], filter UserFilter) (int64, error) {
+	match, err := userFilterMatcher(filter)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for user := range users {
+		if !user.DeletedAt.Valid && match(user) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// searchUsers ищет по тому же нормализованному документу, что и индексы БД. Оценка - доля триграмм
+// запроса, найденных в документе; запрос без триграмм ищется подстрокой с оценкой 1.
+func searchUsers(users iter.Seq[model.User], query string, limit int) ([]UserSearchHit, error) {
+	query = normalizeSearchText(query)
+	if query == "" {
+		return nil, ErrEmptySearchQuery
+	}
+	trigrams := searchTrigrams(query)
+	var hits []UserSearchHit
+	for user := range users {
+		if user.DeletedAt.Valid {
+			continue
+		}
+		document := searchDocument(&user)
+		var score float64
+		if len(trigrams) == 0 {
+			if strings.Contains(document, query) {
+				score = 1
+			}
+		} else {
+			for _, tri := range trigrams {
+				if strings.Contains(document, tri) {
+					score++
+				}
+			}
+			score /= float64(len(trigrams))
+		}
+		if score > 0 {
+			hits = append(hits, UserSearchHit{User: cloneUser(user), Score: score})
+		}
+	}
+	slices.SortFunc(hits, func(a, b UserSearchHit) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.ID, b.ID))
+	})
+	return page(hits, limit, 0), nil
+}
+
+// userFilterMatcher проверяет фильтр и возвращает условие на пользователя с той же семантикой,
+// что и applyUserFilter: сравнение без учета регистра, Query - подстрока имени, фамилии или email.
+func userFilterMatcher(filter UserFilter) (func(model.User) bool, error) {
+	var domain string
+	if filter.EmailDomain != "" {
+		var err error
+		if domain, err = filterEmailDomain(filter.EmailDomain); err != nil {
+			return nil, err
+		}
+		domain = "@" + strings.ToLower(domain)
+	}
+	query := strings.ToLower(filter.Query)
+	return func(user model.User) bool {
+		name, surname, email := strings.ToLower(user.Name), strings.ToLower(user.Surname), strings.ToLower(user.Email)
+		switch {
+		case filter.Name != "" && name != strings.ToLower(filter.Name),
+			filter.Surname != "" && surname != strings.ToLower(filter.Surname),
+			domain != "" && !strings.HasSuffix(email, domain),
+			query != "" && !strings.Contains(name, query) && !strings.Contains(surname, query) && !strings.Contains(email, query):
+			return false
+		}
+		return true
+	}, nil
+}
+
+// compareUsers сравнивает пользователей в порядке order. Строки сравниваются побайтово,
+// как при сортировке ListUsers в БД.
+func compareUsers(a, b model.User, order []SortField) int {
+	for _, field := range order {
+		c := cmp.Compare(a.ID, b.ID)
+		if field.Field != "id" {
+			c = strings.Compare(UserSortValue(a, field.Field), UserSortValue(b, field.Field))
+		}
+		if field.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareUserKeyset сравнивает пользователя с ключом курсора так же, как compareUsers -
+// с другим пользователем: values соответствуют полям order, кроме последнего id.
+func compareUserKeyset(user model.User, order []SortField, values []string, id int64) int {
+	for i, field := range order {
+		c := cmp.Compare(user.ID, id)
+		if i < len(order)-1 {
+			c = strings.Compare(UserSortValue(user, field.Field), values[i])
+		}
+		if field.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
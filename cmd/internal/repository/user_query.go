@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"gorm.io/gorm"
+)
+
+// ListUsersQuery описывает параметры выборки страницы пользователей.
+// Порядок записей задается Sort, id всегда добавляется последним ключом сортировки,
+// поэтому порядок детерминирован и на нем строится keyset-курсор After.
+type ListUsersQuery struct {
+	Filter UserFilter
+	Sort   []SortField
+	Limit  int
+	Offset int
+	After  *Keyset
+}
+
+// UserFilter - фильтры списка пользователей. Пустые поля не участвуют в выборке.
+// Name, Surname и EmailDomain сравниваются без учета регистра на полное совпадение,
+// Query ищется подстрокой сразу в имени, фамилии и email.
+type UserFilter struct {
+	Name        string
+	Surname     string
+	EmailDomain string
+	Query       string
+}
+
+// SortField - одно поле сортировки. Field - публичное имя поля из SortableUserFields.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Keyset - значения ключей сортировки последней записи предыдущей страницы.
+// Values соответствуют полям Sort (кроме id) в том же порядке.
+type Keyset struct {
+	Values []string
+	ID     int64
+}
+
+// SortableUserFields - белый список полей, по которым разрешена сортировка,
+// с соответствующими им колонками таблицы users. Имена колонок в SQL попадают
+// только отсюда, пользовательский ввод в запрос напрямую не подставляется.
+var SortableUserFields = map[string]string{
+	"id":      "id",
+	"name":    "name",
+	"surname": "surname",
+	"email":   "email",
+}
+
+// UserSortValue возвращает значение поля сортировки пользователя - нужно для построения курсора.
+func UserSortValue(user model.User, field string) string {
+	switch field {
+	case "name":
+		return user.Name
+	case "surname":
+		return user.Surname
+	case "email":
+		return user.Email
+	default:
+		return ""
+	}
+}
+
+// normalizeSort проверяет поля сортировки по белому списку и гарантирует, что id
+// присутствует в конце списка как уникальный ключ.
+func normalizeSort(sort []SortField) ([]SortField, error) {
+	order := make([]SortField, 0, len(sort)+1)
+	seen := make(map[string]bool, len(sort))
+	for _, field := range sort {
+		if _, ok := SortableUserFields[field.Field]; !ok || seen[field.Field] {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSort, field.Field)
+		}
+		seen[field.Field] = true
+		order = append(order, field)
+		if field.Field == "id" {
+			//после уникального id остальные поля на порядок не влияют
+			return order, nil
+		}
+	}
+	return append(order, SortField{Field: "id"}), nil
+}
+
+// sortColumn возвращает SQL-выражение колонки. В Postgres строки сравниваются
+// с учетом локали, поэтому используем побайтовую "C"-сортировку - как BINARY в SQLite.
+func sortColumn(db *gorm.DB, field string) string {
+	column := SortableUserFields[field]
+	if field != "id" && db.Dialector.Name() == "postgres" {
+		return column + ` COLLATE "C"`
+	}
+	return column
+}
+
+func orderClause(db *gorm.DB, field SortField) string {
+	if field.Desc {
+		return sortColumn(db, field.Field) + " DESC"
+	}
+	return sortColumn(db, field.Field) + " ASC"
+}
+
+// applyKeyset добавляет условие "строго после записи key" для порядка order:
+// (a > x) OR (a = x AND b > y) OR (a = x AND b = y AND id > z)
+func applyKeyset(db *gorm.DB, order []SortField, key Keyset) (*gorm.DB, error) {
+	if len(key.Values) != len(order)-1 {
+		return nil, ErrInvalidCursor
+	}
+	values := make([]any, 0, len(order))
+	for _, v := range key.Values {
+		values = append(values, v)
+	}
+	values = append(values, key.ID)
+
+	var disjuncts []string
+	var args []any
+	for i, field := range order {
+		var conj []string
+		for j := 0; j < i; j++ {
+			conj = append(conj, sortColumn(db, order[j].Field)+" = ?")
+			args = append(args, values[j])
+		}
+		op := " > ?"
+		if field.Desc {
+			op = " < ?"
+		}
+		conj = append(conj, sortColumn(db, field.Field)+op)
+		args = append(args, values[i])
+		disjuncts = append(disjuncts, "("+strings.Join(conj, " AND ")+")")
+	}
+	return db.Where("("+strings.Join(disjuncts, " OR ")+")", args...), nil
+}
+
+// applyUserFilter добавляет условия фильтрации. Сравнение идет через LOWER() с обеих сторон,
+// так как LIKE в Postgres чувствителен к регистру, а в SQLite - нет. Встроенная LOWER() SQLite
+// меняет только ASCII, поэтому config подключает SQLite с lower() по правилам Unicode.
+func applyUserFilter(db *gorm.DB, filter UserFilter) (*gorm.DB, error) {
+	if filter.Name != "" {
+		db = db.Where("LOWER(name) = LOWER(?)", filter.Name)
+	}
+	if filter.Surname != "" {
+		db = db.Where("LOWER(surname) = LOWER(?)", filter.Surname)
+	}
+	if filter.EmailDomain != "" {
+		domain, err := filterEmailDomain(filter.EmailDomain)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(`LOWER(email) LIKE LOWER(?) ESCAPE '\'`, "%@"+escapeLike(domain))
+	}
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		db = db.Where(`(LOWER(name) LIKE LOWER(?) ESCAPE '\' OR LOWER(surname) LIKE LOWER(?) ESCAPE '\' OR LOWER(email) LIKE LOWER(?) ESCAPE '\')`,
+			pattern, pattern, pattern)
+	}
+	return db, nil
+}
+
+// filterEmailDomain проверяет домен из фильтра и отбрасывает необязательный "@" в начале.
+func filterEmailDomain(domain string) (string, error) {
+	domain = strings.TrimPrefix(domain, "@")
+	if domain == "" || strings.ContainsAny(domain, "@ ") {
+		return "", fmt.Errorf("%w: email_domain", ErrInvalidFilter)
+	}
+	return domain, nil
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE, чтобы они искались буквально.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
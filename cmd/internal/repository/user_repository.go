@@ -4,65 +4,324 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/UnendingLoop/users-api/cmd/internal/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository interface {
 	CreateUser(user *model.User, ctx context.Context) error
 	GetUserByID(id int64, ctx context.Context) (*model.User, error)
-	ListUsers(ctx context.Context) ([]model.User, error)
-	DeleteUser(id int64, ctx context.Context) (int64, error)
+	GetUserByEmail(email string, ctx context.Context) (*model.User, error)
+	ListUsers(query ListUsersQuery, ctx context.Context) ([]model.User, error)
+	CountUsers(filter UserFilter, ctx context.Context) (int64, error)
+	SearchUsers(query string, limit int, ctx context.Context) ([]UserSearchHit, error)
+	DeleteUser(id int64, version int64, ctx context.Context) (int64, error)
+	RestoreUser(id int64, ctx context.Context) error
+	PurgeDeletedUsers(before time.Time, ctx context.Context) (int64, error)
 	UpdateUser(user *model.User, ctx context.Context) error
 
 	CheckIfExistsByID(id int64, ctx context.Context) error
-	CheckIfExistsByEmail(email string, ctx context.Context) error
 }
 
 type GormUserRepository struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	search userSearcher
 }
 
 var ErrUserNotFound = errors.New("user not found")
 var ErrUserExists = errors.New("user already exists")
+var ErrUserNotDeleted = errors.New("user is not deleted")
+var ErrVersionMismatch = errors.New("user has been modified since the given version")
 
 var ErrEmailExists = errors.New("email already exists")
-var ErrEmailNotFound = errors.New("email not found")
+var ErrEmailAlreadyVerified = errors.New("email is already verified")
+
+var ErrInvalidField = errors.New("invalid field value")
+
+// FieldError - ошибка валидации конкретного поля запроса, отдается клиенту в теле 400.
+// Err - причина из ошибок этого пакета (например, ErrWeakPassword), по умолчанию ErrInvalidField.
+// Ошибки нескольких полей объединяются через errors.Join.
+type FieldError struct {
+	Field   string
+	Message string
+	Err     error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+func (e *FieldError) Unwrap() error {
+	if e.Err != nil {
+		return e.Err
+	}
+	return ErrInvalidField
+}
 
 var ErrEmptyFields = errors.New("all fields are empty")
 var ErrEmptySomeFields = errors.New("some fields are empty")
 
 var ErrUserEqualsFriend = errors.New("user cannot be friend to himself")
+var ErrFriendshipExists = errors.New("friendship or friend request already exists")
+var ErrFriendRequestNotFound = errors.New("pending friend request not found")
+var ErrFriendshipNotFound = errors.New("friendship not found")
+var ErrPathNotFound = errors.New("no friendship path within depth limit")
+var ErrPathSearchLimit = errors.New("friendship path search exceeded visit budget")
+var ErrInvalidDepth = errors.New("invalid max depth")
+
+var ErrUserBlocked = errors.New("user is blocked")
+var ErrBlockExists = errors.New("user is already blocked")
+var ErrBlockNotFound = errors.New("block not found")
+var ErrSelfBlock = errors.New("user cannot block himself")
+
+var ErrInvalidCredentials = errors.New("invalid email or password")
+var ErrWeakPassword = errors.New("password must be at least 8 characters long")
+var ErrInvalidToken = errors.New("invalid or expired token")
+var ErrOTPRequired = errors.New("two-factor code required")
+var ErrInvalidOTP = errors.New("invalid two-factor code")
+var ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+var ErrTOTPNotEnrolled = errors.New("two-factor authentication is not set up")
+var ErrInvalidRole = errors.New("invalid user role")
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+var ErrInvalidAPIKey = errors.New("invalid, revoked or expired api key")
+var ErrInvalidScope = errors.New("invalid api key scope")
+var ErrInvalidExpiry = errors.New("api key expiry must be in the future")
+
+var ErrInvalidPagination = errors.New("invalid pagination parameters")
+var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrInvalidSort = errors.New("invalid sort parameter")
+var ErrInvalidFilter = errors.New("invalid filter parameter")
+
+var ErrInvalidPatch = errors.New("invalid patch document")
+var ErrPatchTestFailed = errors.New("patch test operation failed")
+var ErrPatchNotApplicable = errors.New("patch cannot be applied to the user")
 
 func NewGormUserRepository(db *gorm.DB) *GormUserRepository {
-	return &GormUserRepository{DB: db}
+	return &GormUserRepository{DB: db, search: newUserSearcher(db)}
 }
 
+// CreateUser сохраняет нового пользователя. Занятый email (в том числе мягко удаленным пользователем
+// или в другом регистре) отсекает уникальный индекс, ошибка - ErrEmailExists. Id назначает база,
+// переданный id не учитывается. Связи Friends и FriendOf не сохраняются: дружба появляется только через заявку.
 func (r *GormUserRepository) CreateUser(user *model.User, ctx context.Context) error {
-	return r.DB.WithContext(ctx).Create(&user).Error
+	user.ID = 0
+	user.EmailLower = emailKey(user.Email)
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(user).Error; err != nil {
+			return translateEmailConstraint(tx, err)
+		}
+		return r.search.index(tx, user)
+	})
 }
 func (r *GormUserRepository) GetUserByID(id int64, ctx context.Context) (*model.User, error) {
 	var user model.User
 	err := r.DB.WithContext(ctx).First(&user, id).Error
 	return &user, err
 }
-func (r *GormUserRepository) ListUsers(ctx context.Context) ([]model.User, error) {
+func (r *GormUserRepository) GetUserByEmail(email string, ctx context.Context) (*model.User, error) {
+	var user model.User
+	err := r.DB.WithContext(ctx).Where("email_lower = ?", emailKey(email)).First(&user).Error
+	return &user, err
+}
+func (r *GormUserRepository) ListUsers(query ListUsersQuery, ctx context.Context) ([]model.User, error) {
 	var users []model.User
-	err := r.DB.WithContext(ctx).Find(&users).Error
+	db, err := applyUserFilter(r.DB.WithContext(ctx).Model(&model.User{}), query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	order, err := normalizeSort(query.Sort)
+	if err != nil {
+		return nil, err
+	}
+	if query.After != nil {
+		if db, err = applyKeyset(db, order, *query.After); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range order {
+		db = db.Order(orderClause(db, field))
+	}
+	if query.Offset > 0 {
+		db = db.Offset(query.Offset)
+	}
+	if query.Limit > 0 {
+		db = db.Limit(query.Limit)
+	}
+	err = db.Find(&users).Error
 	return users, err
 }
-func (r *GormUserRepository) DeleteUser(id int64, ctx context.Context) (int64, error) {
-	res := r.DB.WithContext(ctx).Delete(&model.User{}, id)
-	return res.RowsAffected, res.Error
+func (r *GormUserRepository) CountUsers(filter UserFilter, ctx context.Context) (int64, error) {
+	var count int64
+	db, err := applyUserFilter(r.DB.WithContext(ctx).Model(&model.User{}), filter)
+	if err != nil {
+		return 0, err
+	}
+	err = db.Count(&count).Error
+	return count, err
+}
+func (r *GormUserRepository) SearchUsers(query string, limit int, ctx context.Context) ([]UserSearchHit, error) {
+	//от запроса из одной пунктуации после нормализации ничего не остается, а пустой шаблон совпал бы со всеми
+	query = normalizeSearchText(query)
+	if query == "" {
+		return nil, ErrEmptySearchQuery
+	}
+	scores, err := r.search.search(ctx, r.DB, query, limit)
+	if err != nil || len(scores) == 0 {
+		return nil, err
+	}
+	ids := make([]int64, len(scores))
+	for i, s := range scores {
+		ids[i] = s.UserID
+	}
+	var users []model.User
+	if err := r.DB.WithContext(ctx).Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]model.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	//сохраняем порядок по релевантности из индекса
+	hits := make([]UserSearchHit, 0, len(scores))
+	for _, s := range scores {
+		if u, ok := byID[s.UserID]; ok {
+			hits = append(hits, UserSearchHit{User: u, Score: s.Score})
+		}
+	}
+	return hits, nil
 }
+// DeleteUser мягко удаляет пользователя: связи и запись в поисковом индексе сохраняются до очистки.
+// Ненулевой version удаляет запись, только если в базе все еще эта версия, иначе - ErrVersionMismatch.
+func (r *GormUserRepository) DeleteUser(id int64, version int64, ctx context.Context) (int64, error) {
+	db := r.DB.WithContext(ctx)
+	if version != 0 {
+		db = db.Where("version = ?", version)
+	}
+	res := db.Delete(&model.User{}, id)
+	if res.Error != nil || res.RowsAffected > 0 || version == 0 {
+		return res.RowsAffected, res.Error
+	}
+	return 0, versionConflict(r.DB.WithContext(ctx), id)
+}
+
+// RestoreUser возвращает мягко удаленного пользователя вместе со всеми его связями.
+func (r *GormUserRepository) RestoreUser(id int64, ctx context.Context) error {
+	res := r.DB.WithContext(ctx).Unscoped().Model(&model.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+	var count int64
+	if err := r.DB.WithContext(ctx).Model(&model.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrUserNotDeleted
+	}
+	return ErrUserNotFound
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных раньше before,
+// вместе с их дружбами, блокировками, токенами, кодами восстановления, выпущенными ими API-ключами
+// и записями поискового индекса.
+func (r *GormUserRepository) PurgeDeletedUsers(before time.Time, ctx context.Context) (int64, error) {
+	var purged int64
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []int64
+		if err := tx.Unscoped().Model(&model.User{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := tx.Where("requester IN ? OR accepter IN ?", ids, ids).Delete(&model.Friendship{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("blocker IN ? OR blocked IN ?", ids, ids).Delete(&model.Block{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id IN ?", ids).Delete(&model.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id IN ?", ids).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id IN ?", ids).Delete(&model.EmailToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("created_by IN ?", ids).Delete(&model.APIKey{}).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := r.search.remove(tx, id); err != nil {
+				return err
+			}
+		}
+		res := tx.Unscoped().Delete(&model.User{}, ids)
+		purged = res.RowsAffected
+		return res.Error
+	})
+	return purged, err
+}
+
+// UpdateUser сохраняет профиль пользователя, только если в базе все еще версия user.Version,
+// и увеличивает ее. Если запись за это время изменили, ошибка - ErrVersionMismatch.
+// При смене email в той же транзакции гасятся токены из писем, выданные на прежний адрес.
+// Остальные поля (пароль, 2FA) меняются своими методами и здесь не перезаписываются.
 func (r *GormUserRepository) UpdateUser(user *model.User, ctx context.Context) error {
-	return r.DB.WithContext(ctx).Save(&user).Error
+	expected := user.Version
+	user.Version++
+	user.EmailLower = emailKey(user.Email)
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(user).Where("version = ?", expected).
+			Select("name", "surname", "email", "email_lower", "email_verified_at", "version", "updated_at").
+			Updates(user)
+		if res.Error != nil {
+			return translateEmailConstraint(tx, res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return versionConflict(tx, user.ID)
+		}
+		if err := revokeEmailTokens(tx, user.ID, user.Email, time.Now()); err != nil {
+			return err
+		}
+		return r.search.index(tx, user)
+	})
+	if err != nil {
+		user.Version = expected
+	}
+	return err
+}
+
+// nextVersion увеличивает версию пользователя в запросах, которые меняют видимые в API поля
+var nextVersion = gorm.Expr("version + 1")
+
+// versionConflict объясняет, почему условное изменение не затронуло ни одной строки:
+// пользователь удален (ErrUserNotFound) или его версия уже другая (ErrVersionMismatch).
+func versionConflict(db *gorm.DB, id int64) error {
+	var count int64
+	if err := db.Model(&model.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+	return ErrVersionMismatch
 }
 
 func (r *GormUserRepository) CheckIfExistsByID(id int64, ctx context.Context) error {
 	if id < 0 {
-		return fmt.Errorf("invalid ID format")
+		return fmt.Errorf("invalid ID format: %w", ErrInvalidField)
 	}
 	var count int64
 	err := r.DB.WithContext(ctx).Model(&model.User{}).Where("id = ?", id).Count(&count).Error
@@ -75,15 +334,3 @@ func (r *GormUserRepository) CheckIfExistsByID(id int64, ctx context.Context) er
 		return err
 	}
 }
-func (r *GormUserRepository) CheckIfExistsByEmail(email string, ctx context.Context) error {
-	var count int64
-	err := r.DB.WithContext(ctx).Model(&model.User{}).Where("email = ?", email).Count(&count).Error
-	switch {
-	case count == 0 && err == nil:
-		return ErrEmailNotFound
-	case count != 0 && err == nil:
-		return ErrEmailExists
-	default:
-		return err
-	}
-}
@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	bolt "go.etcd.io/bbolt"
+	"gorm.io/gorm"
+)
+
+// BoltUserRepository - реализация UserRepository во встроенной базе bbolt. Ведет себя так же,
+// как GormUserRepository, включая ошибки: ненайденный пользователь - gorm.ErrRecordNotFound
+// там, где его возвращает GORM.
+type BoltUserRepository struct {
+	Store *BoltStore
+}
+
+// NewBoltUserRepository создает репозиторий пользователей поверх хранилища store.
+func NewBoltUserRepository(store *BoltStore) *BoltUserRepository {
+	return &BoltUserRepository{Store: store}
+}
+
+// CreateUser сохраняет нового пользователя и назначает ему id, переданный id не учитывается.
+// Значения по умолчанию (версия 1, роль user) заполняются так же, как их заполняет база.
+// Связи Friends и FriendOf, как и в GormUserRepository, не сохраняются.
+func (r *BoltUserRepository) CreateUser(user *model.User, ctx context.Context) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		emails := tx.Bucket(bucketUserEmails)
+		if emails.Get([]byte(emailKey(user.Email))) != nil {
+			return ErrEmailExists
+		}
+		id, err := boltID(tx.Bucket(bucketUsers), 0)
+		if err != nil {
+			return err
+		}
+		stored := *user
+		stored.ID = id
+		if stored.Version == 0 {
+			stored.Version = 1
+		}
+		if stored.Role == "" {
+			stored.Role = model.RoleUser
+		}
+		if stored.UpdatedAt.IsZero() {
+			stored.UpdatedAt = time.Now()
+		}
+		if err := boltPutUser(tx, stored); err != nil {
+			return err
+		}
+		if err := emails.Put([]byte(emailKey(stored.Email)), boltKey(id)); err != nil {
+			return err
+		}
+		user.ID, user.Version, user.Role, user.UpdatedAt = stored.ID, stored.Version, stored.Role, stored.UpdatedAt
+		return nil
+	})
+}
+func (r *BoltUserRepository) GetUserByID(id int64, ctx context.Context) (*model.User, error) {
+	var user model.User
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		found, ok, err := boltActiveUser(tx, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		user = found
+		return nil
+	})
+	return &user, err
+}
+func (r *BoltUserRepository) GetUserByEmail(email string, ctx context.Context) (*model.User, error) {
+	var user model.User
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		id := tx.Bucket(bucketUserEmails).Get([]byte(emailKey(email)))
+		if id == nil {
+			return gorm.ErrRecordNotFound
+		}
+		found, ok, err := boltActiveUser(tx, boltKeyID(id, 0))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		user = found
+		return nil
+	})
+	return &user, err
+}
+func (r *BoltUserRepository) ListUsers(query ListUsersQuery, ctx context.Context) ([]model.User, error) {
+	var users []model.User
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		all, err := boltUsers(tx)
+		if err != nil {
+			return err
+		}
+		users, err = selectUsers(slices.Values(all), query)
+		return err
+	})
+	return users, err
+}
+func (r *BoltUserRepository) CountUsers(filter UserFilter, ctx context.Context) (int64, error) {
+	var count int64
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		all, err := boltUsers(tx)
+		if err != nil {
+			return err
+		}
+		count, err = countUsers(slices.Values(all), filter)
+		return err
+	})
+	return count, err
+}
+func (r *BoltUserRepository) SearchUsers(query string, limit int, ctx context.Context) ([]UserSearchHit, error) {
+	var hits []UserSearchHit
+	err := r.Store.view(ctx, func(tx *bolt.Tx) error {
+		all, err := boltUsers(tx)
+		if err != nil {
+			return err
+		}
+		hits, err = searchUsers(slices.Values(all), query, limit)
+		return err
+	})
+	return hits, err
+}
+
+// DeleteUser мягко удаляет пользователя. Ненулевой version удаляет его, только если это все еще
+// текущая версия, иначе - ErrVersionMismatch.
+func (r *BoltUserRepository) DeleteUser(id int64, version int64, ctx context.Context) (int64, error) {
+	var deleted int64
+	err := r.Store.update(ctx, func(tx *bolt.Tx) error {
+		user, ok, err := boltActiveUser(tx, id)
+		switch {
+		case err != nil:
+			return err
+		case !ok && version != 0:
+			return ErrUserNotFound
+		case !ok:
+			return nil
+		case version != 0 && user.Version != version:
+			return ErrVersionMismatch
+		}
+		user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		deleted = 1
+		return boltPutUser(tx, user)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// RestoreUser возвращает мягко удаленного пользователя вместе со всеми его связями.
+func (r *BoltUserRepository) RestoreUser(id int64, ctx context.Context) error {
+	return r.Store.update(ctx, func(tx *bolt.Tx) error {
+		user, ok, err := boltUser(tx, id)
+		switch {
+		case err != nil:
+			return err
+		case !ok:
+			return ErrUserNotFound
+		case !user.DeletedAt.Valid:
+			return ErrUserNotDeleted
+		}
+		user.DeletedAt = gorm.DeletedAt{}
+		user.UpdatedAt = time.Now()
+		return boltPutUser(tx, user)
+	})
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных раньше before, вместе с их
+// дружбами, блокировками, токенами, кодами восстановления и выпущенными ими API-ключами - одной транзакцией.
+func (r *BoltUserRepository) PurgeDeletedUsers(before time.Time, ctx context.Context) (int64, error) {
+	var purged int64
+	err := r.Store.update(ctx, func(tx *bolt.Tx) error {
+		users, err := boltUsers(tx)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if !user.DeletedAt.Valid || !user.DeletedAt.Time.Before(before) {
+				continue
+			}
+			if err := boltPurgeUser(tx, user); err != nil {
+				return fmt.Errorf("Failed to purge user %d: %w", user.ID, err)
+			}
+			purged++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// UpdateUser сохраняет профиль пользователя, только если в хранилище все еще версия user.Version,
+// и увеличивает ее. Пароль и настройки 2FA не перезаписываются, токены из писем на прежний
+// email гасятся.
+func (r *BoltUserRepository) UpdateUser(user *model.User, ctx context.Context) error {
+	var updatedAt time.Time
+	err := r.Store.update(ctx, func(tx *bolt.Tx) error {
+		stored, ok, err := boltActiveUser(tx, user.ID)
+		switch {
+		case err != nil:
+			return err
+		case !ok:
+			return ErrUserNotFound
+		case stored.Version != user.Version:
+			return ErrVersionMismatch
+		}
+		emails := tx.Bucket(bucketUserEmails)
+		if owner := emails.Get([]byte(emailKey(user.Email))); owner != nil && !slices.Equal(owner, boltKey(user.ID)) {
+			return ErrEmailExists
+		}
+		if err := emails.Delete([]byte(emailKey(stored.Email))); err != nil {
+			return err
+		}
+		if err := emails.Put([]byte(emailKey(user.Email)), boltKey(user.ID)); err != nil {
+			return err
+		}
+		updatedAt = time.Now()
+		stored.Name, stored.Surname, stored.Email = user.Name, user.Surname, user.Email
+		stored.EmailVerifiedAt = user.EmailVerifiedAt
+		stored.Version, stored.UpdatedAt = user.Version+1, updatedAt
+		if err := boltRevokeEmailTokens(tx, user.ID, user.Email, updatedAt); err != nil {
+			return err
+		}
+		return boltPutUser(tx, stored)
+	})
+	if err != nil {
+		return err
+	}
+	user.Version++
+	user.UpdatedAt = updatedAt
+	return nil
+}
+
+func (r *BoltUserRepository) CheckIfExistsByID(id int64, ctx context.Context) error {
+	if id < 0 {
+		return fmt.Errorf("invalid ID format: %w", ErrInvalidField)
+	}
+	return r.Store.view(ctx, func(tx *bolt.Tx) error {
+		_, ok, err := boltActiveUser(tx, id)
+		switch {
+		case err != nil:
+			return err
+		case ok:
+			return ErrUserExists
+		}
+		return ErrUserNotFound
+	})
+}
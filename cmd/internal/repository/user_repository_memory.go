@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"gorm.io/gorm"
+)
+
+// MemoryUserRepository - реализация UserRepository в памяти процесса для тестов и демо.
+// Ведет себя так же, как GormUserRepository, включая ошибки: ненайденный пользователь -
+// gorm.ErrRecordNotFound там, где его возвращает GORM.
+type MemoryUserRepository struct {
+	Store *MemoryStore
+}
+
+// NewMemoryUserRepository создает репозиторий пользователей поверх хранилища store.
+func NewMemoryUserRepository(store *MemoryStore) *MemoryUserRepository {
+	return &MemoryUserRepository{Store: store}
+}
+
+// CreateUser сохраняет нового пользователя и назначает ему id, переданный id не учитывается.
+// Значения по умолчанию (версия 1, роль user) заполняются так же, как их заполняет база.
+// Связи Friends и FriendOf, как и в GormUserRepository, не сохраняются.
+func (r *MemoryUserRepository) CreateUser(user *model.User, ctx context.Context) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		if _, taken := s.emails[emailKey(user.Email)]; taken {
+			return ErrEmailExists
+		}
+		s.lastID++
+		user.ID = s.lastID
+		if user.Version == 0 {
+			user.Version = 1
+		}
+		if user.Role == "" {
+			user.Role = model.RoleUser
+		}
+		if user.UpdatedAt.IsZero() {
+			user.UpdatedAt = time.Now()
+		}
+		s.users[user.ID] = cloneUser(*user)
+		s.emails[emailKey(user.Email)] = user.ID
+		return nil
+	})
+}
+func (r *MemoryUserRepository) GetUserByID(id int64, ctx context.Context) (*model.User, error) {
+	var user model.User
+	err := r.Store.read(ctx, func() error {
+		found, ok := r.Store.activeUser(id)
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		user = cloneUser(found)
+		return nil
+	})
+	return &user, err
+}
+func (r *MemoryUserRepository) GetUserByEmail(email string, ctx context.Context) (*model.User, error) {
+	var user model.User
+	err := r.Store.read(ctx, func() error {
+		found, ok := r.Store.activeUser(r.Store.emails[emailKey(email)])
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		user = cloneUser(found)
+		return nil
+	})
+	return &user, err
+}
+
+func (r *MemoryUserRepository) ListUsers(query ListUsersQuery, ctx context.Context) ([]model.User, error) {
+	var users []model.User
+	err := r.Store.read(ctx, func() (err error) {
+		users, err = selectUsers(maps.Values(r.Store.users), query)
+		return err
+	})
+	return users, err
+}
+func (r *MemoryUserRepository) CountUsers(filter UserFilter, ctx context.Context) (int64, error) {
+	var count int64
+	err := r.Store.read(ctx, func() (err error) {
+		count, err = countUsers(maps.Values(r.Store.users), filter)
+		return err
+	})
+	return count, err
+}
+func (r *MemoryUserRepository) SearchUsers(query string, limit int, ctx context.Context) ([]UserSearchHit, error) {
+	var hits []UserSearchHit
+	err := r.Store.read(ctx, func() error {
+		var err error
+		hits, err = searchUsers(maps.Values(r.Store.users), query, limit)
+		return err
+	})
+	return hits, err
+}
+
+// DeleteUser мягко удаляет пользователя. Ненулевой version удаляет его, только если это все еще
+// текущая версия, иначе - ErrVersionMismatch.
+func (r *MemoryUserRepository) DeleteUser(id int64, version int64, ctx context.Context) (int64, error) {
+	var deleted int64
+	s := r.Store
+	err := s.write(ctx, func() error {
+		user, ok := s.activeUser(id)
+		switch {
+		case !ok && version != 0:
+			return ErrUserNotFound
+		case !ok:
+			return nil
+		case version != 0 && user.Version != version:
+			return ErrVersionMismatch
+		}
+		user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		s.users[id] = user
+		deleted = 1
+		return nil
+	})
+	return deleted, err
+}
+
+// RestoreUser возвращает мягко удаленного пользователя вместе со всеми его связями.
+func (r *MemoryUserRepository) RestoreUser(id int64, ctx context.Context) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		user, ok := s.users[id]
+		switch {
+		case !ok:
+			return ErrUserNotFound
+		case !user.DeletedAt.Valid:
+			return ErrUserNotDeleted
+		}
+		user.DeletedAt = gorm.DeletedAt{}
+		user.UpdatedAt = time.Now()
+		s.users[id] = user
+		return nil
+	})
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных раньше before, вместе с их
+// дружбами, блокировками, токенами, кодами восстановления и выпущенными ими API-ключами.
+func (r *MemoryUserRepository) PurgeDeletedUsers(before time.Time, ctx context.Context) (int64, error) {
+	var purged int64
+	s := r.Store
+	err := s.write(ctx, func() error {
+		for id, user := range s.users {
+			if !user.DeletedAt.Valid || !user.DeletedAt.Time.Before(before) {
+				continue
+			}
+			for pair := range s.friendships {
+				if pair[0] == id || pair[1] == id {
+					delete(s.friendships, pair)
+				}
+			}
+			for key := range s.blocks {
+				if key[0] == id || key[1] == id {
+					delete(s.blocks, key)
+				}
+			}
+			s.deleteUserRecords(id)
+			delete(s.emails, emailKey(user.Email))
+			delete(s.users, id)
+			purged++
+		}
+		return nil
+	})
+	return purged, err
+}
+
+// UpdateUser сохраняет профиль пользователя, только если в хранилище все еще версия user.Version,
+// и увеличивает ее. Пароль и настройки 2FA не перезаписываются, токены из писем на прежний
+// email гасятся.
+func (r *MemoryUserRepository) UpdateUser(user *model.User, ctx context.Context) error {
+	s := r.Store
+	return s.write(ctx, func() error {
+		stored, ok := s.activeUser(user.ID)
+		switch {
+		case !ok:
+			return ErrUserNotFound
+		case stored.Version != user.Version:
+			return ErrVersionMismatch
+		}
+		if owner, taken := s.emails[emailKey(user.Email)]; taken && owner != user.ID {
+			return ErrEmailExists
+		}
+		user.Version++
+		user.UpdatedAt = time.Now()
+		delete(s.emails, emailKey(stored.Email))
+		s.emails[emailKey(user.Email)] = user.ID
+		stored.Name, stored.Surname, stored.Email = user.Name, user.Surname, user.Email
+		stored.EmailVerifiedAt = user.EmailVerifiedAt
+		stored.Version, stored.UpdatedAt = user.Version, user.UpdatedAt
+		s.users[user.ID] = cloneUser(stored)
+		s.revokeEmailTokens(user.ID, user.Email, user.UpdatedAt)
+		return nil
+	})
+}
+
+func (r *MemoryUserRepository) CheckIfExistsByID(id int64, ctx context.Context) error {
+	if id < 0 {
+		return fmt.Errorf("invalid ID format: %w", ErrInvalidField)
+	}
+	return r.Store.read(ctx, func() error {
+		if _, ok := r.Store.activeUser(id); ok {
+			return ErrUserExists
+		}
+		return ErrUserNotFound
+	})
+}
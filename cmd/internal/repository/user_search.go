@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"gorm.io/gorm"
+)
+
+var ErrSearchUnavailable = errors.New("full-text search is not available for this database")
+var ErrEmptySearchQuery = errors.New("search query is empty")
+
+// UserSearchHit - пользователь, найденный полнотекстовым поиском, с оценкой релевантности.
+type UserSearchHit struct {
+	model.User
+	Score float64 `json:"score"`
+}
+
+// userSearcher - поисковый индекс пользователей, своя реализация для каждого диалекта БД.
+// Индекс хранит нормализованный документ (имя, фамилия, email в латинице и нижнем регистре)
+// и обновляется в той же транзакции, что и сама запись пользователя. Запись удаляется из индекса
+// только при окончательном удалении пользователя.
+type userSearcher interface {
+	// backfill дозаполняет индекс, если в нем не все пользователи. Сами таблицы индекса
+	// создаются миграциями.
+	backfill(db *gorm.DB) error
+	index(tx *gorm.DB, user *model.User) error
+	remove(tx *gorm.DB, id int64) error
+	search(ctx context.Context, db *gorm.DB, query string, limit int) ([]searchScore, error)
+}
+
+type searchScore struct {
+	UserID int64
+	Score  float64
+}
+
+func newUserSearcher(db *gorm.DB) userSearcher {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return &postgresUserSearcher{}
+	case "sqlite":
+		return &sqliteUserSearcher{}
+	default:
+		return unavailableSearcher{}
+	}
+}
+
+// BackfillUserSearchIndex наполняет поисковый индекс пользователями, которых в нем нет,
+// например созданными до появления поиска. Вызывается после применения миграций.
+func BackfillUserSearchIndex(db *gorm.DB) error {
+	return newUserSearcher(db).backfill(db)
+}
+
+// reindexAll перестраивает индекс по всем пользователям, если количество документов
+// в индексе не совпадает с количеством пользователей. Мягко удаленные тоже индексируются,
+// чтобы после восстановления снова находиться, из выдачи они отсекаются при поиске.
+func reindexAll(db *gorm.DB, s userSearcher, indexed int64) error {
+	var total int64
+	if err := db.Unscoped().Model(&model.User{}).Count(&total).Error; err != nil {
+		return err
+	}
+	if total == indexed {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var users []model.User
+		return tx.Unscoped().FindInBatches(&users, 500, func(batch *gorm.DB, _ int) error {
+			for i := range users {
+				if err := s.index(batch, &users[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	})
+}
+
+// searchDocument - текст, который индексируется для пользователя.
+func searchDocument(user *model.User) string {
+	return normalizeSearchText(user.Name + " " + user.Surname + " " + user.Email)
+}
+
+// normalizeSearchText приводит текст к нижнему регистру и транслитерирует кириллицу в латиницу,
+// чтобы "Иванов" и "Ivanov" давали одинаковый документ. Пунктуация заменяется пробелами.
+func normalizeSearchText(s string) string {
+	var b strings.Builder
+	space := true
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case cyrillicToLatin[r] != "" || r == 'ъ' || r == 'ь':
+			b.WriteString(cyrillicToLatin[r])
+			space = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			space = false
+		case !space:
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// searchTrigrams возвращает различные триграммы слов нормализованного запроса в порядке появления.
+// Слова короче 3 символов триграмм не дают.
+func searchTrigrams(query string) []string {
+	seen := make(map[string]bool)
+	var trigrams []string
+	for _, word := range strings.Fields(query) {
+		runes := []rune(word)
+		for i := 0; i+3 <= len(runes); i++ {
+			tri := string(runes[i : i+3])
+			if !seen[tri] {
+				seen[tri] = true
+				trigrams = append(trigrams, tri)
+			}
+		}
+	}
+	return trigrams
+}
+
+// cyrillicToLatin - упрощенная транслитерация (близкая к ICAO), покрывает русский и украинский алфавиты.
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ы': "y", 'э': "e", 'ю': "iu", 'я': "ia",
+	'є': "ie", 'і': "i", 'ї': "i", 'ґ': "g",
+}
+
+// unavailableSearcher используется для диалектов без поддержки поиска.
+type unavailableSearcher struct{}
+
+func (unavailableSearcher) backfill(*gorm.DB) error           { return nil }
+func (unavailableSearcher) index(*gorm.DB, *model.User) error { return nil }
+func (unavailableSearcher) remove(*gorm.DB, int64) error      { return nil }
+func (unavailableSearcher) search(context.Context, *gorm.DB, string, int) ([]searchScore, error) {
+	return nil, ErrSearchUnavailable
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"gorm.io/gorm"
+)
+
+// postgresUserSearcher - поиск на tsvector для совпадения слов и pg_trgm для опечаток.
+// Оценка - максимум из ts_rank и word_similarity.
+type postgresUserSearcher struct{}
+
+func (s *postgresUserSearcher) backfill(db *gorm.DB) error {
+	var indexed int64
+	if err := db.Table("user_search").Count(&indexed).Error; err != nil {
+		return err
+	}
+	return reindexAll(db, s, indexed)
+}
+
+func (s *postgresUserSearcher) index(tx *gorm.DB, user *model.User) error {
+	return tx.Exec(`INSERT INTO user_search (user_id, document) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET document = EXCLUDED.document`,
+		user.ID, searchDocument(user)).Error
+}
+
+func (s *postgresUserSearcher) remove(tx *gorm.DB, id int64) error {
+	return tx.Exec(`DELETE FROM user_search WHERE user_id = ?`, id).Error
+}
+
+func (s *postgresUserSearcher) search(ctx context.Context, db *gorm.DB, query string, limit int) ([]searchScore, error) {
+	var scores []searchScore
+	err := db.WithContext(ctx).Raw(`
+		SELECT user_id, GREATEST(ts_rank(tsv, plainto_tsquery('simple', @q)), word_similarity(@q, document)) AS score
+		FROM user_search
+		JOIN users ON users.id = user_search.user_id AND users.deleted_at IS NULL
+		WHERE tsv @@ plainto_tsquery('simple', @q) OR @q <% document
+		ORDER BY score DESC, user_id ASC
+		LIMIT @limit`,
+		sql.Named("q", query), sql.Named("limit", limit)).
+		Scan(&scores).Error
+	return scores, err
+}
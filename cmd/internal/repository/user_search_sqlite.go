@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"gorm.io/gorm"
+)
+
+// sqliteUserSearcher - поиск на виртуальной таблице FTS5 с trigram-токенайзером.
+// Запрос разбивается на триграммы, объединенные через OR, и ранжируется bm25:
+// чем больше общих триграмм, тем выше оценка, поэтому опечатки допустимы.
+// FTS5 в mattn/go-sqlite3 включается тегом сборки sqlite_fts5. Без него миграция создает обычную
+// таблицу индекса, и оценка - число триграмм запроса, найденных в документе подстрокой.
+type sqliteUserSearcher struct {
+	enabled atomic.Bool
+	fts5    atomic.Bool
+}
+
+// errFTS5Unavailable - таблица индекса создана как FTS5, а SQLite собран без FTS5. Писать в такую
+// базу нельзя: изменения пользователей не попали бы в индекс, и он молча устарел бы.
+var errFTS5Unavailable = fmt.Errorf("%w: user_search is an FTS5 table, but SQLite is built without FTS5 (build with -tags sqlite_fts5)",
+	ErrSearchUnavailable)
+
+// ready сообщает, есть ли в базе таблица индекса. Репозиторий создается до применения миграций
+// (при MIGRATE_ON_START и у DB_DRIVER=sqlite-memory - в том же процессе), поэтому наличие таблицы
+// проверяется при обращении, пока она не появится; пока ее нет, поиск и синхронизация отключены.
+// Таблица FTS5 в сборке без FTS5 - ошибка errFTS5Unavailable: на ней не запускается сервер
+// (BackfillUserSearchIndex) и откатывается любое изменение пользователей.
+func (s *sqliteUserSearcher) ready(db *gorm.DB) (bool, error) {
+	if s.enabled.Load() {
+		return true, nil
+	}
+	var schema string
+	err := db.Raw(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'user_search'`).Scan(&schema).Error
+	if err != nil || schema == "" {
+		return false, err
+	}
+	if strings.Contains(strings.ToLower(schema), "fts5") {
+		if db.Exec(`SELECT rowid FROM user_search LIMIT 0`).Error != nil {
+			return false, errFTS5Unavailable
+		}
+		s.fts5.Store(true)
+	}
+	s.enabled.Store(true)
+	return true, nil
+}
+
+func (s *sqliteUserSearcher) backfill(db *gorm.DB) error {
+	if ok, err := s.ready(db); !ok {
+		return err
+	}
+	var indexed int64
+	if err := db.Table("user_search").Count(&indexed).Error; err != nil {
+		return err
+	}
+	return reindexAll(db, s, indexed)
+}
+
+func (s *sqliteUserSearcher) index(tx *gorm.DB, user *model.User) error {
+	if ok, err := s.ready(tx); !ok {
+		return err
+	}
+	if err := s.remove(tx, user.ID); err != nil {
+		return err
+	}
+	return tx.Exec(`INSERT INTO user_search (rowid, document) VALUES (?, ?)`, user.ID, searchDocument(user)).Error
+}
+
+func (s *sqliteUserSearcher) remove(tx *gorm.DB, id int64) error {
+	if ok, err := s.ready(tx); !ok {
+		return err
+	}
+	return tx.Exec(`DELETE FROM user_search WHERE rowid = ?`, id).Error
+}
+
+func (s *sqliteUserSearcher) search(ctx context.Context, db *gorm.DB, query string, limit int) ([]searchScore, error) {
+	if ok, err := s.ready(db.WithContext(ctx)); !ok {
+		if err == nil {
+			err = ErrSearchUnavailable
+		}
+		return nil, err
+	}
+	var scores []searchScore
+	match := trigramMatch(query)
+	if match == "" {
+		//триграммы строятся только из слов длиной от 3 символов, короткие запросы ищем подстрокой
+		err := db.WithContext(ctx).Raw(`
+			SELECT user_search.rowid AS user_id, 1.0 AS score FROM user_search
+			JOIN users ON users.id = user_search.rowid AND users.deleted_at IS NULL
+			WHERE document LIKE ? ESCAPE '\'
+			ORDER BY user_search.rowid ASC LIMIT ?`, "%"+escapeLike(query)+"%", limit).
+			Scan(&scores).Error
+		return scores, err
+	}
+	if !s.fts5.Load() {
+		return s.searchSubstrings(ctx, db, searchTrigrams(query), limit)
+	}
+	err := db.WithContext(ctx).Raw(`
+		SELECT user_search.rowid AS user_id, -bm25(user_search) AS score FROM user_search
+		JOIN users ON users.id = user_search.rowid AND users.deleted_at IS NULL
+		WHERE user_search MATCH ?
+		ORDER BY score DESC, user_search.rowid ASC LIMIT ?`, match, limit).
+		Scan(&scores).Error
+	return scores, err
+}
+
+// searchSubstrings ищет без FTS5: оценка - сколько триграмм запроса встречается в документе
+func (s *sqliteUserSearcher) searchSubstrings(ctx context.Context, db *gorm.DB, trigrams []string, limit int) ([]searchScore, error) {
+	terms := make([]string, len(trigrams))
+	args := make([]any, 0, len(trigrams)+1)
+	for i, tri := range trigrams {
+		terms[i] = "(instr(document, ?) > 0)"
+		args = append(args, tri)
+	}
+	args = append(args, limit)
+	var scores []searchScore
+	err := db.WithContext(ctx).Raw(`
+		SELECT found.user_id, found.score FROM (
+			SELECT rowid AS user_id, CAST(`+strings.Join(terms, " + ")+` AS REAL) AS score FROM user_search
+		) AS found
+		JOIN users ON users.id = found.user_id AND users.deleted_at IS NULL
+		WHERE found.score > 0
+		ORDER BY found.score DESC, found.user_id ASC LIMIT ?`, args...).
+		Scan(&scores).Error
+	return scores, err
+}
+
+// trigramMatch строит выражение FTS5 вида "iva" OR "van" OR "ano" ... из нормализованного запроса.
+func trigramMatch(query string) string {
+	terms := searchTrigrams(query)
+	for i, tri := range terms {
+		terms[i] = `"` + strings.ReplaceAll(tri, `"`, `""`) + `"`
+	}
+	return strings.Join(terms, " OR ")
+}
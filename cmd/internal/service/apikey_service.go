@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"gorm.io/gorm"
+)
+
+const (
+	// apiKeyPrefix отличает API-ключи от других секретов, например при поиске утечек в коде
+	apiKeyPrefix = "uak_"
+	// apiKeyTouchInterval - как часто обновлять время последнего использования ключа,
+	// чтобы не писать в базу на каждый запрос
+	apiKeyTouchInterval = time.Minute
+)
+
+// APIKeyServe
+type APIKeyServe struct {
+	Repo  repository.APIKeyRepository
+	Users repository.UserRepository
+}
+
+// CreateAPIKeyRequest - данные для выпуска ключа. ExpiresAt необязателен: без него ключ бессрочный.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreatedAPIKey - выпущенный ключ. Key показывается только один раз, при создании.
+type CreatedAPIKey struct {
+	model.APIKey
+	Key string `json:"key"`
+}
+
+type APIKeyService interface {
+	CreateAPIKey(req CreateAPIKeyRequest, createdBy int64, ctx context.Context) (*CreatedAPIKey, error)
+	ListAPIKeys(ctx context.Context) ([]model.APIKey, error)
+	RevokeAPIKey(id int64, ctx context.Context) error
+	Authenticate(rawKey string, ctx context.Context) (*auth.APIKeyPrincipal, error)
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository, users repository.UserRepository) APIKeyService {
+	return &APIKeyServe{Repo: repo, Users: users}
+}
+
+func (KS *APIKeyServe) CreateAPIKey(req CreateAPIKeyRequest, createdBy int64, ctx context.Context) (*CreatedAPIKey, error) {
+	if err := requireFields(map[string]string{"name": req.Name, "scopes": strings.Join(req.Scopes, ",")}); err != nil {
+		return nil, fmt.Errorf("Failed to create api key: %w", err)
+	}
+	scopes, err := auth.ParseScopes(strings.Join(req.Scopes, ","))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create api key: %w",
+			&repository.FieldError{Field: "scopes", Message: err.Error(), Err: repository.ErrInvalidScope})
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("Failed to create api key: %w",
+			&repository.FieldError{Field: "expires_at", Message: "must be in the future", Err: repository.ErrInvalidExpiry})
+	}
+
+	prefix, secret := randomHex(6), randomToken()
+	key := model.APIKey{
+		Name:      req.Name,
+		Prefix:    apiKeyPrefix + prefix,
+		KeyHash:   hashToken(secret),
+		Scopes:    auth.JoinScopes(scopes),
+		CreatedBy: createdBy,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := KS.Repo.CreateAPIKey(ctx, &key); err != nil {
+		return nil, fmt.Errorf("Failed to create api key: %w", err)
+	}
+	return &CreatedAPIKey{APIKey: key, Key: key.Prefix + "." + secret}, nil
+}
+
+func (KS *APIKeyServe) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	keys, err := KS.Repo.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (KS *APIKeyServe) RevokeAPIKey(id int64, ctx context.Context) error {
+	if err := KS.Repo.RevokeAPIKey(ctx, id); err != nil {
+		return fmt.Errorf("Failed to revoke api key: %w", err)
+	}
+	return nil
+}
+
+// Authenticate проверяет ключ вида "uak_<prefix>.<secret>" и отмечает время его использования.
+// Ключи удаленного администратора, выпустившего их, не принимаются, пока он не будет восстановлен.
+func (KS *APIKeyServe) Authenticate(rawKey string, ctx context.Context) (*auth.APIKeyPrincipal, error) {
+	prefix, secret, ok := strings.Cut(rawKey, ".")
+	if !ok || !strings.HasPrefix(prefix, apiKeyPrefix) || secret == "" {
+		return nil, repository.ErrInvalidAPIKey
+	}
+	key, err := KS.Repo.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("Failed to authenticate api key: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(hashToken(secret))) != 1 {
+		return nil, repository.ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, repository.ErrInvalidAPIKey
+	}
+	switch err := KS.Users.CheckIfExistsByID(key.CreatedBy, ctx); {
+	case errors.Is(err, repository.ErrUserNotFound):
+		return nil, repository.ErrInvalidAPIKey
+	case !errors.Is(err, repository.ErrUserExists):
+		return nil, fmt.Errorf("Failed to authenticate api key: %w", err)
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := KS.Repo.TouchAPIKey(ctx, key.ID, now); err != nil {
+			return nil, fmt.Errorf("Failed to authenticate api key: %w", err)
+		}
+	}
+
+	//области проверены при выпуске ключа, поэтому ошибка здесь означает порчу данных
+	scopes, err := auth.ParseScopes(key.Scopes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to authenticate api key: %w", err)
+	}
+	return &auth.APIKeyPrincipal{KeyID: key.ID, Prefix: key.Prefix, Scopes: scopes}, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+)
+
+func TestAuthenticateRejectsKeysOfDeletedOwner(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	users := repository.NewMemoryUserRepository(store)
+	admin := &model.User{Name: "Ann", Surname: "Lee", Email: "ann@example.com", Role: model.RoleAdmin}
+	if err := users.CreateUser(admin, ctx); err != nil {
+		t.Fatal(err)
+	}
+	keys := NewAPIKeyService(repository.NewMemoryAPIKeyRepository(store), users)
+	created, err := keys.CreateAPIKey(CreateAPIKeyRequest{Name: "sync", Scopes: []string{string(auth.ScopeUsersRead)}}, admin.ID, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Authenticate(created.Key, ctx); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	if _, err := users.DeleteUser(admin.ID, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Authenticate(created.Key, ctx); !errors.Is(err, repository.ErrInvalidAPIKey) {
+		t.Fatalf("Authenticate with a deleted owner: got %v, want ErrInvalidAPIKey", err)
+	}
+
+	if err := users.RestoreUser(admin.ID, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Authenticate(created.Key, ctx); err != nil {
+		t.Fatalf("Authenticate after the owner is restored: %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+	minPasswordLength = 8
+)
+
+// AuthServe
+type AuthServe struct {
+	Users      repository.UserRepository
+	Tokens     repository.TokenRepository
+	Signer     *auth.Signer
+	RefreshTTL time.Duration
+	// TwoFactor проверяет второй фактор при входе пользователей с включенной 2FA
+	TwoFactor TwoFactorService
+	// Email отправляет письмо подтверждения после регистрации; nil - письма не отправляются
+	Email EmailService
+}
+
+// RegisterRequest - данные для регистрации нового пользователя.
+type RegisterRequest struct {
+	Name     string `json:"name"`
+	Surname  string `json:"surname"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// TokenPair - выданные клиенту токены. ExpiresIn - время жизни access-токена в секундах.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// AuthResult - результат регистрации или входа.
+type AuthResult struct {
+	User *model.User `json:"user"`
+	TokenPair
+}
+
+type AuthService interface {
+	Register(req RegisterRequest, ctx context.Context) (*AuthResult, error)
+	Login(email, password string, factor SecondFactor, ctx context.Context) (*AuthResult, error)
+	Refresh(refreshToken string, ctx context.Context) (*TokenPair, error)
+	Logout(refreshToken string, ctx context.Context) error
+	Authenticate(accessToken string, ctx context.Context) (int64, error)
+}
+
+// NewAuthService создает сервис входа. Нулевой refreshTTL заменяется на DefaultRefreshTTL,
+// email может быть nil.
+func NewAuthService(users repository.UserRepository, tokens repository.TokenRepository, signer *auth.Signer, refreshTTL time.Duration,
+	twoFactor TwoFactorService, email EmailService) AuthService {
+	if refreshTTL <= 0 {
+		refreshTTL = DefaultRefreshTTL
+	}
+	return &AuthServe{Users: users, Tokens: tokens, Signer: signer, RefreshTTL: refreshTTL, TwoFactor: twoFactor, Email: email}
+}
+
+// dummyHash сравнивается с паролем, когда пользователь не найден, чтобы время ответа
+// не выдавало, зарегистрирован ли email.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+func (AS *AuthServe) Register(req RegisterRequest, ctx context.Context) (*AuthResult, error) {
+	if err := requireFields(map[string]string{"name": req.Name, "surname": req.Surname, "email": req.Email, "password": req.Password}); err != nil {
+		return nil, fmt.Errorf("Failed to register: %w", err)
+	}
+	if err := checkPassword(req.Password); err != nil {
+		return nil, fmt.Errorf("Failed to register: %w", err)
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to register: %w", err)
+	}
+	req.Email = email
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to register: %w", err)
+	}
+
+	user := &model.User{Name: req.Name, Surname: req.Surname, Email: req.Email, PasswordHash: string(hash), Role: model.RoleUser}
+	if err := AS.Users.CreateUser(user, ctx); err != nil {
+		return nil, fmt.Errorf("Failed to register: %w", err)
+	}
+	notifyNewEmail(AS.Email, user, ctx)
+	pair, err := AS.issue(user.ID, newFamilyID(), ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to register: %w", err)
+	}
+	return &AuthResult{User: user, TokenPair: *pair}, nil
+}
+
+// Login проверяет пароль, а для пользователей с 2FA - еще и второй фактор. Без второго фактора
+// возвращает ErrOTPRequired, чтобы клиент запросил код и повторил вход.
+func (AS *AuthServe) Login(email, password string, factor SecondFactor, ctx context.Context) (*AuthResult, error) {
+	if normalized, err := normalizeEmail(email); err == nil {
+		email = normalized
+	}
+	user, err := AS.Users.GetUserByEmail(email, ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+			return nil, fmt.Errorf("Failed to login: %w", repository.ErrInvalidCredentials)
+		}
+		return nil, fmt.Errorf("Failed to login: %w", err)
+	}
+	if user.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, fmt.Errorf("Failed to login: %w", repository.ErrInvalidCredentials)
+	}
+	if err := AS.TwoFactor.VerifySecondFactor(user, factor, ctx); err != nil {
+		return nil, fmt.Errorf("Failed to login: %w", err)
+	}
+
+	pair, err := AS.issue(user.ID, newFamilyID(), ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to login: %w", err)
+	}
+	return &AuthResult{User: user, TokenPair: *pair}, nil
+}
+
+// Refresh обменивает refresh-токен на новую пару токенов, старый refresh-токен отзывается.
+// Предъявление уже отозванного токена считается кражей: отзывается все семейство.
+func (AS *AuthServe) Refresh(refreshToken string, ctx context.Context) (*TokenPair, error) {
+	old, err := AS.Tokens.GetRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("Failed to refresh token: %w", repository.ErrInvalidToken)
+		}
+		return nil, fmt.Errorf("Failed to refresh token: %w", err)
+	}
+	if old.RevokedAt != nil {
+		if err := AS.Tokens.RevokeTokenFamily(ctx, old.FamilyID); err != nil {
+			return nil, fmt.Errorf("Failed to refresh token: %w", err)
+		}
+		return nil, fmt.Errorf("Failed to refresh token: %w", repository.ErrInvalidToken)
+	}
+	if time.Now().After(old.ExpiresAt) {
+		return nil, fmt.Errorf("Failed to refresh token: %w", repository.ErrInvalidToken)
+	}
+	//удаленный пользователь не может продлевать сессию
+	if err := AS.Users.CheckIfExistsByID(old.UserID, ctx); !errors.Is(err, repository.ErrUserExists) {
+		return nil, fmt.Errorf("Failed to refresh token: %w", repository.ErrInvalidToken)
+	}
+
+	raw, next := AS.newRefreshToken(old.UserID, old.FamilyID)
+	if err := AS.Tokens.RotateRefreshToken(ctx, old, next); err != nil {
+		return nil, fmt.Errorf("Failed to refresh token: %w", err)
+	}
+	return AS.pair(old.UserID, raw)
+}
+
+// Logout отзывает refresh-токен и все токены его семейства.
+func (AS *AuthServe) Logout(refreshToken string, ctx context.Context) error {
+	token, err := AS.Tokens.GetRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("Failed to logout: %w", repository.ErrInvalidToken)
+		}
+		return fmt.Errorf("Failed to logout: %w", err)
+	}
+	if err := AS.Tokens.RevokeTokenFamily(ctx, token.FamilyID); err != nil {
+		return fmt.Errorf("Failed to logout: %w", err)
+	}
+	return nil
+}
+
+// Authenticate проверяет access-токен и возвращает id пользователя. Токены удаленного пользователя
+// не принимаются, пока он не будет восстановлен, хотя срок их действия еще не истек.
+func (AS *AuthServe) Authenticate(accessToken string, ctx context.Context) (int64, error) {
+	userID, err := AS.Signer.Parse(accessToken)
+	if err != nil {
+		return 0, repository.ErrInvalidToken
+	}
+	switch err := AS.Users.CheckIfExistsByID(userID, ctx); {
+	case errors.Is(err, repository.ErrUserNotFound):
+		return 0, repository.ErrInvalidToken
+	case !errors.Is(err, repository.ErrUserExists):
+		return 0, fmt.Errorf("Failed to authenticate access token: %w", err)
+	}
+	return userID, nil
+}
+
+// issue выпускает новую пару токенов в семействе familyID.
+func (AS *AuthServe) issue(userID int64, familyID string, ctx context.Context) (*TokenPair, error) {
+	raw, token := AS.newRefreshToken(userID, familyID)
+	if err := AS.Tokens.CreateRefreshToken(ctx, token); err != nil {
+		return nil, err
+	}
+	return AS.pair(userID, raw)
+}
+
+func (AS *AuthServe) pair(userID int64, refreshToken string) (*TokenPair, error) {
+	access, err := AS.Signer.Sign(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(AS.Signer.TTL().Seconds()),
+	}, nil
+}
+
+func (AS *AuthServe) newRefreshToken(userID int64, familyID string) (string, *model.RefreshToken) {
+	raw := randomToken()
+	return raw, &model.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(AS.RefreshTTL),
+	}
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newFamilyID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+)
+
+func TestRefreshRejectsDeletedUser(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	users := repository.NewMemoryUserRepository(store)
+	signer, err := auth.NewHS256Signer([]byte("0123456789abcdef0123456789abcdef"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewAuthService(users, repository.NewMemoryTokenRepository(store), signer, 0, nil, nil)
+	registered, err := svc.Register(RegisterRequest{Name: "Ann", Surname: "Lee", Email: "ann@example.com", Password: "Secret123!pass"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := users.DeleteUser(registered.User.ID, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Refresh(registered.RefreshToken, ctx); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Fatalf("Refresh of a deleted user: got %v, want ErrInvalidToken", err)
+	}
+
+	if err := users.RestoreUser(registered.User.ID, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Refresh(registered.RefreshToken, ctx); err != nil {
+		t.Fatalf("Refresh after the user is restored: %v", err)
+	}
+}
+
+func TestAuthenticateRejectsDeletedUser(t *testing.T) {
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+	users := repository.NewMemoryUserRepository(store)
+	signer, err := auth.NewHS256Signer([]byte("0123456789abcdef0123456789abcdef"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewAuthService(users, repository.NewMemoryTokenRepository(store), signer, 0, nil, nil)
+	registered, err := svc.Register(RegisterRequest{Name: "Ann", Surname: "Lee", Email: "ann@example.com", Password: "Secret123!pass"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := svc.Authenticate(registered.AccessToken, ctx); err != nil || id != registered.User.ID {
+		t.Fatalf("Authenticate: got %d, %v, want %d", id, err, registered.User.ID)
+	}
+	if _, err := svc.Authenticate("not-a-token", ctx); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Fatalf("Authenticate of a malformed token: got %v, want ErrInvalidToken", err)
+	}
+
+	if _, err := users.DeleteUser(registered.User.ID, 0, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Authenticate(registered.AccessToken, ctx); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Fatalf("Authenticate of a deleted user: got %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+)
+
+// BlockUser - user блокирует target. Существующая дружба и заявки между ними удаляются.
+func (FS *FriendServe) BlockUser(user, target int64, ctx context.Context) error {
+	if user == target {
+		return fmt.Errorf("Failed to block user: %w", repository.ErrSelfBlock)
+	}
+	if err := FS.Repo.BlockUser(ctx, &model.Block{BlockerID: user, BlockedID: target}); err != nil {
+		return fmt.Errorf("Failed to block user: %w", err)
+	}
+	return nil
+}
+
+func (FS *FriendServe) UnblockUser(user, target int64, ctx context.Context) error {
+	if user == target {
+		return fmt.Errorf("Failed to unblock user: %w", repository.ErrSelfBlock)
+	}
+	if err := FS.Repo.UnblockUser(ctx, &model.Block{BlockerID: user, BlockedID: target}); err != nil {
+		return fmt.Errorf("Failed to unblock user: %w", err)
+	}
+	return nil
+}
+
+func (FS *FriendServe) GetBlockedUsers(user int64, ctx context.Context) ([]model.Block, error) {
+	if err := FS.UserRepo.CheckIfExistsByID(user, ctx); errors.Is(err, repository.ErrUserNotFound) {
+		return nil, fmt.Errorf("Failed to fetch blocked users: %w", err)
+	}
+	blocks, err := FS.Repo.GetBlockedUsers(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch blocked users: %w", err)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+)
+
+// pageCursor - содержимое курсора. Для клиента он непрозрачен: это base64 от JSON
+// с сортировкой, под которую курсор выдан, и ключами последней записи страницы.
+type pageCursor struct {
+	Sort   string   `json:"s,omitempty"`
+	Values []string `json:"v,omitempty"`
+	ID     int64    `json:"id"`
+}
+
+func encodeCursor(sort []repository.SortField, last model.User) string {
+	cursor := pageCursor{Sort: formatSort(sort), ID: last.ID}
+	for _, field := range sort {
+		if field.Field == "id" {
+			break
+		}
+		cursor.Values = append(cursor.Values, repository.UserSortValue(last, field.Field))
+	}
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor разбирает курсор и проверяет, что он выдан для той же сортировки.
+func decodeCursor(cursor string, sort []repository.SortField) (*repository.Keyset, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, repository.ErrInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID <= 0 {
+		return nil, repository.ErrInvalidCursor
+	}
+	if c.Sort != formatSort(sort) {
+		return nil, repository.ErrInvalidCursor
+	}
+	return &repository.Keyset{Values: c.Values, ID: c.ID}, nil
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/mail"
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultVerifyEmailTTL   = 48 * time.Hour
+	DefaultPasswordResetTTL = time.Hour
+)
+
+// EmailServe подтверждает email и сбрасывает пароль по одноразовым подписанным ссылкам из писем.
+// BaseURL - адрес фронтенда, на который ведут ссылки; сам токен тоже есть в письме.
+type EmailServe struct {
+	Users            repository.UserRepository
+	Tokens           repository.EmailTokenRepository
+	Mailer           mail.Mailer
+	Signer           *auth.ActionSigner
+	BaseURL          string
+	VerifyEmailTTL   time.Duration
+	PasswordResetTTL time.Duration
+	Now              func() time.Time
+}
+
+// PasswordResetRequest - новый пароль и токен из письма.
+type PasswordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type EmailService interface {
+	SendVerification(user *model.User, ctx context.Context) error
+	RequestVerification(userID int64, ctx context.Context) error
+	VerifyEmail(userID int64, token string, ctx context.Context) error
+	RequestPasswordReset(email string, ctx context.Context) error
+	ResetPassword(req PasswordResetRequest, ctx context.Context) error
+}
+
+func NewEmailService(users repository.UserRepository, tokens repository.EmailTokenRepository, mailer mail.Mailer, signer *auth.ActionSigner, baseURL string) EmailService {
+	return &EmailServe{
+		Users:            users,
+		Tokens:           tokens,
+		Mailer:           mailer,
+		Signer:           signer,
+		BaseURL:          baseURL,
+		VerifyEmailTTL:   DefaultVerifyEmailTTL,
+		PasswordResetTTL: DefaultPasswordResetTTL,
+		Now:              time.Now,
+	}
+}
+
+// SendVerification отправляет письмо со ссылкой подтверждения email.
+func (ES *EmailServe) SendVerification(user *model.User, ctx context.Context) error {
+	token, err := ES.issue(user, auth.PurposeVerifyEmail, ES.VerifyEmailTTL, ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to send verification email: %w", err)
+	}
+	link := ES.link("/verify-email", url.Values{"user": {strconv.FormatInt(user.ID, 10)}, "token": {token}})
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Подтвердите email",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы подтвердить email, перейдите по ссылке:\n%s\n\nИли отправьте токен в POST /users/%d/verify_email:\n%s\n",
+			user.Name, link, user.ID, token),
+	}
+	if err := ES.Mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("Failed to send verification email: %w", err)
+	}
+	return nil
+}
+
+// RequestVerification повторно отправляет письмо подтверждения. Прежние ссылки перестают действовать.
+func (ES *EmailServe) RequestVerification(userID int64, ctx context.Context) error {
+	user, err := ES.Users.GetUserByID(userID, ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("Failed to send verification email: %w", repository.ErrUserNotFound)
+		}
+		return fmt.Errorf("Failed to send verification email: %w", err)
+	}
+	if user.EmailVerifiedAt != nil {
+		return fmt.Errorf("Failed to send verification email: %w", repository.ErrEmailAlreadyVerified)
+	}
+	return ES.SendVerification(user, ctx)
+}
+
+// VerifyEmail подтверждает email пользователя userID по токену из письма.
+func (ES *EmailServe) VerifyEmail(userID int64, token string, ctx context.Context) error {
+	claims, err := ES.Signer.Verify(token, auth.PurposeVerifyEmail, ES.now())
+	if err != nil || claims.UserID != userID {
+		return fmt.Errorf("Failed to verify email: %w", repository.ErrInvalidToken)
+	}
+	if err := ES.Tokens.VerifyEmail(ctx, userID, claims.Nonce, ES.now()); err != nil {
+		return fmt.Errorf("Failed to verify email: %w", err)
+	}
+	return nil
+}
+
+// RequestPasswordReset отправляет ссылку сброса пароля. Для неизвестного email молча ничего не делает,
+// чтобы по ответу нельзя было узнать, зарегистрирован ли адрес.
+func (ES *EmailServe) RequestPasswordReset(email string, ctx context.Context) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return fmt.Errorf("Failed to request password reset: %w", err)
+	}
+	user, err := ES.Users.GetUserByEmail(email, ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("Failed to request password reset: %w", err)
+	}
+	token, err := ES.issue(user, auth.PurposePasswordReset, ES.PasswordResetTTL, ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to request password reset: %w", err)
+	}
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Сброс пароля",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы задать новый пароль, перейдите по ссылке:\n%s\n\nИли отправьте токен в POST /auth/password_reset/confirm:\n%s\n\nЕсли вы не запрашивали сброс, просто проигнорируйте это письмо.\n",
+			user.Name, ES.link("/reset-password", url.Values{"token": {token}}), token),
+	}
+	if err := ES.Mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("Failed to request password reset: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword задает новый пароль по токену из письма и завершает все сессии пользователя.
+func (ES *EmailServe) ResetPassword(req PasswordResetRequest, ctx context.Context) error {
+	if err := checkPassword(req.Password); err != nil {
+		return fmt.Errorf("Failed to reset password: %w", err)
+	}
+	claims, err := ES.Signer.Verify(req.Token, auth.PurposePasswordReset, ES.now())
+	if err != nil {
+		return fmt.Errorf("Failed to reset password: %w", repository.ErrInvalidToken)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("Failed to reset password: %w", err)
+	}
+	if err := ES.Tokens.ResetPassword(ctx, claims.UserID, claims.Nonce, string(hash), ES.now()); err != nil {
+		return fmt.Errorf("Failed to reset password: %w", err)
+	}
+	return nil
+}
+
+// notifyNewEmail отправляет письмо подтверждения на новый или измененный email. Ошибка отправки
+// не отменяет создание или изменение пользователя: письмо можно запросить повторно.
+// Без сервиса писем ничего не делает.
+func notifyNewEmail(email EmailService, user *model.User, ctx context.Context) {
+	if email == nil {
+		return
+	}
+	if err := email.SendVerification(user, ctx); err != nil {
+		log.Println(err)
+	}
+}
+
+// issue выдает токен на текущий email пользователя: после смены адреса ссылка перестает действовать
+func (ES *EmailServe) issue(user *model.User, purpose auth.Purpose, ttl time.Duration, ctx context.Context) (string, error) {
+	claims := auth.ActionClaims{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Nonce:     randomHex(16),
+		ExpiresAt: ES.now().Add(ttl),
+	}
+	token, err := ES.Signer.Sign(claims)
+	if err != nil {
+		return "", err
+	}
+	record := model.EmailToken{UserID: user.ID, Purpose: string(purpose), Nonce: claims.Nonce, Email: user.Email, ExpiresAt: claims.ExpiresAt}
+	if err := ES.Tokens.CreateEmailToken(ctx, &record); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (ES *EmailServe) link(path string, query url.Values) string {
+	return ES.BaseURL + path + "?" + query.Encode()
+}
+
+func (ES *EmailServe) now() time.Time {
+	if ES.Now == nil {
+		return time.Now()
+	}
+	return ES.Now()
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/auth"
+	"github.com/UnendingLoop/users-api/cmd/internal/mail"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const emailTestBaseURL = "https://app.example.com"
+
+// emailTest - сервис писем на хранилище в памяти с управляемыми часами и зарегистрированный пользователь
+type emailTest struct {
+	email  *EmailServe
+	auth   AuthService
+	users  repository.UserRepository
+	mailer *mail.MemoryMailer
+	now    time.Time
+	user   *AuthResult
+}
+
+func newEmailTest(t *testing.T) *emailTest {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	users := repository.NewMemoryUserRepository(store)
+	signer, err := auth.NewHS256Signer([]byte("0123456789abcdef0123456789abcdef"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actionSigner, err := auth.NewActionSigner([]byte("fedcba9876543210fedcba9876543210"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	et := &emailTest{users: users, mailer: &mail.MemoryMailer{}, now: time.Now()}
+	et.email = NewEmailService(users, repository.NewMemoryEmailTokenRepository(store), et.mailer, actionSigner, emailTestBaseURL).(*EmailServe)
+	et.email.Now = func() time.Time { return et.now }
+	et.auth = NewAuthService(users, repository.NewMemoryTokenRepository(store), signer, 0, nil, et.email)
+	et.user, err = et.auth.Register(RegisterRequest{Name: "Ann", Surname: "Lee", Email: "ann@example.com", Password: "Secret123!pass"}, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return et
+}
+
+// mailedToken - токен из ссылки path в последнем письме на адрес to
+func (et *emailTest) mailedToken(t *testing.T, to, path string) string {
+	t.Helper()
+	msg, ok := et.mailer.Last(to)
+	if !ok {
+		t.Fatalf("no email sent to %s", to)
+	}
+	for _, line := range strings.Split(msg.Body, "\n") {
+		if !strings.HasPrefix(line, emailTestBaseURL+path+"?") {
+			continue
+		}
+		link, err := url.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return link.Query().Get("token")
+	}
+	t.Fatalf("email to %s has no %s link:\n%s", to, path, msg.Body)
+	return ""
+}
+
+// requestReset запрашивает сброс пароля и возвращает токен из письма
+func (et *emailTest) requestReset(t *testing.T) string {
+	t.Helper()
+	if err := et.email.RequestPasswordReset("ann@example.com", context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return et.mailedToken(t, "ann@example.com", "/reset-password")
+}
+
+func (et *emailTest) verified(t *testing.T) bool {
+	t.Helper()
+	user, err := et.users.GetUserByID(et.user.User.ID, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.EmailVerifiedAt != nil
+}
+
+func TestVerifyEmailOnce(t *testing.T) {
+	ctx := context.Background()
+	et := newEmailTest(t)
+	token := et.mailedToken(t, "ann@example.com", "/verify-email")
+
+	if err := et.email.VerifyEmail(et.user.User.ID+1, token, ctx); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Fatalf("VerifyEmail for another user: got %v, want ErrInvalidToken", err)
+	}
+	if err := et.email.VerifyEmail(et.user.User.ID, token, ctx); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if !et.verified(t) {
+		t.Fatal("VerifyEmail must mark the email verified")
+	}
+	if err := et.email.VerifyEmail(et.user.User.ID, token, ctx); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Fatalf("second VerifyEmail: got %v, want ErrInvalidToken", err)
+	}
+	if err := et.email.RequestVerification(et.user.User.ID, ctx); !errors.Is(err, repository.ErrEmailAlreadyVerified) {
+		t.Fatalf("RequestVerification of a verified email: got %v, want ErrEmailAlreadyVerified", err)
+	}
+}
+
+func TestEmailTokensExpire(t *testing.T) {
+	ctx := context.Background()
+	et := newEmailTest(t)
+	verify := et.mailedToken(t, "ann@example.com", "/verify-email")
+	reset := et.requestReset(t)
+	start := et.now
+
+	et.now = start.Add(et.email.PasswordResetTTL + time.Second)
+	err := et.email.ResetPassword(PasswordResetRequest{Token: reset, Password: "Another123!pass"}, ctx)
+	if !errors.Is(err, repository.ErrInvalidToken) {
+		t.Fatalf("ResetPassword after the reset TTL: got %v, want ErrInvalidToken", err)
+	}
+	et.now = start.Add(et.email.VerifyEmailTTL + time.Second)
+	if err := et.email.VerifyEmail(et.user.User.ID, verify, ctx); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Fatalf("VerifyEmail after the verification TTL: got %v, want ErrInvalidToken", err)
+	}
+	if et.verified(t) {
+		t.Fatal("an expired link must not verify the email")
+	}
+
+	//новая ссылка действует, пока не истек ее собственный срок
+	if err := et.email.RequestVerification(et.user.User.ID, ctx); err != nil {
+		t.Fatal(err)
+	}
+	verify = et.mailedToken(t, "ann@example.com", "/verify-email")
+	et.now = et.now.Add(et.email.VerifyEmailTTL - time.Second)
+	if err := et.email.VerifyEmail(et.user.User.ID, verify, ctx); err != nil {
+		t.Fatalf("VerifyEmail just before the TTL: %v", err)
+	}
+}
+
+// новое письмо гасит ссылки из прежних писем того же назначения
+func TestResendInvalidatesEarlierTokens(t *testing.T) {
+	ctx := context.Background()
+	et := newEmailTest(t)
+	first := et.mailedToken(t, "ann@example.com", "/verify-email")
+	if err := et.email.RequestVerification(et.user.User.ID, ctx); err != nil {
+		t.Fatal(err)
+	}
+	second := et.mailedToken(t, "ann@example.com", "/verify-email")
+	if err := et.email.VerifyEmail(et.user.User.ID, first, ctx); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Fatalf("VerifyEmail with a superseded link: got %v, want ErrInvalidToken", err)
+	}
+
+	firstReset := et.requestReset(t)
+	secondReset := et.requestReset(t)
+	err := et.email.ResetPassword(PasswordResetRequest{Token: firstReset, Password: "Another123!pass"}, ctx)
+	if !errors.Is(err, repository.ErrInvalidToken) {
+		t.Fatalf("ResetPassword with a superseded link: got %v, want ErrInvalidToken", err)
+	}
+	//ссылка сброса не гасит ссылку подтверждения
+	if err := et.email.VerifyEmail(et.user.User.ID, second, ctx); err != nil {
+		t.Fatalf("VerifyEmail with the latest link: %v", err)
+	}
+	if err := et.email.ResetPassword(PasswordResetRequest{Token: secondReset, Password: "Another123!pass"}, ctx); err != nil {
+		t.Fatalf("ResetPassword with the latest link: %v", err)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := context.Background()
+	et := newEmailTest(t)
+	token := et.requestReset(t)
+
+	err := et.email.ResetPassword(PasswordResetRequest{Token: token, Password: "short"}, ctx)
+	if !errors.Is(err, repository.ErrWeakPassword) {
+		t.Fatalf("ResetPassword with a weak password: got %v, want ErrWeakPassword", err)
+	}
+	if err := et.email.ResetPassword(PasswordResetRequest{Token: token, Password: "Another123!pass"}, ctx); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	user, err := et.users.GetUserByID(et.user.User.ID, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("Another123!pass")) != nil {
+		t.Fatal("ResetPassword must set the new password")
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Fatal("a reset link proves the email, it must become verified")
+	}
+	if _, err := et.auth.Refresh(et.user.RefreshToken, ctx); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Fatalf("Refresh after a password reset: got %v, want ErrInvalidToken", err)
+	}
+	err = et.email.ResetPassword(PasswordResetRequest{Token: token, Password: "Third123!pass"}, ctx)
+	if !errors.Is(err, repository.ErrInvalidToken) {
+		t.Fatalf("second ResetPassword: got %v, want ErrInvalidToken", err)
+	}
+
+	//для незарегистрированного адреса письмо не отправляется, а ответ тот же
+	sent := len(et.mailer.Sent())
+	if err := et.email.RequestPasswordReset("nobody@example.com", ctx); err != nil {
+		t.Fatalf("RequestPasswordReset of an unknown email: %v", err)
+	}
+	if len(et.mailer.Sent()) != sent {
+		t.Fatal("RequestPasswordReset must not send email to an unknown address")
+	}
+}
+
+// ссылка, ушедшая на прежний адрес, не подтверждает новый
+func TestResetLinkAfterEmailChange(t *testing.T) {
+	ctx := context.Background()
+	et := newEmailTest(t)
+	token := et.requestReset(t)
+
+	user, err := et.users.GetUserByID(et.user.User.ID, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Email, user.EmailVerifiedAt = "ann@example.org", nil
+	if err := et.users.UpdateUser(user, ctx); err != nil {
+		t.Fatal(err)
+	}
+	err = et.email.ResetPassword(PasswordResetRequest{Token: token, Password: "Another123!pass"}, ctx)
+	if !errors.Is(err, repository.ErrInvalidToken) {
+		t.Fatalf("ResetPassword with a link to the previous email: got %v, want ErrInvalidToken", err)
+	}
+	if et.verified(t) {
+		t.Fatal("a link to the previous email must not verify the new one")
+	}
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultPathDepth - глубина поиска пути по умолчанию ("шесть рукопожатий").
+	DefaultPathDepth = 6
+	// DefaultPathVisitBudget - сколько пользователей может посетить один поиск пути.
+	DefaultPathVisitBudget = 10000
+)
+
+// FriendPath - кратчайшая цепочка дружб между двумя пользователями, включая их самих.
+type FriendPath struct {
+	Users   []model.User `json:"users"`
+	Degrees int          `json:"degrees"`
+}
+
+// bfsSide - состояние поиска в ширину с одной из сторон.
+type bfsSide struct {
+	parent   map[int64]int64
+	dist     map[int64]int
+	frontier []int64
+	depth    int
+}
+
+func newBFSSide(start int64) *bfsSide {
+	return &bfsSide{
+		parent:   map[int64]int64{start: start},
+		dist:     map[int64]int{start: 0},
+		frontier: []int64{start},
+	}
+}
+
+// FindPath ищет кратчайший путь от user до target двунаправленным поиском в ширину:
+// на каждом шаге раскрывается меньший из двух фронтов, пока они не встретятся.
+// maxDepth ограничивает длину пути, VisitBudget - количество посещенных пользователей.
+func (FS *FriendServe) FindPath(user, target int64, maxDepth int, ctx context.Context) (*FriendPath, error) {
+	limit := FS.MaxPathDepth
+	if limit <= 0 {
+		limit = DefaultPathDepth
+	}
+	if maxDepth == 0 {
+		maxDepth = limit
+	}
+	if maxDepth < 0 || maxDepth > limit {
+		return nil, fmt.Errorf("Failed to find path: %w", repository.ErrInvalidDepth)
+	}
+	budget := FS.PathVisitBudget
+	if budget <= 0 {
+		budget = DefaultPathVisitBudget
+	}
+	if err := FS.UserRepo.CheckIfExistsByID(user, ctx); errors.Is(err, repository.ErrUserNotFound) {
+		return nil, fmt.Errorf("Failed to find path: %w", err)
+	}
+	if err := FS.UserRepo.CheckIfExistsByID(target, ctx); errors.Is(err, repository.ErrUserNotFound) {
+		return nil, fmt.Errorf("Failed to find path: %w", err)
+	}
+
+	ids, err := FS.bidirectionalBFS(user, target, maxDepth, budget, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find path: %w", err)
+	}
+
+	path := &FriendPath{Users: make([]model.User, 0, len(ids)), Degrees: len(ids) - 1}
+	for _, id := range ids {
+		u, err := FS.UserRepo.GetUserByID(id, ctx)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("Failed to find path: %w", repository.ErrUserNotFound)
+			}
+			return nil, fmt.Errorf("Failed to find path: %w", err)
+		}
+		path.Users = append(path.Users, *u)
+	}
+	return path, nil
+}
+
+func (FS *FriendServe) bidirectionalBFS(user, target int64, maxDepth, budget int, ctx context.Context) ([]int64, error) {
+	if user == target {
+		return []int64{user}, nil
+	}
+	fwd, bwd := newBFSSide(user), newBFSSide(target)
+	visited := 2
+
+	for fwd.depth+bwd.depth < maxDepth && len(fwd.frontier) > 0 && len(bwd.frontier) > 0 {
+		this, other := fwd, bwd
+		if len(bwd.frontier) < len(fwd.frontier) {
+			this, other = bwd, fwd
+		}
+
+		neighbours, err := FS.Repo.GetFriendIDs(ctx, this.frontier)
+		if err != nil {
+			return nil, err
+		}
+		this.depth++
+		var next []int64
+		meet, meetDist := int64(0), -1
+		for _, u := range this.frontier {
+			for _, v := range neighbours[u] {
+				if _, seen := this.parent[v]; seen {
+					continue
+				}
+				this.parent[v], this.dist[v] = u, this.depth
+				next = append(next, v)
+				//на одном уровне все встречи дают одинаковую длину со стороны this,
+				//поэтому выбираем точку, ближайшую к другой стороне
+				if d, ok := other.dist[v]; ok && (meetDist < 0 || d < meetDist) {
+					meet, meetDist = v, d
+				}
+				if visited++; visited > budget {
+					return nil, repository.ErrPathSearchLimit
+				}
+			}
+		}
+		if meetDist >= 0 {
+			return joinPath(fwd, bwd, meet), nil
+		}
+		this.frontier = next
+	}
+	return nil, repository.ErrPathNotFound
+}
+
+// joinPath склеивает путь от начала fwd до meet и от meet до начала bwd.
+func joinPath(fwd, bwd *bfsSide, meet int64) []int64 {
+	var head []int64
+	for v := meet; ; v = fwd.parent[v] {
+		head = append(head, v)
+		if fwd.parent[v] == v {
+			break
+		}
+	}
+	for i, j := 0, len(head)-1; i < j; i, j = i+1, j-1 {
+		head[i], head[j] = head[j], head[i]
+	}
+	for v := meet; bwd.parent[v] != v; {
+		v = bwd.parent[v]
+		head = append(head, v)
+	}
+	return head
+}
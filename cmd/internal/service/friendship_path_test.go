@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+)
+
+// pathEdge - связь между пользователями с номерами from и to в тесте поиска пути
+type pathEdge struct {
+	from, to int
+	status   model.FriendshipStatus
+}
+
+// friends - принятые дружбы по цепочке номеров: friends(0, 1, 2) - это 0-1 и 1-2
+func friends(chain ...int) []pathEdge {
+	var edges []pathEdge
+	for i := 1; i < len(chain); i++ {
+		edges = append(edges, pathEdge{chain[i-1], chain[i], model.FriendshipAccepted})
+	}
+	return edges
+}
+
+func TestFindPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		users    int
+		edges    []pathEdge
+		blocks   [][2]int
+		deleted  []int
+		from, to int
+		maxDepth int
+		budget   int
+		want     []int
+		wantErr  error
+	}{
+		{name: "self", users: 1, want: []int{0}},
+		{name: "no path", users: 3, edges: friends(0, 1), from: 0, to: 2, wantErr: repository.ErrPathNotFound},
+		{name: "length equals max depth", users: 4, edges: friends(0, 1, 2, 3), to: 3, maxDepth: 3, want: []int{0, 1, 2, 3}},
+		{name: "length exceeds max depth", users: 5, edges: friends(0, 1, 2, 3, 4), to: 4, maxDepth: 3, wantErr: repository.ErrPathNotFound},
+		{name: "default depth", users: 8, edges: friends(0, 1, 2, 3, 4, 5, 6, 7), to: 6, want: []int{0, 1, 2, 3, 4, 5, 6}},
+		{name: "beyond default depth", users: 8, edges: friends(0, 1, 2, 3, 4, 5, 6, 7), to: 7, wantErr: repository.ErrPathNotFound},
+		{name: "shortest of two", users: 5, edges: append(friends(0, 1, 2, 4), friends(0, 3, 4)...), to: 4, want: []int{0, 3, 4}},
+		{
+			name: "skips a pending request", users: 4, to: 3, want: []int{0, 1, 2, 3},
+			edges: append(friends(0, 1, 2, 3), pathEdge{1, 3, model.FriendshipPending}),
+		},
+		{
+			name: "skips a declined request", users: 4, to: 3, want: []int{0, 1, 2, 3},
+			edges: append(friends(0, 1, 2, 3), pathEdge{3, 1, model.FriendshipDeclined}),
+		},
+		{
+			name: "skips a deleted user", users: 5, to: 3, deleted: []int{1}, want: []int{0, 2, 4, 3},
+			edges: append(friends(0, 1, 3), friends(0, 2, 4, 3)...),
+		},
+		{
+			name: "skips a blocked pair", users: 5, to: 3, blocks: [][2]int{{1, 3}}, want: []int{0, 2, 4, 3},
+			edges: append(friends(0, 1, 3), friends(0, 2, 4, 3)...),
+		},
+		{name: "deleted target", users: 2, edges: friends(0, 1), to: 1, deleted: []int{1}, wantErr: repository.ErrUserNotFound},
+		{
+			//у каждого конца по три друга: первый же шаг посещает больше четырех пользователей
+			name: "visit budget", users: 8, to: 7, budget: 4, wantErr: repository.ErrPathSearchLimit,
+			edges: append(append(friends(1, 0, 2), friends(0, 3)...), append(friends(4, 7, 5), friends(7, 6)...)...),
+		},
+		{name: "depth above the limit", users: 2, edges: friends(0, 1), to: 1, maxDepth: DefaultPathDepth + 1, wantErr: repository.ErrInvalidDepth},
+		{name: "negative depth", users: 2, edges: friends(0, 1), to: 1, maxDepth: -1, wantErr: repository.ErrInvalidDepth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := repository.NewMemoryStore()
+			users, friendRepo := repository.NewMemoryUserRepository(store), repository.NewMemoryFriendRepository(store)
+			ids := make([]int64, tt.users)
+			for i := range ids {
+				user := model.User{Name: fmt.Sprint("User", i), Surname: "Test", Email: fmt.Sprintf("user%d@example.com", i)}
+				if err := users.CreateUser(&user, ctx); err != nil {
+					t.Fatal(err)
+				}
+				ids[i] = user.ID
+			}
+			for _, e := range tt.edges {
+				if err := friendRepo.AddFriend(ctx, &model.Friendship{RequesterID: ids[e.from], AccepterID: ids[e.to], Status: e.status}); err != nil {
+					t.Fatalf("AddFriend(%d, %d): %v", e.from, e.to, err)
+				}
+			}
+			for _, b := range tt.blocks {
+				if err := friendRepo.BlockUser(ctx, &model.Block{BlockerID: ids[b[0]], BlockedID: ids[b[1]]}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, i := range tt.deleted {
+				if _, err := users.DeleteUser(ids[i], 0, ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			fs := NewFriendService(friendRepo, users, 0, tt.budget).(*FriendServe)
+			path, err := fs.FindPath(ids[tt.from], ids[tt.to], tt.maxDepth, ctx)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("FindPath: got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindPath: %v", err)
+			}
+			got := make([]int64, len(path.Users))
+			for i, u := range path.Users {
+				got[i] = u.ID
+			}
+			want := make([]int64, len(tt.want))
+			for i, n := range tt.want {
+				want[i] = ids[n]
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) || path.Degrees != len(want)-1 {
+				t.Fatalf("FindPath: got path %v with %d degrees, want %v", got, path.Degrees, want)
+			}
+		})
+	}
+}
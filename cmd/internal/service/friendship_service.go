@@ -7,49 +7,164 @@ import (
 
 	"github.com/UnendingLoop/users-api/cmd/internal/model"
 	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"gorm.io/gorm"
 )
 
 // FriendServe
 type FriendServe struct {
 	Repo     repository.FriendRepository
 	UserRepo repository.UserRepository
+
+	// MaxPathDepth и PathVisitBudget ограничивают поиск пути между пользователями,
+	// нулевые значения заменяются на DefaultPathDepth и DefaultPathVisitBudget.
+	MaxPathDepth    int
+	PathVisitBudget int
+}
+
+// MutualFriends - страница общих друзей двух пользователей и их общее количество.
+type MutualFriends struct {
+	Users   []model.User `json:"users"`
+	Count   int64        `json:"count"`
+	HasMore bool         `json:"has_more"`
 }
 
 type FriendshipService interface {
-	AddFriend(user, friend int64, ctx context.Context) error
+	AddFriend(user, friend int64, ctx context.Context) (*model.Friendship, error)
 	RemoveFriend(user, friend int64, ctx context.Context) error
 	GetFriends(user int64, ctx context.Context) ([]model.User, error)
+	GetMutualFriends(user, other int64, limit, offset int, ctx context.Context) (*MutualFriends, error)
+	GetSuggestions(user int64, limit, offset int, ctx context.Context) ([]repository.FriendSuggestion, error)
+	FindPath(user, target int64, maxDepth int, ctx context.Context) (*FriendPath, error)
+
+	BlockUser(user, target int64, ctx context.Context) error
+	UnblockUser(user, target int64, ctx context.Context) error
+	GetBlockedUsers(user int64, ctx context.Context) ([]model.Block, error)
+
+	AcceptFriend(user, requester int64, ctx context.Context) error
+	DeclineFriend(user, requester int64, ctx context.Context) error
+	CancelFriendRequest(user, accepter int64, ctx context.Context) error
+	GetIncomingRequests(user int64, ctx context.Context) ([]model.Friendship, error)
+	GetOutgoingRequests(user int64, ctx context.Context) ([]model.Friendship, error)
 }
 
-func NewFriendService(friendRepo repository.FriendRepository, userRepo repository.UserRepository) FriendServe {
-	return FriendServe{Repo: friendRepo, UserRepo: userRepo}
+// NewFriendService создает сервис дружб. maxPathDepth и pathVisitBudget ограничивают поиск пути
+// между пользователями, нулевые значения заменяются на DefaultPathDepth и DefaultPathVisitBudget.
+func NewFriendService(friendRepo repository.FriendRepository, userRepo repository.UserRepository, maxPathDepth, pathVisitBudget int) FriendshipService {
+	return &FriendServe{Repo: friendRepo, UserRepo: userRepo, MaxPathDepth: maxPathDepth, PathVisitBudget: pathVisitBudget}
 }
 
-func (FS *FriendServe) AddFriend(user, friend int64, ctx context.Context) error {
+// AddFriend отправляет заявку в друзья от user к friend. Если friend уже отправил встречную
+// заявку, она принимается. После отклоненной или отмененной заявки любой из двоих может отправить
+// новую - она заменяет прежнюю запись пары.
+func (FS *FriendServe) AddFriend(user, friend int64, ctx context.Context) (*model.Friendship, error) {
 	if user == friend {
-		return fmt.Errorf("Failed to make a friendship: %w", repository.ErrUserEqualsFriend)
+		return nil, fmt.Errorf("Failed to make a friendship: %w", repository.ErrUserEqualsFriend)
 	}
-	//Даже если оба юзера существуют, для образования дружбы требуется 3 запроса в БД, но зато читаемый код и ошибки.
-	// Можно использовать 1 запрос и обрабатывать ошибку БД - если хочется оптимизации.
-	// нужно добавить проверку существования дружбы
 	if user < 0 || friend < 0 {
-		return fmt.Errorf("invalid ID format")
+		return nil, fmt.Errorf("Failed to make a friendship: invalid ID format: %w", repository.ErrInvalidField)
 	}
-	if err := FS.UserRepo.CheckIfExistsByID(user, ctx); errors.Is(err, repository.ErrUserNotFound) {
-		return fmt.Errorf("Failed to make a friendship: %w", err)
+	//блокировка в любую сторону запрещает заявки
+	blocked, err := FS.Repo.IsBlocked(ctx, user, friend)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to make a friendship: %w", err)
 	}
-	if err := FS.UserRepo.CheckIfExistsByID(friend, ctx); errors.Is(err, repository.ErrUserNotFound) {
-		return fmt.Errorf("Failed to make a friendship: %w", err)
+	if blocked {
+		return nil, fmt.Errorf("Failed to make a friendship: %w", repository.ErrUserBlocked)
 	}
+
+	//встречная заявка: friend уже позвал user в друзья - принимаем ее
+	reverse, err := FS.Repo.GetFriendship(ctx, friend, user)
+	switch {
+	case err == nil && reverse.Status == model.FriendshipPending:
+		if err := FS.Repo.SetFriendshipStatus(ctx, reverse, model.FriendshipPending, model.FriendshipAccepted); err != nil {
+			return nil, fmt.Errorf("Failed to make a friendship: %w", err)
+		}
+		return reverse, nil
+	case err == nil && reverse.Status == model.FriendshipAccepted:
+		return nil, fmt.Errorf("Failed to make a friendship: %w", repository.ErrFriendshipExists)
+	case err == nil:
+		//встречная заявка отклонена или отозвана: у пары одна запись, она становится заявкой от user
+		friendship := &model.Friendship{RequesterID: user, AccepterID: friend}
+		if err := FS.Repo.ReverseFriendRequest(ctx, friendship, reverse.Status); err != nil {
+			return nil, fmt.Errorf("Failed to make a friendship: %w", err)
+		}
+		return friendship, nil
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, fmt.Errorf("Failed to make a friendship: %w", err)
+	}
+
+	existing, err := FS.Repo.GetFriendship(ctx, user, friend)
+	switch {
+	case err == nil && (existing.Status == model.FriendshipDeclined || existing.Status == model.FriendshipCancelled):
+		if err := FS.Repo.SetFriendshipStatus(ctx, existing, existing.Status, model.FriendshipPending); err != nil {
+			return nil, fmt.Errorf("Failed to make a friendship: %w", err)
+		}
+		return existing, nil
+	case err == nil:
+		return nil, fmt.Errorf("Failed to make a friendship: %w", repository.ErrFriendshipExists)
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, fmt.Errorf("Failed to make a friendship: %w", err)
+	}
+
 	friendship := &model.Friendship{
 		RequesterID: user,
 		AccepterID:  friend,
+		Status:      model.FriendshipPending,
 	}
 	if err := FS.Repo.AddFriend(ctx, friendship); err != nil {
-		return fmt.Errorf("Failed to make a friendship: %w", err)
+		return nil, fmt.Errorf("Failed to make a friendship: %w", err)
+	}
+	return friendship, nil
+}
+
+// AcceptFriend - user принимает ожидающую заявку от requester.
+func (FS *FriendServe) AcceptFriend(user, requester int64, ctx context.Context) error {
+	return FS.resolveRequest(requester, user, model.FriendshipAccepted, ctx)
+}
+
+// DeclineFriend - user отклоняет ожидающую заявку от requester.
+func (FS *FriendServe) DeclineFriend(user, requester int64, ctx context.Context) error {
+	return FS.resolveRequest(requester, user, model.FriendshipDeclined, ctx)
+}
+
+// CancelFriendRequest - user отзывает свою ожидающую заявку к accepter.
+func (FS *FriendServe) CancelFriendRequest(user, accepter int64, ctx context.Context) error {
+	return FS.resolveRequest(user, accepter, model.FriendshipCancelled, ctx)
+}
+
+func (FS *FriendServe) resolveRequest(requester, accepter int64, to model.FriendshipStatus, ctx context.Context) error {
+	if requester == accepter {
+		return fmt.Errorf("Failed to update friend request: %w", repository.ErrUserEqualsFriend)
+	}
+	friendship := &model.Friendship{RequesterID: requester, AccepterID: accepter}
+	if err := FS.Repo.SetFriendshipStatus(ctx, friendship, model.FriendshipPending, to); err != nil {
+		return fmt.Errorf("Failed to update friend request: %w", err)
 	}
 	return nil
 }
+
+func (FS *FriendServe) GetIncomingRequests(user int64, ctx context.Context) ([]model.Friendship, error) {
+	if err := FS.UserRepo.CheckIfExistsByID(user, ctx); errors.Is(err, repository.ErrUserNotFound) {
+		return nil, fmt.Errorf("Failed to fetch friend requests: %w", err)
+	}
+	res, err := FS.Repo.GetIncomingRequests(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch friend requests: %w", err)
+	}
+	return res, nil
+}
+
+func (FS *FriendServe) GetOutgoingRequests(user int64, ctx context.Context) ([]model.Friendship, error) {
+	if err := FS.UserRepo.CheckIfExistsByID(user, ctx); errors.Is(err, repository.ErrUserNotFound) {
+		return nil, fmt.Errorf("Failed to fetch friend requests: %w", err)
+	}
+	res, err := FS.Repo.GetOutgoingRequests(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch friend requests: %w", err)
+	}
+	return res, nil
+}
+
 func (FS *FriendServe) RemoveFriend(user, friend int64, ctx context.Context) error {
 	if user == friend {
 		return fmt.Errorf("Failed to remove a friend: %w", repository.ErrUserEqualsFriend)
@@ -57,7 +172,7 @@ func (FS *FriendServe) RemoveFriend(user, friend int64, ctx context.Context) err
 	if err := FS.UserRepo.CheckIfExistsByID(user, ctx); errors.Is(err, repository.ErrUserNotFound) {
 		return fmt.Errorf("Failed to remove a friend: %w", err)
 	}
-	if err := FS.UserRepo.CheckIfExistsByID(friend, ctx); !errors.Is(err, repository.ErrUserNotFound) {
+	if err := FS.UserRepo.CheckIfExistsByID(friend, ctx); errors.Is(err, repository.ErrUserNotFound) {
 		return fmt.Errorf("Failed to remove a friend: %w", err)
 	}
 
@@ -81,3 +196,55 @@ func (FS *FriendServe) GetFriends(user int64, ctx context.Context) ([]model.User
 	}
 	return res, err
 }
+
+func (FS *FriendServe) GetMutualFriends(user, other int64, limit, offset int, ctx context.Context) (*MutualFriends, error) {
+	if user == other {
+		return nil, fmt.Errorf("Failed to fetch mutual friends: %w", repository.ErrUserEqualsFriend)
+	}
+	if limit == 0 {
+		limit = DefaultPageLimit
+	}
+	if limit < 0 || limit > MaxPageLimit || offset < 0 {
+		return nil, fmt.Errorf("Failed to fetch mutual friends: %w", repository.ErrInvalidPagination)
+	}
+	if err := FS.UserRepo.CheckIfExistsByID(user, ctx); errors.Is(err, repository.ErrUserNotFound) {
+		return nil, fmt.Errorf("Failed to fetch mutual friends: %w", err)
+	}
+	if err := FS.UserRepo.CheckIfExistsByID(other, ctx); errors.Is(err, repository.ErrUserNotFound) {
+		return nil, fmt.Errorf("Failed to fetch mutual friends: %w", err)
+	}
+
+	users, count, err := FS.Repo.GetMutualFriends(ctx, user, other, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch mutual friends: %w", err)
+	}
+	//за пределами последней страницы строк нет, и количество не из чего взять - запрашиваем его отдельно
+	if len(users) == 0 && offset > 0 {
+		if _, count, err = FS.Repo.GetMutualFriends(ctx, user, other, 1, 0); err != nil {
+			return nil, fmt.Errorf("Failed to fetch mutual friends: %w", err)
+		}
+	}
+	return &MutualFriends{
+		Users:   users,
+		Count:   count,
+		HasMore: int64(offset+len(users)) < count,
+	}, nil
+}
+
+func (FS *FriendServe) GetSuggestions(user int64, limit, offset int, ctx context.Context) ([]repository.FriendSuggestion, error) {
+	if limit == 0 {
+		limit = DefaultPageLimit
+	}
+	if limit < 0 || limit > MaxPageLimit || offset < 0 {
+		return nil, fmt.Errorf("Failed to fetch friend suggestions: %w", repository.ErrInvalidPagination)
+	}
+	if err := FS.UserRepo.CheckIfExistsByID(user, ctx); errors.Is(err, repository.ErrUserNotFound) {
+		return nil, fmt.Errorf("Failed to fetch friend suggestions: %w", err)
+	}
+
+	suggestions, err := FS.Repo.GetSuggestions(ctx, user, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch friend suggestions: %w", err)
+	}
+	return suggestions, nil
+}
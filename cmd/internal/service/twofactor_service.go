@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultTOTPIssuer = "users-api"
+	totpPeriod        = 30
+	// totpSkew - сколько соседних шагов принимать, чтобы пережить расхождение часов клиента
+	totpSkew          = 1
+	recoveryCodeCount = 10
+)
+
+var totpOpts = totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+
+// TwoFactorServe реализует TOTP (RFC 6238). Now - источник времени, в тестах подставляются фиксированные часы.
+type TwoFactorServe struct {
+	Users  repository.UserRepository
+	Repo   repository.TwoFactorRepository
+	Issuer string
+	Now    func() time.Time
+}
+
+// TOTPSetup - данные для добавления аккаунта в приложение-аутентификатор.
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// RecoveryCodes - одноразовые коды восстановления, показываются только при включении 2FA.
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// SecondFactor - код из приложения или код восстановления. Достаточно одного из них.
+type SecondFactor struct {
+	Code         string `json:"otp_code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+type TwoFactorService interface {
+	SetupTOTP(userID int64, ctx context.Context) (*TOTPSetup, error)
+	EnableTOTP(userID int64, code string, ctx context.Context) (*RecoveryCodes, error)
+	DisableTOTP(userID int64, factor SecondFactor, ctx context.Context) error
+	VerifySecondFactor(user *model.User, factor SecondFactor, ctx context.Context) error
+}
+
+// NewTwoFactorService создает сервис 2FA. Пустой issuer заменяется на DefaultTOTPIssuer.
+func NewTwoFactorService(users repository.UserRepository, repo repository.TwoFactorRepository, issuer string) TwoFactorService {
+	if issuer == "" {
+		issuer = DefaultTOTPIssuer
+	}
+	return &TwoFactorServe{Users: users, Repo: repo, Issuer: issuer, Now: time.Now}
+}
+
+// SetupTOTP выпускает новый секрет. 2FA включится только после подтверждения кодом в EnableTOTP.
+func (TS *TwoFactorServe) SetupTOTP(userID int64, ctx context.Context) (*TOTPSetup, error) {
+	user, err := TS.getUser(userID, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set up two-factor authentication: %w", err)
+	}
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("Failed to set up two-factor authentication: %w", repository.ErrTOTPAlreadyEnabled)
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      TS.Issuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      totpOpts.Digits,
+		Algorithm:   totpOpts.Algorithm,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set up two-factor authentication: %w", err)
+	}
+	if err := TS.Repo.SetTOTPSecret(ctx, userID, key.Secret()); err != nil {
+		return nil, fmt.Errorf("Failed to set up two-factor authentication: %w", err)
+	}
+	return &TOTPSetup{Secret: key.Secret(), URI: key.URL()}, nil
+}
+
+// EnableTOTP подтверждает настройку первым кодом из приложения и выдает коды восстановления.
+func (TS *TwoFactorServe) EnableTOTP(userID int64, code string, ctx context.Context) (*RecoveryCodes, error) {
+	user, err := TS.getUser(userID, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to enable two-factor authentication: %w", err)
+	}
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("Failed to enable two-factor authentication: %w", repository.ErrTOTPAlreadyEnabled)
+	}
+	if user.TOTPSecret == "" {
+		return nil, fmt.Errorf("Failed to enable two-factor authentication: %w", repository.ErrTOTPNotEnrolled)
+	}
+	step, ok := TS.matchStep(user.TOTPSecret, code)
+	if !ok {
+		return nil, fmt.Errorf("Failed to enable two-factor authentication: %w", repository.ErrInvalidOTP)
+	}
+
+	plain := make([]string, recoveryCodeCount)
+	codes := make([]model.RecoveryCode, recoveryCodeCount)
+	for i := range plain {
+		raw := randomHex(5)
+		plain[i] = raw[:5] + "-" + raw[5:]
+		codes[i] = model.RecoveryCode{UserID: userID, CodeHash: hashToken(raw)}
+	}
+	if err := TS.Repo.EnableTOTP(ctx, userID, step, codes); err != nil {
+		return nil, fmt.Errorf("Failed to enable two-factor authentication: %w", err)
+	}
+	return &RecoveryCodes{Codes: plain}, nil
+}
+
+// DisableTOTP выключает 2FA. Требует действующий второй фактор, чтобы украденный access-токен не позволил ее снять.
+func (TS *TwoFactorServe) DisableTOTP(userID int64, factor SecondFactor, ctx context.Context) error {
+	user, err := TS.getUser(userID, ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to disable two-factor authentication: %w", err)
+	}
+	if !user.TOTPEnabled {
+		return fmt.Errorf("Failed to disable two-factor authentication: %w", repository.ErrTOTPNotEnrolled)
+	}
+	if err := TS.VerifySecondFactor(user, factor, ctx); err != nil {
+		return fmt.Errorf("Failed to disable two-factor authentication: %w", err)
+	}
+	if err := TS.Repo.DisableTOTP(ctx, userID); err != nil {
+		return fmt.Errorf("Failed to disable two-factor authentication: %w", err)
+	}
+	return nil
+}
+
+// VerifySecondFactor проверяет код из приложения или погашает код восстановления.
+// Для пользователей без 2FA ничего не проверяет.
+func (TS *TwoFactorServe) VerifySecondFactor(user *model.User, factor SecondFactor, ctx context.Context) error {
+	if !user.TOTPEnabled {
+		return nil
+	}
+	switch {
+	case factor.Code != "":
+		step, ok := TS.matchStep(user.TOTPSecret, factor.Code)
+		if !ok {
+			return repository.ErrInvalidOTP
+		}
+		return TS.Repo.AdvanceTOTPStep(ctx, user.ID, step)
+	case factor.RecoveryCode != "":
+		raw := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(factor.RecoveryCode), "-", ""))
+		return TS.Repo.UseRecoveryCode(ctx, user.ID, hashToken(raw), TS.now())
+	default:
+		return repository.ErrOTPRequired
+	}
+}
+
+// matchStep ищет временной шаг, для которого code верен, в пределах totpSkew от текущего.
+func (TS *TwoFactorServe) matchStep(secret, code string) (int64, bool) {
+	now := TS.now()
+	for skew := -totpSkew; skew <= totpSkew; skew++ {
+		at := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(secret, at, totpOpts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return at.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+func (TS *TwoFactorServe) now() time.Time {
+	if TS.Now == nil {
+		return time.Now()
+	}
+	return TS.Now()
+}
+
+func (TS *TwoFactorServe) getUser(userID int64, ctx context.Context) (*model.User, error) {
+	user, err := TS.Users.GetUserByID(userID, ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	"github.com/pquerna/otp/totp"
+)
+
+// rfc6238Secret - ASCII-секрет "12345678901234567890" из приложения B RFC 6238 в base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// fixedNow - часы тестов: середина временного шага, чтобы соседние шаги были ровно в ±30 секундах
+var fixedNow = time.Unix(1_699_999_995, 0)
+
+// newTwoFactorTest создает сервис 2FA на хранилище в памяти с фиксированными часами и пользователя
+func newTwoFactorTest(t *testing.T) (*TwoFactorServe, *model.User) {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	users := repository.NewMemoryUserRepository(store)
+	user := &model.User{Name: "Ann", Surname: "Lee", Email: "ann@example.com"}
+	if err := users.CreateUser(user, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ts := NewTwoFactorService(users, repository.NewMemoryTwoFactorRepository(store), "").(*TwoFactorServe)
+	ts.Now = func() time.Time { return fixedNow }
+	return ts, user
+}
+
+// enableTOTP настраивает и включает 2FA пользователю, возвращает секрет и коды восстановления
+func enableTOTP(t *testing.T, ts *TwoFactorServe, userID int64) (string, []string) {
+	t.Helper()
+	ctx := context.Background()
+	setup, err := ts.SetupTOTP(userID, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//первый код взят из предыдущего шага, чтобы текущий оставался непредъявленным
+	code, err := totp.GenerateCodeCustom(setup.Secret, fixedNow.Add(-totpPeriod*time.Second), totpOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovery, err := ts.EnableTOTP(userID, code, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return setup.Secret, recovery.Codes
+}
+
+// loadUser перечитывает пользователя с текущими настройками 2FA
+func loadUser(t *testing.T, ts *TwoFactorServe, userID int64) *model.User {
+	t.Helper()
+	user, err := ts.Users.GetUserByID(userID, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestMatchStepRFC6238Vectors(t *testing.T) {
+	//коды SHA1 из приложения B RFC 6238, последние 6 цифр 8-значных значений
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		at := time.Unix(v.unix, 0)
+		code, err := totp.GenerateCodeCustom(rfc6238Secret, at, totpOpts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("code at %d = %s, want %s", v.unix, code, v.code)
+		}
+		ts := &TwoFactorServe{Now: func() time.Time { return at }}
+		step, ok := ts.matchStep(rfc6238Secret, v.code)
+		if !ok || step != v.unix/totpPeriod {
+			t.Errorf("matchStep at %d = %d, %v, want step %d", v.unix, step, ok, v.unix/totpPeriod)
+		}
+	}
+}
+
+func TestMatchStepWindow(t *testing.T) {
+	ts := &TwoFactorServe{Now: func() time.Time { return fixedNow }}
+	current := fixedNow.Unix() / totpPeriod
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"two steps behind", -2, false},
+		{"previous step", -1, true},
+		{"current step", 0, true},
+		{"next step", 1, true},
+		{"two steps ahead", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := totp.GenerateCodeCustom(rfc6238Secret, fixedNow.Add(time.Duration(tt.offset*totpPeriod)*time.Second), totpOpts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			step, ok := ts.matchStep(rfc6238Secret, code)
+			if ok != tt.ok {
+				t.Fatalf("matchStep accepted = %v, want %v", ok, tt.ok)
+			}
+			if ok && step != current+tt.offset {
+				t.Fatalf("matchStep step = %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestVerifySecondFactorRejectsReplayedCode(t *testing.T) {
+	ts, user := newTwoFactorTest(t)
+	secret, _ := enableTOTP(t, ts, user.ID)
+	ctx := context.Background()
+
+	code, err := totp.GenerateCodeCustom(secret, fixedNow, totpOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.VerifySecondFactor(loadUser(t, ts, user.ID), SecondFactor{Code: code}, ctx); err != nil {
+		t.Fatalf("first use of a code: %v", err)
+	}
+	err = ts.VerifySecondFactor(loadUser(t, ts, user.ID), SecondFactor{Code: code}, ctx)
+	if !errors.Is(err, repository.ErrInvalidOTP) {
+		t.Fatalf("replayed code: got %v, want ErrInvalidOTP", err)
+	}
+	//код шага, предшествующего уже принятому, тоже отклоняется, хотя попадает в окно
+	previous, _ := totp.GenerateCodeCustom(secret, fixedNow.Add(-totpPeriod*time.Second), totpOpts)
+	err = ts.VerifySecondFactor(loadUser(t, ts, user.ID), SecondFactor{Code: previous}, ctx)
+	if !errors.Is(err, repository.ErrInvalidOTP) {
+		t.Fatalf("code of an earlier step: got %v, want ErrInvalidOTP", err)
+	}
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	ts, user := newTwoFactorTest(t)
+	_, codes := enableTOTP(t, ts, user.ID)
+	ctx := context.Background()
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+
+	enabled := loadUser(t, ts, user.ID)
+	if err := ts.VerifySecondFactor(enabled, SecondFactor{RecoveryCode: codes[0]}, ctx); err != nil {
+		t.Fatalf("first use of a recovery code: %v", err)
+	}
+	err := ts.VerifySecondFactor(enabled, SecondFactor{RecoveryCode: codes[0]}, ctx)
+	if !errors.Is(err, repository.ErrInvalidOTP) {
+		t.Fatalf("second use of a recovery code: got %v, want ErrInvalidOTP", err)
+	}
+	//код вводится без учета регистра и дефиса
+	typed := strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))
+	if err := ts.VerifySecondFactor(enabled, SecondFactor{RecoveryCode: typed}, ctx); err != nil {
+		t.Fatalf("recovery code typed without a dash: %v", err)
+	}
+	err = ts.VerifySecondFactor(enabled, SecondFactor{RecoveryCode: "00000-00000"}, ctx)
+	if !errors.Is(err, repository.ErrInvalidOTP) {
+		t.Fatalf("unknown recovery code: got %v, want ErrInvalidOTP", err)
+	}
+
+	//после выключения и повторного включения 2FA старые коды больше не действуют
+	if err := ts.DisableTOTP(user.ID, SecondFactor{RecoveryCode: codes[2]}, ctx); err != nil {
+		t.Fatalf("DisableTOTP: %v", err)
+	}
+	_, fresh := enableTOTP(t, ts, user.ID)
+	err = ts.VerifySecondFactor(loadUser(t, ts, user.ID), SecondFactor{RecoveryCode: codes[3]}, ctx)
+	if !errors.Is(err, repository.ErrInvalidOTP) {
+		t.Fatalf("recovery code from a previous enrollment: got %v, want ErrInvalidOTP", err)
+	}
+	if err := ts.VerifySecondFactor(loadUser(t, ts, user.ID), SecondFactor{RecoveryCode: fresh[0]}, ctx); err != nil {
+		t.Fatalf("recovery code from the new enrollment: %v", err)
+	}
+}
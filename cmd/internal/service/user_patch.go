@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// PatchFormat - формат документа изменений для PatchUser
+type PatchFormat int
+
+const (
+	// MergePatch - JSON Merge Patch (RFC 7396): объект с новыми значениями полей, null удаляет поле
+	MergePatch PatchFormat = iota
+	// JSONPatch - JSON Patch (RFC 6902): список операций add, remove, replace, move, copy и test
+	JSONPatch
+)
+
+// patchableUserFields - поля пользователя, которые можно менять через PatchUser. Остальные поля
+// представления доступны только для чтения: их можно проверить операцией test, но не изменить.
+var patchableUserFields = []string{"name", "surname", "email"}
+
+// PatchUser применяет документ изменений patch к JSON-представлению пользователя id (тому же, что
+// отдает GET /users/{id}), проверяет результат и сохраняет его. Удаление поля равносильно его очистке,
+// поэтому обязательные поля удалить нельзя. Версия проверяется так же, как в UpdateUser.
+func (US *UserServe) PatchUser(id int64, format PatchFormat, patch []byte, ifMatch IfMatch, ctx context.Context) (*model.User, error) {
+	var apply func(doc []byte) ([]byte, error)
+	switch format {
+	case MergePatch:
+		if !json.Valid(patch) {
+			return nil, fmt.Errorf("Failed to patch user: %w: merge patch is not valid JSON", repository.ErrInvalidPatch)
+		}
+		apply = func(doc []byte) ([]byte, error) {
+			return jsonpatch.MergePatch(doc, patch)
+		}
+	case JSONPatch:
+		ops, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to patch user: %w: %v", repository.ErrInvalidPatch, err)
+		}
+		apply = ops.Apply
+	default:
+		return nil, fmt.Errorf("Failed to patch user: %w: unknown patch format", repository.ErrInvalidPatch)
+	}
+
+	user, err := US.updateUser(id, ifMatch, ctx, func(dbUser *model.User) (bool, error) {
+		doc, err := json.Marshal(dbUser)
+		if err != nil {
+			return false, err
+		}
+		patched, err := apply(doc)
+		if err != nil {
+			if errors.Is(err, jsonpatch.ErrTestFailed) {
+				return false, fmt.Errorf("%w: %v", repository.ErrPatchTestFailed, err)
+			}
+			return false, fmt.Errorf("%w: %v", repository.ErrPatchNotApplicable, err)
+		}
+		fields, err := patchedUserFields(doc, patched)
+		if err != nil {
+			return false, err
+		}
+		email, err := normalizeEmail(fields["email"])
+		if err != nil {
+			return false, err
+		}
+		dbUser.Name = fields["name"]
+		dbUser.Surname = fields["surname"]
+		return setEmail(dbUser, email), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to patch user: %w", err)
+	}
+	return user, nil
+}
+
+// patchedUserFields проверяет представление пользователя после патча: изменяемые поля должны быть
+// непустыми строками, остальные поля - совпадать с исходным представлением before.
+// Возвращает новые значения изменяемых полей.
+func patchedUserFields(before, after []byte) (map[string]string, error) {
+	var original, patched map[string]any
+	if err := json.Unmarshal(before, &original); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(after, &patched); err != nil {
+		return nil, fmt.Errorf("%w: patched user is not a JSON object", repository.ErrPatchNotApplicable)
+	}
+
+	var errs []error
+	fields := make(map[string]string, len(patchableUserFields))
+	for _, name := range patchableUserFields {
+		switch v := patched[name].(type) {
+		case string:
+			fields[name] = v
+		case nil:
+			//удаленное поле - то же, что пустое, его отклонит requireFields
+			fields[name] = ""
+		default:
+			errs = append(errs, &repository.FieldError{Field: name, Message: "must be a string"})
+			fields[name] = fmt.Sprint(v)
+		}
+	}
+	keys := make([]string, 0, len(original)+len(patched))
+	for key := range original {
+		keys = append(keys, key)
+	}
+	for key := range patched {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range slices.Compact(keys) {
+		if slices.Contains(patchableUserFields, key) {
+			continue
+		}
+		was, known := original[key]
+		now, kept := patched[key]
+		switch {
+		case !known:
+			errs = append(errs, &repository.FieldError{Field: key, Message: "unknown field"})
+		case !kept || !reflect.DeepEqual(was, now):
+			errs = append(errs, &repository.FieldError{Field: key, Message: "is read-only"})
+		}
+	}
+	if err := requireFields(fields); err != nil {
+		errs = append(errs, err)
+	}
+	return fields, errors.Join(errs...)
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/UnendingLoop/users-api/cmd/internal/model"
 	"github.com/UnendingLoop/users-api/cmd/internal/repository"
@@ -13,38 +17,97 @@ import (
 // UserServe
 type UserServe struct {
 	Repo repository.UserRepository
+	// Email отправляет письмо подтверждения на новый email; nil - письма не отправляются
+	Email EmailService
 }
 
+// ListUsersParams - параметры запроса страницы пользователей.
+// Cursor и Offset взаимоисключающие: курсор берется из NextCursor предыдущей страницы.
+// Sort - список полей через запятую, минус перед полем означает обратный порядок: "-surname,name".
+type ListUsersParams struct {
+	Filter    repository.UserFilter
+	Sort      string
+	Limit     int
+	Offset    int
+	Cursor    string
+	WithTotal bool
+}
+
+// UserPage - страница списка пользователей.
+type UserPage struct {
+	Users      []model.User `json:"users"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+	HasMore    bool         `json:"has_more"`
+	Total      *int64       `json:"total,omitempty"`
+}
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// IfMatch - версии пользователя из заголовка If-Match, при которых разрешено изменение.
+// nil - условия нет (заголовок не передан или равен "*"), пустой список не подходит ни к одной версии.
+type IfMatch []int64
+
+func (m IfMatch) allows(version int64) bool {
+	return m == nil || slices.Contains(m, version)
+}
+
+// maxUpdateAttempts - сколько раз UpdateUser перечитывает пользователя и заново применяет изменения,
+// если запись одновременно изменил другой запрос
+const maxUpdateAttempts = 3
+
 type UserService interface {
 	CreateUser(user *model.User, ctx context.Context) error
 	GetUserByID(id int64, ctx context.Context) (*model.User, error)
-	ListUsers(ctx context.Context) ([]model.User, error)
-	DeleteUser(id int64, ctx context.Context) error
-	UpdateUser(user *model.User, ctx context.Context) error
+	ListUsers(params ListUsersParams, ctx context.Context) (*UserPage, error)
+	SearchUsers(query string, limit int, ctx context.Context) ([]repository.UserSearchHit, error)
+	DeleteUser(id int64, ifMatch IfMatch, ctx context.Context) error
+	RestoreUser(id int64, ctx context.Context) error
+	PurgeDeletedUsers(retention time.Duration, ctx context.Context) (int64, error)
+	UpdateUser(user *model.User, ifMatch IfMatch, ctx context.Context) error
+	PatchUser(id int64, format PatchFormat, patch []byte, ifMatch IfMatch, ctx context.Context) (*model.User, error)
 }
 
-func NewUserService(userRepo repository.UserRepository) UserServe {
-	return UserServe{Repo: userRepo}
+// NewUserService создает сервис пользователей. email отправляет письма подтверждения, может быть nil.
+func NewUserService(userRepo repository.UserRepository, email EmailService) UserService {
+	return &UserServe{Repo: userRepo, Email: email}
 }
 
 func (US *UserServe) CreateUser(user *model.User, ctx context.Context) error {
 	//валидация входных данных - перенесено из хендлера
-	if user.Name == "" || user.Surname == "" || user.Email == "" {
-		return fmt.Errorf("Failed to create a new user: %w", repository.ErrEmptySomeFields)
+	if err := requireFields(map[string]string{"name": user.Name, "surname": user.Surname, "email": user.Email}); err != nil {
+		return fmt.Errorf("Failed to create a new user: %w", err)
 	}
-	if err := US.Repo.CheckIfExistsByEmail(user.Email, ctx); !errors.Is(err, repository.ErrEmailNotFound) {
+	email, err := normalizeEmail(user.Email)
+	if err != nil {
 		return fmt.Errorf("Failed to create a new user: %w", err)
 	}
-	return US.Repo.CreateUser(user, ctx)
+	user.Email = email
+	switch user.Role {
+	case "":
+		user.Role = model.RoleUser
+	case model.RoleUser, model.RoleAdmin:
+	default:
+		return fmt.Errorf("Failed to create a new user: %w",
+			&repository.FieldError{Field: "role", Message: "must be one of: user, admin", Err: repository.ErrInvalidRole})
+	}
+	//email приходит от клиента и не подтвержден, пока пользователь не пройдет по ссылке из письма
+	user.EmailVerifiedAt = nil
+	//id, версию и состояние 2FA назначает сервер, значения от клиента не сохраняются
+	user.ID, user.Version, user.UpdatedAt = 0, 1, time.Time{}
+	user.TOTPSecret, user.TOTPEnabled, user.TOTPLastStep = "", false, 0
+	if err := US.Repo.CreateUser(user, ctx); err != nil {
+		return fmt.Errorf("Failed to create a new user: %w", err)
+	}
+	notifyNewEmail(US.Email, user, ctx)
+	return nil
 }
 func (US *UserServe) GetUserByID(id int64, ctx context.Context) (*model.User, error) {
 	if id < 0 {
-		return nil, fmt.Errorf("Failed to get user info: invalid ID format")
-	}
-	if err := US.Repo.CheckIfExistsByID(id, ctx); !errors.Is(err, repository.ErrUserExists) {
-		return nil, fmt.Errorf("Failed to get user info: %w", err)
+		return nil, fmt.Errorf("Failed to get user info: invalid ID format: %w", repository.ErrInvalidField)
 	}
-
 	user, err := US.Repo.GetUserByID(id, ctx)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -54,50 +117,247 @@ func (US *UserServe) GetUserByID(id int64, ctx context.Context) (*model.User, er
 	}
 	return user, nil
 }
-func (US *UserServe) ListUsers(ctx context.Context) ([]model.User, error) {
-	users, err := US.Repo.ListUsers(ctx)
+func (US *UserServe) ListUsers(params ListUsersParams, ctx context.Context) (*UserPage, error) {
+	if params.Limit == 0 {
+		params.Limit = DefaultPageLimit
+	}
+	if params.Limit < 0 || params.Limit > MaxPageLimit || params.Offset < 0 {
+		return nil, fmt.Errorf("Failed to fetch users list: %w", repository.ErrInvalidPagination)
+	}
+	if params.Cursor != "" && params.Offset > 0 {
+		return nil, fmt.Errorf("Failed to fetch users list: %w", repository.ErrInvalidPagination)
+	}
+
+	sort, err := parseSort(params.Sort)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to fetch users list: %w", err)
 	}
-	return users, nil
+
+	//запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	query := repository.ListUsersQuery{Filter: params.Filter, Sort: sort, Limit: params.Limit + 1, Offset: params.Offset}
+	if params.Cursor != "" {
+		if query.After, err = decodeCursor(params.Cursor, sort); err != nil {
+			return nil, fmt.Errorf("Failed to fetch users list: %w", err)
+		}
+	}
+
+	users, err := US.Repo.ListUsers(query, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch users list: %w", err)
+	}
+
+	page := &UserPage{Users: users}
+	if len(users) > params.Limit {
+		page.Users = users[:params.Limit]
+		page.HasMore = true
+		page.NextCursor = encodeCursor(sort, page.Users[len(page.Users)-1])
+	}
+	if page.Users == nil {
+		page.Users = []model.User{}
+	}
+
+	if params.WithTotal {
+		total, err := US.Repo.CountUsers(params.Filter, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to count users: %w", err)
+		}
+		page.Total = &total
+	}
+	return page, nil
+}
+func (US *UserServe) SearchUsers(query string, limit int, ctx context.Context) ([]repository.UserSearchHit, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("Failed to search users: %w", repository.ErrEmptySearchQuery)
+	}
+	if limit == 0 {
+		limit = DefaultPageLimit
+	}
+	if limit < 0 || limit > MaxPageLimit {
+		return nil, fmt.Errorf("Failed to search users: %w", repository.ErrInvalidPagination)
+	}
+	hits, err := US.Repo.SearchUsers(query, limit, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to search users: %w", err)
+	}
+	if hits == nil {
+		hits = []repository.UserSearchHit{}
+	}
+	return hits, nil
+}
+
+// parseSort разбирает строку сортировки вида "-surname,name". Допустимость полей
+// проверяется по белому списку репозитория.
+func parseSort(sort string) ([]repository.SortField, error) {
+	if sort == "" {
+		return nil, nil
+	}
+	var fields []repository.SortField
+	for _, part := range strings.Split(sort, ",") {
+		field := repository.SortField{Field: strings.TrimSpace(part)}
+		if name, ok := strings.CutPrefix(field.Field, "-"); ok {
+			field = repository.SortField{Field: name, Desc: true}
+		}
+		if _, ok := repository.SortableUserFields[field.Field]; !ok {
+			return nil, fmt.Errorf("%w: %q", repository.ErrInvalidSort, field.Field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func formatSort(sort []repository.SortField) string {
+	parts := make([]string, 0, len(sort))
+	for _, field := range sort {
+		if field.Desc {
+			parts = append(parts, "-"+field.Field)
+		} else {
+			parts = append(parts, field.Field)
+		}
+	}
+	return strings.Join(parts, ",")
 }
-func (US *UserServe) DeleteUser(id int64, ctx context.Context) error {
-	count, err := US.Repo.DeleteUser(id, ctx)
-	if count == 0 && err == nil {
+
+// DeleteUser мягко удаляет пользователя. С условием ifMatch удаление проходит, только если
+// текущая версия пользователя в нем есть и не меняется до самого удаления.
+func (US *UserServe) DeleteUser(id int64, ifMatch IfMatch, ctx context.Context) error {
+	var version int64
+	if ifMatch != nil {
+		dbUser, err := US.Repo.GetUserByID(id, ctx)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("Failed to remove user: %w", repository.ErrUserNotFound)
+			}
+			return fmt.Errorf("Failed to remove user: %w", err)
+		}
+		if !ifMatch.allows(dbUser.Version) {
+			return fmt.Errorf("Failed to remove user: %w", repository.ErrVersionMismatch)
+		}
+		version = dbUser.Version
+	}
+	count, err := US.Repo.DeleteUser(id, version, ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to remove user: %w", err)
+	}
+	if count == 0 {
 		return fmt.Errorf("Failed to remove user: %w", repository.ErrUserNotFound)
 	}
-	return err
+	return nil
 }
-func (US *UserServe) UpdateUser(user *model.User, ctx context.Context) error {
-	//проверка на ненулевой input
-	if user.Email == "" && user.Name == "" && user.Surname == "" {
-		return fmt.Errorf("Failed to update user info: %w", repository.ErrEmptyFields)
+func (US *UserServe) RestoreUser(id int64, ctx context.Context) error {
+	if err := US.Repo.RestoreUser(id, ctx); err != nil {
+		return fmt.Errorf("Failed to restore user: %w", err)
 	}
-	//загрузить из базы юзера с этим id - сразу проверить существует ли такой юзер
-	dbUser, err := US.Repo.GetUserByID(user.ID, ctx)
+	return nil
+}
+
+// PurgeDeletedUsers окончательно удаляет пользователей, мягко удаленных больше retention назад.
+func (US *UserServe) PurgeDeletedUsers(retention time.Duration, ctx context.Context) (int64, error) {
+	purged, err := US.Repo.PurgeDeletedUsers(time.Now().Add(-retention), ctx)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fmt.Errorf("Failed to update user info: %w", repository.ErrUserNotFound)
-		}
-		return err
+		return 0, fmt.Errorf("Failed to purge deleted users: %w", err)
 	}
+	return purged, nil
+}
 
-	//скопировать ненулевые поля из user в dbUser,в будущем можно добавить нормализацию регистра
-	if user.Name != "" {
-		dbUser.Name = user.Name
+// RunPurge раз в interval запускает очистку мягко удаленных пользователей сервисом users, пока не отменен ctx.
+func RunPurge(ctx context.Context, users UserService, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := users.PurgeDeletedUsers(retention, ctx)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("Purged %d deleted users", purged)
+			}
+		}
 	}
-	if user.Surname != "" {
-		dbUser.Surname = user.Surname
+}
+
+// UpdateUser применяет к пользователю непустые поля user и записывает результат обратно в user.
+// Запись условная: если пользователя одновременно изменили, изменения применяются к свежей версии
+// заново, а при заданном ifMatch неподходящая версия дает ErrVersionMismatch.
+func (US *UserServe) UpdateUser(user *model.User, ifMatch IfMatch, ctx context.Context) error {
+	//проверка на ненулевой input
+	if user.Email == "" && user.Name == "" && user.Surname == "" {
+		return fmt.Errorf("Failed to update user info: %w", repository.ErrEmptyFields)
 	}
+	email := ""
 	if user.Email != "" {
-		if err := US.Repo.CheckIfExistsByEmail(user.Email, ctx); errors.Is(err, repository.ErrEmailNotFound) {
-			dbUser.Email = user.Email
-		} else {
+		var err error
+		if email, err = normalizeEmail(user.Email); err != nil {
 			return fmt.Errorf("Failed to update user info: %w", err)
 		}
 	}
-	if err := US.Repo.UpdateUser(dbUser, ctx); err != nil {
+	updated, err := US.updateUser(user.ID, ifMatch, ctx, func(dbUser *model.User) (bool, error) {
+		//скопировать ненулевые поля из user в dbUser
+		if user.Name != "" {
+			dbUser.Name = user.Name
+		}
+		if user.Surname != "" {
+			dbUser.Surname = user.Surname
+		}
+		return email != "" && setEmail(dbUser, email), nil
+	})
+	if err != nil {
 		return fmt.Errorf("Failed to update user info: %w", err)
 	}
+	*user = *updated
 	return nil
 }
+
+// updateUser читает пользователя id, применяет к нему change и сохраняет с проверкой версии.
+// change возвращает true, если сменился email и его нужно подтвердить заново. Если пользователя
+// одновременно изменили, change применяется к свежей версии еще раз, до maxUpdateAttempts попыток.
+func (US *UserServe) updateUser(id int64, ifMatch IfMatch, ctx context.Context, change func(dbUser *model.User) (bool, error)) (*model.User, error) {
+	for attempt := 1; ; attempt++ {
+		//загрузить из базы юзера с этим id - сразу проверить существует ли такой юзер
+		dbUser, err := US.Repo.GetUserByID(id, ctx)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, repository.ErrUserNotFound
+			}
+			return nil, err
+		}
+		if !ifMatch.allows(dbUser.Version) {
+			return nil, repository.ErrVersionMismatch
+		}
+		emailChanged, err := change(dbUser)
+		if err != nil {
+			return nil, err
+		}
+		err = US.Repo.UpdateUser(dbUser, ctx)
+		if errors.Is(err, repository.ErrVersionMismatch) && attempt < maxUpdateAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if emailChanged {
+			notifyNewEmail(US.Email, dbUser, ctx)
+		}
+		return dbUser, nil
+	}
+}
+
+// setEmail меняет email пользователя на уже нормализованный адрес.
+// Возвращает true, если это другой адрес и его нужно подтвердить заново.
+func setEmail(dbUser *model.User, email string) bool {
+	switch {
+	case email == dbUser.Email:
+	case strings.EqualFold(email, dbUser.Email):
+		//тот же адрес в другом регистре - подтверждение остается в силе
+		dbUser.Email = email
+	default:
+		dbUser.Email = email
+		dbUser.EmailVerifiedAt = nil
+		return true
+	}
+	return false
+}
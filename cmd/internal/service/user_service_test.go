@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/model"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+)
+
+func TestCreateUserAssignsServerFields(t *testing.T) {
+	ctx := context.Background()
+	users := repository.NewMemoryUserRepository(repository.NewMemoryStore())
+	svc := NewUserService(users, nil)
+	existing := &model.User{Name: "Ann", Surname: "Lee", Email: "ann@example.com"}
+	if err := svc.CreateUser(existing, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	//клиент пытается занять чужой id, задать версию и включить 2FA без секрета
+	user := &model.User{Name: "Bob", Surname: "Ray", Email: "bob@example.com",
+		ID: existing.ID, Version: 77, TOTPEnabled: true, TOTPLastStep: 5}
+	if err := svc.CreateUser(user, ctx); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	stored, err := users.GetUserByID(user.ID, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ID == existing.ID || stored.Version != 1 || stored.TOTPEnabled || stored.TOTPLastStep != 0 {
+		t.Fatalf("CreateUser must ignore client id, version and 2FA state, got %+v", stored)
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/UnendingLoop/users-api/cmd/internal/mail"
+	"github.com/UnendingLoop/users-api/cmd/internal/repository"
+)
+
+// requireFields возвращает по FieldError на каждое пустое поле из fields (имя поля в JSON -> значение)
+// или nil, если все заполнены. Все ошибки оборачивают ErrEmptySomeFields.
+func requireFields(fields map[string]string) error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		if fields[name] == "" {
+			errs = append(errs, &repository.FieldError{Field: name, Message: "must not be empty", Err: repository.ErrEmptySomeFields})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkPassword проверяет минимальную длину пароля
+func checkPassword(password string) error {
+	if len(password) < minPasswordLength {
+		return &repository.FieldError{
+			Field:   "password",
+			Message: fmt.Sprintf("must be at least %d characters long", minPasswordLength),
+			Err:     repository.ErrWeakPassword,
+		}
+	}
+	return nil
+}
+
+// normalizeEmail проверяет синтаксис email из запроса и приводит его к каноническому виду.
+// Ошибка - FieldError для поля email.
+func normalizeEmail(raw string) (string, error) {
+	email, err := mail.NormalizeAddress(raw)
+	if err != nil {
+		return "", &repository.FieldError{Field: "email", Message: err.Error(), Err: err}
+	}
+	return email, nil
+}
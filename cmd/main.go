@@ -1,19 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
 
+	"github.com/UnendingLoop/users-api/cmd/internal/app"
 	"github.com/UnendingLoop/users-api/cmd/internal/config"
-	"github.com/UnendingLoop/users-api/cmd/internal/handler"
+	"github.com/UnendingLoop/users-api/cmd/internal/migrations"
 	"github.com/UnendingLoop/users-api/cmd/internal/repository"
-	"github.com/UnendingLoop/users-api/cmd/internal/service"
-	_ "github.com/UnendingLoop/users-api/docs"
-	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
-	httpSwagger "github.com/swaggo/http-swagger"
+	"gorm.io/gorm"
 )
 
 // @title Users API
@@ -21,41 +23,126 @@ import (
 // @description REST API для управления пользователями и друзьями
 // @host localhost:8080
 // @BasePath /
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Access-токен в виде "Bearer <token>", выдается /auth/login
+
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name Authorization
+// @description API-ключ сервиса в виде "ApiKey <key>", выпускается администратором через /api_keys
 func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("Warning: .env file not found")
 	}
 
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		log.Fatal("DATABASE_URL is not set in env")
+	storage, driver := config.LoadStorage()
+	var migrator *migrations.Migrator
+	if storage.DB != nil {
+		var err error
+		if migrator, err = migrations.New(storage.DB); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if migrator == nil {
+			log.Fatal("migrate: this DB_DRIVER has no SQL schema to migrate")
+		}
+		runMigrate(migrator, os.Args[2:])
+		return
 	}
-	db := config.ConnectPostgres(dsn)
-
-	userRepo := repository.NewGormUserRepository(db)
-	userService := service.NewUserService(userRepo)
-	userHandler := handler.UserHandler{Repo: userService}
-
-	friendRepo := repository.NewGormFriendRepository(db)
-	friendService := service.NewFriendService(friendRepo, userRepo)
-	friendHandler := handler.FriendHandler{Repo: friendService}
-
-	r := chi.NewRouter()
-
-	r.Get("/users", userHandler.ListUsers)
-	r.Get("/users/{id}", userHandler.GetUserByID)
-	r.Post("/users", userHandler.CreateUser)
-	r.Delete("/delete/{id}", userHandler.DeleteUser)
-	r.Put("/update/{id}", userHandler.UpdateUser)
-
-	r.Post("/users/{id1}/make_friend/{id2}", friendHandler.MakeFriend)
-	r.Get("/users/{id}/friends", friendHandler.GetFriendsList)
-	r.Delete("/users/{id1}/remove_friend/{id2}", friendHandler.RemoveFriend)
 
-	r.Get("/swagger/*", httpSwagger.WrapHandler)
+	cfg := app.LoadConfig()
+	if migrator != nil {
+		prepareSchema(migrator, storage.DB, driver.Ephemeral || cfg.MigrateOnStart)
+	}
+	a := app.New(storage, cfg)
+	go a.RunPurge(context.Background())
 
 	fmt.Println("Server running on http://localhost:8080")
-	if err := http.ListenAndServe(":8080", r); err != nil {
+	if err := http.ListenAndServe(":8080", a.Routes()); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// prepareSchema не дает запустить сервер на базе с непримененными миграциями, если их применение
+// при старте не разрешено (MIGRATE_ON_START или база в памяти), и дозаполняет поисковый индекс пользователей
+func prepareSchema(migrator *migrations.Migrator, db *gorm.DB, migrate bool) {
+	ctx := context.Background()
+	if migrate {
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			log.Printf("Applied migration %s", m)
+		}
+		if err != nil {
+			log.Fatalf("Failed to migrate: %v", err)
+		}
+	} else if err := migrator.RequireCurrent(ctx); err != nil {
+		log.Fatalf("%v (run \"migrate up\" or set MIGRATE_ON_START=true)", err)
+	}
+	if err := repository.BackfillUserSearchIndex(db); err != nil {
+		log.Fatalf("Failed to build search index: %v", err)
+	}
+}
+
+// runMigrate выполняет подкоманду migrate: up применяет все ожидающие миграции,
+// down [N] откатывает N последних (по умолчанию одну), status показывает состояние каждой
+func runMigrate(migrator *migrations.Migrator, args []string) {
+	ctx := context.Background()
+	if len(args) == 0 {
+		log.Fatal("usage: migrate up | down [N] | status")
+	}
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Println("applied", m)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				log.Fatalf("migrate down expects a positive number of migrations, got %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			fmt.Println("reverted", m)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no applied migrations")
+		}
+	case args[0] == "status" && len(args) == 1:
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MIGRATION\tSTATUS\tAPPLIED AT")
+		for _, st := range statuses {
+			status, appliedAt := "pending", ""
+			if st.AppliedAt != nil {
+				status, appliedAt = "applied", st.AppliedAt.Format(time.RFC3339)
+			}
+			if st.Unknown {
+				status = "unknown to this build"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", st.Migration, status, appliedAt)
+		}
+		w.Flush()
+	default:
+		log.Fatal("usage: migrate up | down [N] | status")
+	}
+}
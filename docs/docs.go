@@ -15,356 +15,2037 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/delete/{id}": {
-            "delete": {
-                "description": "Удаляет пользователя по ID из URL",
+        "/api_keys": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает все ключи, включая отозванные и просроченные, без секретной части",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "users"
+                    "api_keys"
                 ],
-                "summary": "Удаление пользователя по ID",
+                "summary": "Список API-ключей",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.APIKey"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Admin role required",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Создает ключ с областями доступа users:read, users:write, friends:read, friends:write. Сам ключ возвращается только в этом ответе",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "api_keys"
+                ],
+                "summary": "Выпуск API-ключа",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "ID пользователя",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Key name, scopes and optional expiry",
+                        "name": "key",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/service.CreateAPIKeyRequest"
+                        }
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/service.CreatedAPIKey"
                         }
                     },
                     "400": {
-                        "description": "Bad request",
+                        "description": "Invalid data",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     },
-                    "404": {
-                        "description": "User not found",
+                    "403": {
+                        "description": "Admin role required",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     }
                 }
             }
         },
-        "/update/{id}": {
-            "put": {
-                "description": "Обновляет пользователя по ID из URL, новые данные берутся из тела запроса",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
+        "/api_keys/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Отзывает ключ: дальнейшие запросы с ним получают 401",
                 "tags": [
-                    "users"
+                    "api_keys"
                 ],
-                "summary": "Обновление пользователя по ID",
+                "summary": "Отзыв API-ключа",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "ID пользователя",
+                        "description": "API key id",
                         "name": "id",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "User updated successfully",
+                    "204": {
+                        "description": "No Content",
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "type": "string"
                         }
                     },
                     "400": {
-                        "description": "Bad request",
+                        "description": "Invalid key id",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     },
-                    "404": {
-                        "description": "User not found",
+                    "403": {
+                        "description": "Admin role required",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     },
-                    "409": {
-                        "description": "Conflict: new email already in use",
+                    "404": {
+                        "description": "Api key not found or already revoked",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     }
                 }
             }
         },
-        "/users": {
-            "get": {
-                "description": "Отдает массив из всех пользователей базы",
+        "/auth/login": {
+            "post": {
+                "description": "Проверяет email и пароль и выдаёт access- и refresh-токены. При включенной 2FA нужен также otp_code или recovery_code",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "auth"
+                ],
+                "summary": "Вход по email и паролю",
+                "parameters": [
+                    {
+                        "description": "Email and password",
+                        "name": "credentials",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.loginRequest"
+                        }
+                    }
                 ],
-                "summary": "Хендлер для получения списка всех юзеров из базы",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/model.User"
-                            }
+                            "$ref": "#/definitions/service.AuthResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid JSON",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid email or password, two-factor code required or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/auth/logout": {
             "post": {
-                "description": "Создаёт нового пользователя из данных в теле запроса",
+                "description": "Отзывает refresh-токен вместе со всеми токенами, полученными из него обновлением",
                 "consumes": [
                     "application/json"
                 ],
-                "produces": [
-                    "application/json"
-                ],
                 "tags": [
-                    "users"
+                    "auth"
                 ],
-                "summary": "Хендлер для создания нового пользователя",
+                "summary": "Выход",
                 "parameters": [
                     {
-                        "description": "User info",
-                        "name": "user",
+                        "description": "Refresh token",
+                        "name": "token",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "$ref": "#/definitions/handler.refreshRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "204": {
+                        "description": "No Content",
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "type": "string"
                         }
                     },
                     "400": {
-                        "description": "Incomplete data input",
+                        "description": "Invalid JSON",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     },
-                    "409": {
-                        "description": "Email conflict: already in use",
+                    "401": {
+                        "description": "Invalid refresh token",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     }
                 }
             }
         },
-        "/users/{id1}/make_friend/{id2}": {
+        "/auth/password_reset": {
             "post": {
-                "description": "Создаёт новую связь между 2мя существующими пользователями",
-                "produces": [
-                    "text/plain"
+                "description": "Отправляет на email ссылку для сброса пароля. Ответ одинаковый для зарегистрированных и незарегистрированных адресов",
+                "consumes": [
+                    "application/json"
                 ],
                 "tags": [
-                    "friendship"
+                    "auth"
                 ],
-                "summary": "Хендлер для создания новой связи - дружбы",
+                "summary": "Запрос сброса пароля",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User id 1 - friendship requester",
-                        "name": "id1",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "User id 2 - friendship acceptor",
-                        "name": "id2",
-                        "in": "path",
-                        "required": true
+                        "description": "Account email",
+                        "name": "email",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.passwordResetRequest"
+                        }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Successfully added a new friend",
+                    "202": {
+                        "description": "Accepted",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "400": {
-                        "description": "Invalid data",
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
-                    "404": {
-                        "description": "One or both users don't exist",
+                        "description": "Invalid JSON or email",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     }
                 }
             }
         },
-        "/users/{id1}/remove_friend/{id2}": {
-            "delete": {
-                "description": "Удаляет существующую связь между 2мя пользователями, id обоих берутся из URL",
-                "produces": [
-                    "text/plain"
+        "/auth/password_reset/confirm": {
+            "post": {
+                "description": "Задает новый пароль по одноразовому токену из письма и завершает все сессии пользователя",
+                "consumes": [
+                    "application/json"
                 ],
                 "tags": [
-                    "friendship"
+                    "auth"
                 ],
-                "summary": "Удаление существующей связи - дружбы",
+                "summary": "Сброс пароля",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User id 1 - friendship requester",
-                        "name": "id1",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "User id 2 - friendship acceptor",
-                        "name": "id2",
-                        "in": "path",
-                        "required": true
+                        "description": "Token and new password",
+                        "name": "reset",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/service.PasswordResetRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "204": {
-                        "description": "No Content",
+                        "description": "Password changed",
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "type": "string"
                         }
                     },
                     "400": {
-                        "description": "Invalid data input",
+                        "description": "Invalid JSON or weak password",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     },
-                    "404": {
-                        "description": "One or both users don't exist",
+                    "401": {
+                        "description": "Invalid, expired or already used token",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     }
                 }
             }
         },
-        "/users/{id}": {
-            "get": {
-                "description": "Возвращает пользователя в формате JSON по ID из URL",
+        "/auth/refresh": {
+            "post": {
+                "description": "Обменивает refresh-токен на новую пару токенов. Старый refresh-токен становится недействительным, его повторное использование отзывает всю сессию",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "auth"
                 ],
-                "summary": "Получение пользователя по ID",
+                "summary": "Обновление токенов",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "ID пользователя",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Refresh token",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.refreshRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/model.User"
+                            "$ref": "#/definitions/service.TokenPair"
                         }
                     },
-                    "404": {
-                        "description": "User not found",
+                    "400": {
+                        "description": "Invalid JSON",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or expired refresh token",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     }
                 }
             }
         },
-        "/users/{id}/friends": {
-            "get": {
-                "description": "Возвращает массив JSON из пользователей, которые состоят в связи с указанным в запросе пользователем",
+        "/auth/register": {
+            "post": {
+                "description": "Создаёт пользователя с паролем (не короче 8 символов) и сразу выдаёт access- и refresh-токены",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "friendship"
+                    "auth"
                 ],
-                "summary": "Получение списка друзей пользователя",
+                "summary": "Регистрация пользователя",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User id - friendship requester",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Registration data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/service.RegisterRequest"
+                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Successful load of friends list",
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/service.AuthResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid JSON, empty fields, invalid email or weak password",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Email conflict: already in use",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/delete/{id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Мягко удаляет пользователя по ID из URL. До окончательной очистки его можно восстановить. С If-Match удаление проходит, только если пользователь не менялся",
+                "tags": [
+                    "users"
+                ],
+                "summary": "Удаление пользователя по ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag пользователя из GET /users/{id} или *",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Action on another user's account",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "User has been modified: If-Match does not match",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "428": {
+                        "description": "If-Match header is required",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/update/{id}": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Обновляет пользователя по ID из URL, новые данные берутся из тела запроса. С If-Match обновление проходит, только если пользователь не менялся. Отдает пользователя целиком и его новый ETag",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Обновление пользователя по ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag пользователя из GET /users/{id} или *",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "User updated successfully",
+                        "schema": {
+                            "$ref": "#/definitions/model.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Новая версия пользователя"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid id, JSON or email, or all fields are empty",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Action on another user's account",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict: new email already in use",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "User has been modified: If-Match does not match",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "428": {
+                        "description": "If-Match header is required",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Отдает страницу пользователей. По умолчанию упорядочены по id. Поддерживается offset-пагинация и непрозрачный курсор из next_cursor",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Хендлер для получения списка юзеров из базы с пагинацией, фильтрацией и сортировкой",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Фильтр по имени (без учета регистра)",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Фильтр по фамилии (без учета регистра)",
+                        "name": "surname",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Фильтр по домену email, например example.com",
+                        "name": "email_domain",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Поиск подстроки в имени, фамилии и email",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Сортировка: поля id, name, surname, email через запятую, '-' - по убыванию",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы (1-100, по умолчанию 20)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Смещение от начала списка",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Курсор следующей страницы (next_cursor из предыдущего ответа)",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Вернуть общее количество пользователей",
+                        "name": "total",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.UserPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid pagination, sort or filter parameters",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Создаёт нового пользователя из данных в теле запроса",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Хендлер для создания нового пользователя",
+                "parameters": [
+                    {
+                        "description": "User info",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.createUserRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/model.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия созданного пользователя"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid JSON, empty fields, invalid email or role",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Only admins can assign roles",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Email conflict: already in use",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/search": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Ищет пользователей по имени, фамилии и email с учетом опечаток и транслитерации (кириллица/латиница), результаты упорядочены по релевантности",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Полнотекстовый поиск пользователей",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Поисковый запрос",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Максимальное количество результатов (1-100, по умолчанию 20)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/repository.UserSearchHit"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Empty query or invalid limit",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Search is not supported by the database",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id1}/make_friend/{id2}": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Создаёт заявку в друзья от id1 к id2 в статусе pending. Если id2 уже отправил заявку id1, она принимается",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "friendship"
+                ],
+                "summary": "Хендлер для отправки заявки в друзья",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id 1 - friendship requester",
+                        "name": "id1",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User id 2 - friendship acceptor",
+                        "name": "id2",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Friend request sent or accepted",
+                        "schema": {
+                            "$ref": "#/definitions/model.Friendship"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "One of the users has blocked the other, or id1 is not the caller",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "One or both users don't exist",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Friendship or pending request already exists",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id1}/mutual_friends/{id2}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Возвращает страницу пользователей, которые дружат и с id1, и с id2, а также общее количество таких друзей",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "friendship"
+                ],
+                "summary": "Общие друзья двух пользователей",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id 1",
+                        "name": "id1",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User id 2",
+                        "name": "id2",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы (1-100, по умолчанию 20)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Смещение от начала списка",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.MutualFriends"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "One or both users don't exist",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id1}/path/{id2}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Возвращает кратчайшую цепочку пользователей от id1 до id2, в которой каждый соседний дружит с предыдущим",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "friendship"
+                ],
+                "summary": "Степени разделения между пользователями",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id 1 - начало пути",
+                        "name": "id1",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User id 2 - конец пути",
+                        "name": "id2",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Максимальная длина пути (по умолчанию и не более 6)",
+                        "name": "max_depth",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.FriendPath"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found or no path within depth limit",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Search exceeded visit budget",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id1}/remove_friend/{id2}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Удаляет существующую дружбу между 2мя пользователями, id обоих берутся из URL. Порядок id не важен",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "friendship"
+                ],
+                "summary": "Удаление существующей связи - дружбы",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id 1",
+                        "name": "id1",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User id 2",
+                        "name": "id2",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "$ref": "#/definitions/model.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data input",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Action on another user's account",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "One or both users don't exist or they are not friends",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Возвращает пользователя в формате JSON по ID из URL. В заголовке ETag - версия пользователя: с ней в If-None-Match повторный запрос вернет 304, если пользователь не менялся",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Получение пользователя по ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag из предыдущего ответа",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Версия пользователя"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid user id",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Применяет к пользователю (в представлении GET /users/{id}) JSON Merge Patch (RFC 7396, application/merge-patch+json) или JSON Patch (RFC 6902, application/json-patch+json, с операциями test). Менять можно name, surname и email, остальные поля только для чтения. Результат проверяется так же, как при создании пользователя. С If-Match изменение проходит, только если пользователь не менялся",
+                "consumes": [
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Частичное изменение пользователя по ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag пользователя из GET /users/{id} или *",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Merge patch (объект с новыми значениями) или JSON Patch (массив операций)",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/model.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Новая версия пользователя"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid id or patch document, invalid or empty fields, read-only fields changed",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Action on another user's account",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Test operation failed or new email already in use",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "User has been modified: If-Match does not match",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported patch content type",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Patch cannot be applied: missing path",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "428": {
+                        "description": "If-Match header is required",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/2fa/disable": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Отключает 2FA и удаляет коды восстановления. Требует действующий код из приложения или код восстановления",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "two_factor"
+                ],
+                "summary": "Отключение 2FA",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "otp_code or recovery_code",
+                        "name": "factor",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/service.SecondFactor"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Code required or invalid",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Only the account owner can disable 2FA",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Two-factor authentication is not set up",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/2fa/setup": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Выпускает новый TOTP-секрет и otpauth-URI для приложения-аутентификатора. 2FA включится после подтверждения кодом",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "two_factor"
+                ],
+                "summary": "Настройка 2FA",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.TOTPSetup"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid user id",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Only the account owner can set up 2FA",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Two-factor authentication is already enabled",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/2fa/verify": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Включает 2FA по первому коду из приложения и возвращает одноразовые коды восстановления. Коды показываются только один раз",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "two_factor"
+                ],
+                "summary": "Подтверждение 2FA",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Code from authenticator app",
+                        "name": "code",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.verifyTOTPRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/service.RecoveryCodes"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid code",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Only the account owner can enable 2FA",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Two-factor authentication is already enabled or not set up",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/block/{target}": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Пользователь id блокирует пользователя target. Дружба и заявки между ними удаляются, новые заявки запрещены в обе стороны",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "blocks"
+                ],
+                "summary": "Блокировка пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id - blocker",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User id - blocked user",
+                        "name": "target",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "User blocked",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Action on another user's account",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "One or both users don't exist",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "User is already blocked",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/blocked": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Возвращает блокировки, установленные пользователем, вместе с данными заблокированных",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "blocks"
+                ],
+                "summary": "Список заблокированных пользователей",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.Block"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/friend_requests/incoming": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Возвращает ожидающие заявки, отправленные пользователю, вместе с данными отправителей",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "friendship"
+                ],
+                "summary": "Входящие заявки в друзья",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.Friendship"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/friend_requests/outgoing": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Возвращает ожидающие заявки, отправленные пользователем, вместе с данными получателей",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "friendship"
+                ],
+                "summary": "Исходящие заявки в друзья",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/model.Friendship"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/friend_requests/{other}/accept": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Пользователь id принимает ожидающую заявку от пользователя other",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "friendship"
+                ],
+                "summary": "Принятие заявки в друзья",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id - friendship acceptor",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User id - friendship requester",
+                        "name": "other",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Friend request accepted",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Action on another user's account",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Pending friend request not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/friend_requests/{other}/cancel": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Пользователь id отзывает свою ожидающую заявку к пользователю other",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "friendship"
+                ],
+                "summary": "Отмена заявки в друзья",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id - friendship requester",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User id - friendship acceptor",
+                        "name": "other",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Friend request cancelled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Action on another user's account",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Pending friend request not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/friend_requests/{other}/decline": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Пользователь id отклоняет ожидающую заявку от пользователя other",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "friendship"
+                ],
+                "summary": "Отклонение заявки в друзья",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id - friendship acceptor",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User id - friendship requester",
+                        "name": "other",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Friend request declined",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Action on another user's account",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Pending friend request not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/friends": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Возвращает массив JSON из пользователей, которые состоят в дружбе с указанным в запросе пользователем, независимо от того, кто отправлял заявку",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "friendship"
+                ],
+                "summary": "Получение списка друзей пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successful load of friends list",
                         "schema": {
                             "type": "array",
                             "items": {
@@ -375,52 +2056,718 @@ const docTemplate = `{
                     "400": {
                         "description": "Invalid data",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/restore": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Восстанавливает мягко удаленного пользователя вместе с его дружбами, если срок хранения еще не истек",
+                "tags": [
+                    "users"
+                ],
+                "summary": "Восстановление пользователя по ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID пользователя",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Action on another user's account",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "User is not deleted",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/suggestions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Возвращает друзей друзей пользователя, которые еще не являются его друзьями, не состоят с ним в ожидающей заявке и не связаны с ним блокировкой. Упорядочены по убыванию количества общих друзей",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "friendship"
+                ],
+                "summary": "Рекомендации друзей",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы (1-100, по умолчанию 20)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Смещение от начала списка",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/repository.FriendSuggestion"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
                         }
                     },
                     "404": {
                         "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/unblock/{target}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Пользователь id снимает блокировку с пользователя target. Дружба при этом не восстанавливается",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "blocks"
+                ],
+                "summary": "Снятие блокировки",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id - blocker",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User id - blocked user",
+                        "name": "target",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "User unblocked",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Action on another user's account",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Block not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/verify_email": {
+            "post": {
+                "description": "Подтверждает email пользователя одноразовым токеном из письма. Авторизация не нужна - токен сам подтверждает владение адресом",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "email"
+                ],
+                "summary": "Подтверждение email",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Token from the email",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.verifyEmailRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Email verified",
                         "schema": {
                             "type": "string"
                         }
                     },
+                    "400": {
+                        "description": "Invalid data",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid, expired or already used token",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/verify_email/send": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    },
+                    {
+                        "ApiKeyAuth": []
+                    }
+                ],
+                "description": "Отправляет новую ссылку подтверждения email. Прежние ссылки перестают действовать",
+                "tags": [
+                    "email"
+                ],
+                "summary": "Повторная отправка письма подтверждения",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "400": {
+                        "description": "Invalid user id",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Action on another user's account",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Email is already verified",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/handler.problemResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "handler.createUserRequest": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "role": {
+                    "$ref": "#/definitions/model.Role"
+                },
+                "surname": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.fieldProblem": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.loginRequest": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "otp_code": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "recovery_code": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.passwordResetRequest": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.problemResponse": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "$ref": "#/definitions/policy.Action"
+                },
+                "api_key": {
+                    "type": "string"
+                },
+                "caller_id": {
+                    "type": "integer"
+                },
+                "code": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.fieldProblem"
+                    }
+                },
+                "instance": {
+                    "type": "string"
+                },
+                "owner_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
                     }
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.refreshRequest": {
+            "type": "object",
+            "properties": {
+                "refresh_token": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.verifyEmailRequest": {
+            "type": "object",
+            "properties": {
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.verifyTOTPRequest": {
+            "type": "object",
+            "properties": {
+                "otp_code": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.APIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "created_by": {
+                    "type": "integer"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "string"
+                }
+            }
+        },
+        "model.Block": {
+            "type": "object",
+            "properties": {
+                "blocked": {
+                    "$ref": "#/definitions/model.User"
+                },
+                "blocked_id": {
+                    "type": "integer"
+                },
+                "blocker_id": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
                 }
             }
-        }
-    },
-    "definitions": {
+        },
         "model.Friendship": {
             "type": "object",
             "properties": {
                 "accepter": {
                     "$ref": "#/definitions/model.User"
                 },
-                "accepterID": {
+                "accepter_id": {
                     "type": "integer"
                 },
-                "createdAt": {
+                "created_at": {
                     "type": "string"
                 },
                 "requester": {
                     "$ref": "#/definitions/model.User"
                 },
-                "requesterID": {
+                "requester_id": {
                     "type": "integer"
+                },
+                "status": {
+                    "$ref": "#/definitions/model.FriendshipStatus"
+                },
+                "updated_at": {
+                    "type": "string"
                 }
             }
         },
+        "model.FriendshipStatus": {
+            "type": "string",
+            "enum": [
+                "pending",
+                "accepted",
+                "declined",
+                "cancelled"
+            ],
+            "x-enum-varnames": [
+                "FriendshipPending",
+                "FriendshipAccepted",
+                "FriendshipDeclined",
+                "FriendshipCancelled"
+            ]
+        },
+        "model.Role": {
+            "type": "string",
+            "enum": [
+                "user",
+                "admin"
+            ],
+            "x-enum-varnames": [
+                "RoleUser",
+                "RoleAdmin"
+            ]
+        },
         "model.User": {
             "type": "object",
             "properties": {
                 "email": {
                     "type": "string"
                 },
+                "email_verified_at": {
+                    "description": "EmailVerifiedAt - когда пользователь подтвердил email по ссылке из письма, nil - не подтвержден",
+                    "type": "string"
+                },
+                "friendOf": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Friendship"
+                    }
+                },
+                "friends": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Friendship"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "role": {
+                    "description": "Role - роль пользователя, от нее зависят права на изменение чужих аккаунтов (см. пакет policy)",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.Role"
+                        }
+                    ]
+                },
+                "surname": {
+                    "type": "string"
+                },
+                "two_factor_enabled": {
+                    "type": "boolean"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "version": {
+                    "description": "Version - номер версии записи для оптимистичной блокировки: растет при каждом изменении\nвидимых полей и отдается клиенту в ETag. UpdatedAt - время последнего изменения.",
+                    "type": "integer"
+                }
+            }
+        },
+        "policy.Action": {
+            "type": "string",
+            "enum": [
+                "user.assign_role",
+                "user.update",
+                "user.delete",
+                "user.restore",
+                "friendship.manage",
+                "block.manage",
+                "api_key.manage",
+                "two_factor.manage",
+                "user.email",
+                "api_key.scope"
+            ],
+            "x-enum-varnames": [
+                "AssignRole",
+                "UpdateUser",
+                "DeleteUser",
+                "RestoreUser",
+                "ManageFriends",
+                "ManageBlocks",
+                "ManageAPIKeys",
+                "ManageTOTP",
+                "ManageEmail",
+                "UseScope"
+            ]
+        },
+        "repository.FriendSuggestion": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "email_verified_at": {
+                    "description": "EmailVerifiedAt - когда пользователь подтвердил email по ссылке из письма, nil - не подтвержден",
+                    "type": "string"
+                },
+                "friendOf": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Friendship"
+                    }
+                },
+                "friends": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.Friendship"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "mutual_friends": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "role": {
+                    "description": "Role - роль пользователя, от нее зависят права на изменение чужих аккаунтов (см. пакет policy)",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.Role"
+                        }
+                    ]
+                },
+                "surname": {
+                    "type": "string"
+                },
+                "two_factor_enabled": {
+                    "type": "boolean"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "version": {
+                    "description": "Version - номер версии записи для оптимистичной блокировки: растет при каждом изменении\nвидимых полей и отдается клиенту в ETag. UpdatedAt - время последнего изменения.",
+                    "type": "integer"
+                }
+            }
+        },
+        "repository.UserSearchHit": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "email_verified_at": {
+                    "description": "EmailVerifiedAt - когда пользователь подтвердил email по ссылке из письма, nil - не подтвержден",
+                    "type": "string"
+                },
                 "friendOf": {
                     "type": "array",
                     "items": {
@@ -439,10 +2786,246 @@ const docTemplate = `{
                 "name": {
                     "type": "string"
                 },
+                "role": {
+                    "description": "Role - роль пользователя, от нее зависят права на изменение чужих аккаунтов (см. пакет policy)",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/model.Role"
+                        }
+                    ]
+                },
+                "score": {
+                    "type": "number"
+                },
+                "surname": {
+                    "type": "string"
+                },
+                "two_factor_enabled": {
+                    "type": "boolean"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "version": {
+                    "description": "Version - номер версии записи для оптимистичной блокировки: растет при каждом изменении\nвидимых полей и отдается клиенту в ETag. UpdatedAt - время последнего изменения.",
+                    "type": "integer"
+                }
+            }
+        },
+        "service.AuthResult": {
+            "type": "object",
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "type": "integer"
+                },
+                "refresh_token": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "type": "string"
+                },
+                "user": {
+                    "$ref": "#/definitions/model.User"
+                }
+            }
+        },
+        "service.CreateAPIKeyRequest": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "service.CreatedAPIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "created_by": {
+                    "type": "integer"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.FriendPath": {
+            "type": "object",
+            "properties": {
+                "degrees": {
+                    "type": "integer"
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.User"
+                    }
+                }
+            }
+        },
+        "service.MutualFriends": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer"
+                },
+                "has_more": {
+                    "type": "boolean"
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.User"
+                    }
+                }
+            }
+        },
+        "service.PasswordResetRequest": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.RecoveryCodes": {
+            "type": "object",
+            "properties": {
+                "recovery_codes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "service.RegisterRequest": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
                 "surname": {
                     "type": "string"
                 }
             }
+        },
+        "service.SecondFactor": {
+            "type": "object",
+            "properties": {
+                "otp_code": {
+                    "type": "string"
+                },
+                "recovery_code": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.TOTPSetup": {
+            "type": "object",
+            "properties": {
+                "otpauth_uri": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.TokenPair": {
+            "type": "object",
+            "properties": {
+                "access_token": {
+                    "type": "string"
+                },
+                "expires_in": {
+                    "type": "integer"
+                },
+                "refresh_token": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "service.UserPage": {
+            "type": "object",
+            "properties": {
+                "has_more": {
+                    "type": "boolean"
+                },
+                "next_cursor": {
+                    "type": "string"
+                },
+                "total": {
+                    "type": "integer"
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.User"
+                    }
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "ApiKeyAuth": {
+            "description": "API-ключ сервиса в виде \"ApiKey \u003ckey\u003e\", выпускается администратором через /api_keys",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        },
+        "BearerAuth": {
+            "description": "Access-токен в виде \"Bearer \u003ctoken\u003e\", выдается /auth/login",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`